@@ -0,0 +1,224 @@
+package activity
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	llm "noerkrieg.com/server/llm"
+)
+
+// Supported activity file formats
+const (
+	FormatGPX = "gpx"
+	FormatTCX = "tcx"
+	FormatFIT = "fit"
+)
+
+// Summary is the totals of a single recorded activity
+type Summary struct {
+	Name          string
+	Sport         string
+	Start         time.Time
+	Duration      time.Duration
+	Distance      float64 // meters
+	ElevationGain float64 // meters
+	ElevationLoss float64 // meters
+	MaxElevation  float64 // meters, zero when unknown
+	HeartRate     float64 // average beats per minute, zero when unknown
+}
+
+// point is a single track sample
+type point struct {
+	time      time.Time
+	lat, lon  float64
+	elevation float64
+	hasPos    bool
+	hasEle    bool
+}
+
+// Detect identifies the format of an activity file from its name, falling
+// back to its contents
+func Detect(name string, content []byte) (string, bool) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gpx":
+		return FormatGPX, true
+	case ".tcx":
+		return FormatTCX, true
+	case ".fit":
+		return FormatFIT, true
+	}
+	if len(content) >= 12 && string(content[8:12]) == ".FIT" {
+		return FormatFIT, true
+	}
+	head := content[:min(len(content), 512)]
+	if bytes.Contains(head, []byte("<gpx")) {
+		return FormatGPX, true
+	}
+	if bytes.Contains(head, []byte("<TrainingCenterDatabase")) {
+		return FormatTCX, true
+	}
+	return "", false
+}
+
+// Parse reads the activities recorded in a file
+func Parse(format string, content []byte) ([]Summary, error) {
+	var summaries []Summary
+	var err error
+	switch format {
+	case FormatGPX:
+		summaries, err = parseGPX(content)
+	case FormatTCX:
+		summaries, err = parseTCX(content)
+	case FormatFIT:
+		summaries, err = parseFIT(content)
+	default:
+		return nil, fmt.Errorf("unsupported activity format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(summaries) == 0 {
+		return nil, fmt.Errorf("no activities found in %s file", format)
+	}
+	return summaries, nil
+}
+
+// ToExercise maps an activity to a cardio exercise, with distance expressed
+// in distanceUnit ("miles" or "kilometers") and duration in minutes. An
+// activity recorded without times is left without a timestamp.
+func ToExercise(s Summary, distanceUnit string) llm.Exercise {
+	ex := llm.Exercise{
+		Exercise:   exerciseName(s.Sport),
+		Type:       "cardio",
+		Attributes: []string{},
+		Timestamp:  s.Start,
+		Duration:   round(s.Duration.Minutes(), 2),
+		Metrics:    map[string]float64{},
+	}
+	ex.Summary = "Imported activity"
+	if s.Name != "" {
+		ex.Summary += ": " + s.Name
+	}
+
+	if s.Distance > 0 {
+		ex.QuantityType = distanceUnit
+		if distanceUnit == "kilometers" {
+			ex.Quantity = round(s.Distance/1000, 2)
+		} else {
+			ex.QuantityType = "miles"
+			ex.Quantity = round(s.Distance/1609.344, 2)
+		}
+		ex.Metrics["distance_meters"] = round(s.Distance, 1)
+	}
+	if s.Duration > 0 {
+		ex.Metrics["duration_seconds"] = round(s.Duration.Seconds(), 0)
+	}
+	if s.Distance > 0 && s.Duration > 0 {
+		ex.Metrics["pace_seconds_per_kilometer"] = round(s.Duration.Seconds()/(s.Distance/1000), 1)
+		ex.Metrics["pace_seconds_per_mile"] = round(s.Duration.Seconds()/(s.Distance/1609.344), 1)
+	}
+	if s.ElevationGain > 0 || s.ElevationLoss > 0 {
+		ex.Metrics["elevation_gain_meters"] = round(s.ElevationGain, 1)
+		ex.Metrics["elevation_loss_meters"] = round(s.ElevationLoss, 1)
+	}
+	if s.MaxElevation != 0 {
+		ex.Metrics["max_elevation_meters"] = round(s.MaxElevation, 1)
+	}
+	if s.HeartRate > 0 {
+		ex.Metrics["average_heart_rate"] = round(s.HeartRate, 0)
+	}
+	return ex
+}
+
+// exerciseName maps a device sport name to the pluralized exercise name
+func exerciseName(sport string) string {
+	switch strings.ToLower(sport) {
+	case "running", "run", "trail_running", "treadmill_running":
+		return "Runs"
+	case "biking", "cycling", "bike", "ride", "road_biking", "mountain_biking":
+		return "Bike Rides"
+	case "walking", "walk":
+		return "Walks"
+	case "hiking", "hike":
+		return "Hikes"
+	case "swimming", "swim", "open_water_swimming":
+		return "Swims"
+	case "rowing", "row":
+		return "Rows"
+	}
+	return "Cardio Sessions"
+}
+
+// summarize computes totals from a track
+func summarize(points []point) Summary {
+	var s Summary
+	if len(points) == 0 {
+		return s
+	}
+
+	// Points without a time are still part of the track, but only timed
+	// points bound the activity
+	var first, last time.Time
+	for _, p := range points {
+		if p.time.IsZero() {
+			continue
+		}
+		if first.IsZero() {
+			first = p.time
+		}
+		last = p.time
+	}
+	s.Start = first
+	s.Duration = last.Sub(first)
+	s.MaxElevation = math.Inf(-1)
+
+	var lastPos *point
+	var lastEle *point
+	for i := range points {
+		p := &points[i]
+		if p.hasPos {
+			if lastPos != nil {
+				s.Distance += haversine(lastPos.lat, lastPos.lon, p.lat, p.lon)
+			}
+			lastPos = p
+		}
+		if p.hasEle {
+			s.MaxElevation = math.Max(s.MaxElevation, p.elevation)
+			// Ignore sub-meter noise so GPS jitter does not inflate the climb
+			if lastEle == nil {
+				lastEle = p
+			} else if delta := p.elevation - lastEle.elevation; math.Abs(delta) >= 1 {
+				if delta > 0 {
+					s.ElevationGain += delta
+				} else {
+					s.ElevationLoss -= delta
+				}
+				lastEle = p
+			}
+		}
+	}
+	if math.IsInf(s.MaxElevation, -1) {
+		s.MaxElevation = 0
+	}
+	return s
+}
+
+// haversine returns the great-circle distance in meters between two points
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371008.8
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+func round(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
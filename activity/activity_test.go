@@ -0,0 +1,265 @@
+package activity
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+const gpxRun = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <metadata><name>Morning Run</name><time>2024-03-01T07:00:00Z</time></metadata>
+  <trk>
+    <type>running</type>
+    <trkseg>
+      <trkpt lat="0" lon="0"><ele>100</ele><time>2024-03-01T07:00:00Z</time></trkpt>
+      <trkpt lat="0.005" lon="0"><ele>100.5</ele><time>2024-03-01T07:03:00Z</time></trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="0.01" lon="0"><ele>103</ele><time>2024-03-01T07:05:00Z</time></trkpt>
+      <trkpt lat="0.01" lon="0"><ele>101</ele><time>2024-03-01T07:06:00Z</time></trkpt>
+    </trkseg>
+  </trk>
+  <trk><name>Empty</name><trkseg></trkseg></trk>
+</gpx>`
+
+const tcxRide = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+  <Activities>
+    <Activity Sport="Biking">
+      <Id>2024-03-02T09:00:00Z</Id>
+      <Notes>Commute</Notes>
+      <Lap StartTime="2024-03-02T09:00:00Z">
+        <TotalTimeSeconds>600</TotalTimeSeconds>
+        <DistanceMeters>2000</DistanceMeters>
+        <AverageHeartRateBpm><Value>150</Value></AverageHeartRateBpm>
+        <Track>
+          <Trackpoint><Time>2024-03-02T09:00:00Z</Time><AltitudeMeters>50</AltitudeMeters></Trackpoint>
+          <Trackpoint><Time>2024-03-02T09:10:00Z</Time><AltitudeMeters>60</AltitudeMeters></Trackpoint>
+        </Track>
+      </Lap>
+      <Lap StartTime="2024-03-02T09:10:00Z">
+        <TotalTimeSeconds>300</TotalTimeSeconds>
+        <DistanceMeters>1000</DistanceMeters>
+        <AverageHeartRateBpm><Value>160</Value></AverageHeartRateBpm>
+      </Lap>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`
+
+// fitMessage is a FIT message type and the values of one message of it
+type fitMessage struct {
+	global uint16
+	fields []fitField
+	values []uint64
+}
+
+// fitFile encodes messages as a little-endian FIT file, defining each
+// message type as local message 0 before its data message
+func fitFile(messages ...fitMessage) []byte {
+	var data []byte
+	for _, m := range messages {
+		data = append(data, 0x40, 0, 0)
+		data = binary.LittleEndian.AppendUint16(data, m.global)
+		data = append(data, byte(len(m.fields)))
+		for _, f := range m.fields {
+			data = append(data, f.number, byte(f.size), f.baseType)
+		}
+		data = append(data, 0)
+		for i, f := range m.fields {
+			switch f.size {
+			case 1:
+				data = append(data, byte(m.values[i]))
+			case 2:
+				data = binary.LittleEndian.AppendUint16(data, uint16(m.values[i]))
+			case 4:
+				data = binary.LittleEndian.AppendUint32(data, uint32(m.values[i]))
+			}
+		}
+	}
+	header := []byte{12, 0x10, 0, 0}
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(data)))
+	header = append(header, ".FIT"...)
+	return append(header, data...)
+}
+
+// fitSeconds is t in seconds since the FIT epoch
+func fitSeconds(t time.Time) uint64 {
+	return uint64(t.Sub(fitEpoch) / time.Second)
+}
+
+func TestParse(t *testing.T) {
+	swimStart := time.Date(2024, 3, 3, 6, 30, 0, 0, time.UTC)
+	walkStart := time.Date(2024, 3, 4, 18, 0, 0, 0, time.UTC)
+	session := fitMessage{
+		global: fitSession,
+		fields: []fitField{
+			{number: fitSessionStart, size: 4}, {number: fitSessionSport, size: 1},
+			{number: fitSessionElapsed, size: 4}, {number: fitSessionDistance, size: 4},
+			{number: fitSessionHeart, size: 1}, {number: fitSessionAscent, size: 2},
+			{number: fitSessionDescent, size: 2},
+		},
+		// The unset ascent and descent hold the invalid sentinel
+		values: []uint64{fitSeconds(swimStart), 5, 1800000, 150000, 140, math.MaxUint16, math.MaxUint16},
+	}
+	record := func(at time.Time, altitude float64, distance float64) fitMessage {
+		return fitMessage{
+			global: fitRecord,
+			fields: []fitField{{number: fitTimestamp, size: 4}, {number: fitRecordAltitude, size: 2}, {number: fitRecordDistance, size: 4}},
+			values: []uint64{fitSeconds(at), uint64((altitude + 500) * 5), uint64(distance * 100)},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		content []byte
+		want    []Summary
+	}{
+		{
+			name:    "gpx track",
+			format:  FormatGPX,
+			content: []byte(gpxRun),
+			want: []Summary{{
+				Name: "Morning Run", Sport: "running", Start: time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC),
+				Duration: 6 * time.Minute, Distance: 1111.95, ElevationGain: 3, ElevationLoss: 2, MaxElevation: 103,
+			}},
+		},
+		{
+			name:   "gpx track missing its first time",
+			format: FormatGPX,
+			content: []byte(`<gpx><trk><trkseg>
+				<trkpt lat="0" lon="0"></trkpt>
+				<trkpt lat="0.005" lon="0"><time>2024-03-01T07:03:00Z</time></trkpt>
+				<trkpt lat="0.01" lon="0"><time>2024-03-01T07:06:00Z</time></trkpt>
+				<trkpt lat="0.01" lon="0.001"></trkpt>
+			</trkseg></trk></gpx>`),
+			want: []Summary{{Start: time.Date(2024, 3, 1, 7, 3, 0, 0, time.UTC), Duration: 3 * time.Minute, Distance: 1223.15}},
+		},
+		{
+			name:   "gpx track without times",
+			format: FormatGPX,
+			content: []byte(`<gpx><trk><trkseg>
+				<trkpt lat="0" lon="0"></trkpt><trkpt lat="0.01" lon="0"></trkpt>
+			</trkseg></trk></gpx>`),
+			want: []Summary{{Distance: 1111.95}},
+		},
+		{
+			name:    "tcx laps",
+			format:  FormatTCX,
+			content: []byte(tcxRide),
+			want: []Summary{{
+				Name: "Commute", Sport: "Biking", Start: time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC),
+				Duration: 15 * time.Minute, Distance: 3000, ElevationGain: 10, MaxElevation: 60, HeartRate: 153.33,
+			}},
+		},
+		{
+			name:    "fit session",
+			format:  FormatFIT,
+			content: fitFile(record(swimStart, 0, 0), session),
+			want: []Summary{{
+				Sport: "swimming", Start: swimStart, Duration: 30 * time.Minute, Distance: 1500, HeartRate: 140,
+			}},
+		},
+		{
+			name:   "fit records without a session",
+			format: FormatFIT,
+			content: fitFile(
+				record(walkStart, 10, 0),
+				record(walkStart.Add(10*time.Minute), 15, 800),
+				record(walkStart.Add(20*time.Minute), 12, 1650),
+			),
+			want: []Summary{{
+				Start: walkStart, Duration: 20 * time.Minute, Distance: 1650,
+				ElevationGain: 5, ElevationLoss: 3, MaxElevation: 15,
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summaries, err := Parse(tt.format, tt.content)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(summaries) != len(tt.want) {
+				t.Fatalf("got %d activities, want %d: %+v", len(summaries), len(tt.want), summaries)
+			}
+			for i, got := range summaries {
+				want := tt.want[i]
+				if got.Name != want.Name || got.Sport != want.Sport || !got.Start.Equal(want.Start) || got.Duration != want.Duration {
+					t.Errorf("activity %d = %+v, want %+v", i, got, want)
+				}
+				for _, v := range []struct {
+					name      string
+					got, want float64
+				}{
+					{"distance", got.Distance, want.Distance},
+					{"elevation gain", got.ElevationGain, want.ElevationGain},
+					{"elevation loss", got.ElevationLoss, want.ElevationLoss},
+					{"max elevation", got.MaxElevation, want.MaxElevation},
+					{"heart rate", got.HeartRate, want.HeartRate},
+				} {
+					if math.Abs(v.got-v.want) > 0.01 {
+						t.Errorf("activity %d %s = %v, want %v", i, v.name, v.got, v.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content []byte
+		err     string
+	}{
+		{name: "unknown format", format: "kml", content: []byte("<kml/>"), err: "unsupported activity format"},
+		{name: "malformed gpx", format: FormatGPX, content: []byte("<gpx><trk>"), err: "invalid gpx file"},
+		{name: "gpx without tracks", format: FormatGPX, content: []byte("<gpx></gpx>"), err: "no activities found"},
+		{name: "bad tcx time", format: FormatTCX, content: []byte(`<TrainingCenterDatabase><Activities><Activity><Lap>` +
+			`<Track><Trackpoint><Time>yesterday</Time></Trackpoint></Track></Lap></Activity></Activities></TrainingCenterDatabase>`),
+			err: "invalid tcx time"},
+		{name: "fit without header", format: FormatFIT, content: []byte("not a fit file"), err: "missing header"},
+		{name: "truncated fit", format: FormatFIT, content: fitFile(fitMessage{global: fitRecord,
+			fields: []fitField{{number: fitTimestamp, size: 4}}, values: []uint64{1}})[:20], err: "truncated"},
+		{name: "fit data without definition", format: FormatFIT,
+			content: append([]byte{12, 0x10, 0, 0, 1, 0, 0, 0}, append([]byte(".FIT"), 0)...), err: "without definition"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.format, tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Parse error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		format  string
+	}{
+		{name: "gpx extension", file: "run.GPX", format: FormatGPX},
+		{name: "tcx extension", file: "ride.tcx", format: FormatTCX},
+		{name: "fit extension", file: "swim.fit", format: FormatFIT},
+		{name: "fit header", file: "upload", content: fitFile(), format: FormatFIT},
+		{name: "gpx content", file: "upload.xml", content: []byte(gpxRun), format: FormatGPX},
+		{name: "tcx content", file: "upload.xml", content: []byte(tcxRide), format: FormatTCX},
+		{name: "unknown", file: "notes.txt", content: []byte("ran 5k")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, ok := Detect(tt.file, tt.content)
+			if format != tt.format || ok != (tt.format != "") {
+				t.Errorf("Detect(%q) = %q, %v, want %q", tt.file, format, ok, tt.format)
+			}
+		})
+	}
+}
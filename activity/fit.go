@@ -0,0 +1,207 @@
+package activity
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// FIT global message numbers and field numbers used for summaries
+const (
+	fitSession = 18
+	fitRecord  = 20
+
+	fitSessionStart    = 2
+	fitSessionSport    = 5
+	fitSessionElapsed  = 7
+	fitSessionDistance = 9
+	fitSessionHeart    = 16
+	fitSessionAscent   = 22
+	fitSessionDescent  = 23
+
+	fitRecordAltitude    = 2
+	fitRecordDistance    = 5
+	fitRecordEnhancedAlt = 78
+	fitTimestamp         = 253
+)
+
+// fitEpoch is the zero time of FIT timestamps
+var fitEpoch = time.Date(1989, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// fitSports names the FIT sport enum values
+var fitSports = map[uint64]string{
+	1:  "running",
+	2:  "cycling",
+	5:  "swimming",
+	11: "walking",
+	15: "rowing",
+	17: "hiking",
+}
+
+type fitField struct {
+	number   byte
+	size     int
+	baseType byte
+}
+
+type fitDefinition struct {
+	global    uint16
+	order     binary.ByteOrder
+	fields    []fitField
+	devFields int // total size in bytes of developer fields, which are skipped
+}
+
+// parseFIT decodes the session messages of a FIT file, falling back to the
+// record stream when a device writes no session
+func parseFIT(content []byte) ([]Summary, error) {
+	if len(content) < 12 || string(content[8:12]) != ".FIT" {
+		return nil, fmt.Errorf("invalid fit file: missing header")
+	}
+	headerSize := int(content[0])
+	dataSize := int(binary.LittleEndian.Uint32(content[4:8]))
+	if headerSize < 12 || headerSize+dataSize > len(content) {
+		return nil, fmt.Errorf("invalid fit file: truncated")
+	}
+	data := content[headerSize : headerSize+dataSize]
+
+	definitions := make(map[byte]*fitDefinition)
+	sessions := make([]Summary, 0)
+	records := make([]point, 0)
+	var lastDistance float64
+
+	for pos := 0; pos < len(data); {
+		header := data[pos]
+		pos++
+
+		var local byte
+		if header&0x80 != 0 {
+			// Compressed timestamp header, always a data message
+			local = (header >> 5) & 0x03
+		} else {
+			local = header & 0x0F
+			if header&0x40 != 0 {
+				def, n, err := readFITDefinition(data[pos:], header&0x20 != 0)
+				if err != nil {
+					return nil, err
+				}
+				definitions[local] = def
+				pos += n
+				continue
+			}
+		}
+
+		def, ok := definitions[local]
+		if !ok {
+			return nil, fmt.Errorf("invalid fit file: data message without definition")
+		}
+		values := make(map[byte]uint64, len(def.fields))
+		for _, field := range def.fields {
+			if pos+field.size > len(data) {
+				return nil, fmt.Errorf("invalid fit file: truncated message")
+			}
+			if value, ok := fitValue(data[pos:pos+field.size], field, def.order); ok {
+				values[field.number] = value
+			}
+			pos += field.size
+		}
+		pos += def.devFields
+		if pos > len(data) {
+			return nil, fmt.Errorf("invalid fit file: truncated message")
+		}
+
+		switch def.global {
+		case fitSession:
+			s := Summary{Sport: fitSports[values[fitSessionSport]]}
+			if v, ok := values[fitSessionStart]; ok {
+				s.Start = fitEpoch.Add(time.Duration(v) * time.Second)
+			}
+			s.Duration = time.Duration(values[fitSessionElapsed]) * time.Millisecond
+			s.Distance = float64(values[fitSessionDistance]) / 100
+			s.ElevationGain = float64(values[fitSessionAscent])
+			s.ElevationLoss = float64(values[fitSessionDescent])
+			s.HeartRate = float64(values[fitSessionHeart])
+			sessions = append(sessions, s)
+		case fitRecord:
+			p := point{}
+			if v, ok := values[fitTimestamp]; ok {
+				p.time = fitEpoch.Add(time.Duration(v) * time.Second)
+			}
+			if v, ok := values[fitRecordEnhancedAlt]; ok {
+				p.elevation, p.hasEle = float64(v)/5-500, true
+			} else if v, ok := values[fitRecordAltitude]; ok {
+				p.elevation, p.hasEle = float64(v)/5-500, true
+			}
+			if v, ok := values[fitRecordDistance]; ok {
+				lastDistance = float64(v) / 100
+			}
+			records = append(records, p)
+		}
+	}
+
+	if len(sessions) > 0 {
+		return sessions, nil
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	s := summarize(records)
+	s.Distance = lastDistance
+	return []Summary{s}, nil
+}
+
+// readFITDefinition reads a definition message and returns its length
+func readFITDefinition(data []byte, developer bool) (*fitDefinition, int, error) {
+	if len(data) < 5 {
+		return nil, 0, fmt.Errorf("invalid fit file: truncated definition")
+	}
+	def := &fitDefinition{order: binary.LittleEndian}
+	if data[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.global = def.order.Uint16(data[2:4])
+	count := int(data[4])
+	pos := 5
+	if len(data) < pos+count*3 {
+		return nil, 0, fmt.Errorf("invalid fit file: truncated definition")
+	}
+	for i := 0; i < count; i++ {
+		def.fields = append(def.fields, fitField{
+			number:   data[pos],
+			size:     int(data[pos+1]),
+			baseType: data[pos+2],
+		})
+		pos += 3
+	}
+	if developer {
+		if len(data) < pos+1 {
+			return nil, 0, fmt.Errorf("invalid fit file: truncated definition")
+		}
+		count := int(data[pos])
+		pos++
+		if len(data) < pos+count*3 {
+			return nil, 0, fmt.Errorf("invalid fit file: truncated definition")
+		}
+		for i := 0; i < count; i++ {
+			def.devFields += int(data[pos+1])
+			pos += 3
+		}
+	}
+	return def, pos, nil
+}
+
+// fitValue decodes an unsigned integer field, reporting false for the
+// format's invalid sentinel and for field sizes it does not summarize
+func fitValue(raw []byte, field fitField, order binary.ByteOrder) (uint64, bool) {
+	switch field.size {
+	case 1:
+		return uint64(raw[0]), raw[0] != math.MaxUint8
+	case 2:
+		v := order.Uint16(raw)
+		return uint64(v), v != math.MaxUint16
+	case 4:
+		v := order.Uint32(raw)
+		return uint64(v), v != math.MaxUint32
+	}
+	return 0, false
+}
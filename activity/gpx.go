@@ -0,0 +1,74 @@
+package activity
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+type gpxFile struct {
+	Metadata struct {
+		Name string `xml:"name"`
+		Time string `xml:"time"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxPoint struct {
+	Lat       float64  `xml:"lat,attr"`
+	Lon       float64  `xml:"lon,attr"`
+	Elevation *float64 `xml:"ele"`
+	Time      string   `xml:"time"`
+}
+
+// parseGPX summarizes each track of a GPX file as an activity
+func parseGPX(content []byte) ([]Summary, error) {
+	var file gpxFile
+	if err := xml.NewDecoder(bytes.NewReader(content)).Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid gpx file: %w", err)
+	}
+
+	summaries := make([]Summary, 0, len(file.Tracks))
+	for _, track := range file.Tracks {
+		points := make([]point, 0)
+		for _, segment := range track.Segments {
+			for _, p := range segment.Points {
+				pt := point{lat: p.Lat, lon: p.Lon, hasPos: true}
+				if p.Elevation != nil {
+					pt.elevation = *p.Elevation
+					pt.hasEle = true
+				}
+				if p.Time != "" {
+					t, err := time.Parse(time.RFC3339, p.Time)
+					if err != nil {
+						return nil, fmt.Errorf("invalid gpx time %q", p.Time)
+					}
+					pt.time = t
+				}
+				points = append(points, pt)
+			}
+		}
+		if len(points) == 0 {
+			continue
+		}
+
+		s := summarize(points)
+		s.Name = track.Name
+		if s.Name == "" {
+			s.Name = file.Metadata.Name
+		}
+		s.Sport = track.Type
+		if s.Start.IsZero() && file.Metadata.Time != "" {
+			s.Start, _ = time.Parse(time.RFC3339, file.Metadata.Time)
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
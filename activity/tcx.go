@@ -0,0 +1,86 @@
+package activity
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+type tcxFile struct {
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		ID    string `xml:"Id"`
+		Notes string `xml:"Notes"`
+		Laps  []struct {
+			StartTime        string   `xml:"StartTime,attr"`
+			TotalTimeSeconds float64  `xml:"TotalTimeSeconds"`
+			DistanceMeters   float64  `xml:"DistanceMeters"`
+			AverageHeartRate *float64 `xml:"AverageHeartRateBpm>Value"`
+			Points           []struct {
+				Time      string   `xml:"Time"`
+				Latitude  *float64 `xml:"Position>LatitudeDegrees"`
+				Longitude *float64 `xml:"Position>LongitudeDegrees"`
+				Altitude  *float64 `xml:"AltitudeMeters"`
+			} `xml:"Track>Trackpoint"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+// parseTCX summarizes each activity of a TCX file, preferring the device's
+// lap totals over values recomputed from the track
+func parseTCX(content []byte) ([]Summary, error) {
+	var file tcxFile
+	if err := xml.NewDecoder(bytes.NewReader(content)).Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid tcx file: %w", err)
+	}
+
+	summaries := make([]Summary, 0, len(file.Activities))
+	for _, activity := range file.Activities {
+		points := make([]point, 0)
+		var duration, distance, heartRate float64
+		for _, lap := range activity.Laps {
+			duration += lap.TotalTimeSeconds
+			distance += lap.DistanceMeters
+			if lap.AverageHeartRate != nil {
+				heartRate += *lap.AverageHeartRate * lap.TotalTimeSeconds
+			}
+			for _, p := range lap.Points {
+				pt := point{}
+				if p.Time != "" {
+					t, err := time.Parse(time.RFC3339, p.Time)
+					if err != nil {
+						return nil, fmt.Errorf("invalid tcx time %q", p.Time)
+					}
+					pt.time = t
+				}
+				if p.Latitude != nil && p.Longitude != nil {
+					pt.lat, pt.lon, pt.hasPos = *p.Latitude, *p.Longitude, true
+				}
+				if p.Altitude != nil {
+					pt.elevation, pt.hasEle = *p.Altitude, true
+				}
+				points = append(points, pt)
+			}
+		}
+
+		s := summarize(points)
+		s.Sport = activity.Sport
+		s.Name = activity.Notes
+		if start, err := time.Parse(time.RFC3339, activity.ID); err == nil {
+			s.Start = start
+		}
+		if duration > 0 {
+			s.Duration = time.Duration(duration * float64(time.Second))
+			s.HeartRate = heartRate / duration
+		}
+		if distance > 0 {
+			s.Distance = distance
+		}
+		if s.Start.IsZero() && s.Duration == 0 && s.Distance == 0 {
+			continue
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
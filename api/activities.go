@@ -0,0 +1,63 @@
+package api
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"noerkrieg.com/server/activity"
+	repository "noerkrieg.com/server/postgres_repository"
+)
+
+// maxActivitySize bounds the size of an uploaded activity file
+const maxActivitySize = 20 << 20
+
+// uploadActivity enqueues a job that parses a GPX, TCX or FIT file into
+// cardio exercises, so large files do not hold up the request
+func (h *Handler) uploadActivity(writer http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(writer, req.Body, maxActivitySize)
+	if err := req.ParseMultipartForm(maxActivitySize); err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid multipart upload")
+		return
+	}
+
+	file, header, err := req.FormFile("file")
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "no file uploaded")
+		return
+	}
+	content, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "could not read "+header.Filename)
+		return
+	}
+
+	format, ok := activity.Detect(header.Filename, content)
+	if !ok {
+		writeError(writer, http.StatusUnprocessableEntity, "file is not a GPX, TCX or FIT activity")
+		return
+	}
+
+	distanceUnit := req.FormValue("distance_unit")
+	if distanceUnit == "" {
+		distanceUnit = "miles"
+	}
+	if distanceUnit != "miles" && distanceUnit != "kilometers" {
+		writeError(writer, http.StatusBadRequest, "distance_unit must be miles or kilometers")
+		return
+	}
+
+	job, err := h.store.CreateUploadJob(userID(req), header.Filename, content, &repository.ActivityImportRequest{
+		Type:         repository.JobTypeActivity,
+		Format:       format,
+		Filename:     header.Filename,
+		DistanceUnit: distanceUnit,
+	}, repository.PriorityDefault)
+	if err != nil {
+		log.Printf("Error creating activity import job: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not create job")
+		return
+	}
+	writeJSON(writer, http.StatusAccepted, job)
+}
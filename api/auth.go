@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type contextKey string
+
+const (
+	userIDKey contextKey = "user_id"
+	adminKey  contextKey = "admin"
+)
+
+// claims are the Supabase access token claims the API uses. Admins are
+// service role tokens and users whose app metadata has the admin role.
+type claims struct {
+	jwt.RegisteredClaims
+	Role        string `json:"role"`
+	AppMetadata struct {
+		Role string `json:"role"`
+	} `json:"app_metadata"`
+}
+
+func (c *claims) admin() bool {
+	return c.Role == "service_role" || c.AppMetadata.Role == "admin"
+}
+
+// Authenticate verifies the Supabase access token in the Authorization header
+// and stores its subject as the user id on the request context
+func Authenticate(secret string) func(http.Handler) http.Handler {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"HS256"}))
+	keyFunc := func(*jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+			header := req.Header.Get("Authorization")
+			token, found := strings.CutPrefix(header, "Bearer ")
+			if !found || token == "" {
+				writeError(writer, http.StatusUnauthorized, "missing bearer token")
+				return
+			}
+
+			var claims claims
+			if _, err := parser.ParseWithClaims(token, &claims, keyFunc); err != nil {
+				writeError(writer, http.StatusUnauthorized, "invalid token")
+				return
+			}
+			if claims.Subject == "" {
+				writeError(writer, http.StatusUnauthorized, "token has no subject")
+				return
+			}
+
+			ctx := context.WithValue(req.Context(), userIDKey, claims.Subject)
+			ctx = context.WithValue(ctx, adminKey, claims.admin())
+			next.ServeHTTP(writer, req.WithContext(ctx))
+		})
+	}
+}
+
+// userID returns the authenticated user id for the request
+func userID(req *http.Request) string {
+	id, _ := req.Context().Value(userIDKey).(string)
+	return id
+}
+
+// RequireAdmin rejects requests whose token is not an admin's
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if admin, _ := req.Context().Value(adminKey).(bool); !admin {
+			writeError(writer, http.StatusForbidden, "admin access required")
+			return
+		}
+		next.ServeHTTP(writer, req)
+	})
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	repository "noerkrieg.com/server/postgres_repository"
+)
+
+// catalogTypes are the exercise types a catalog exercise may have
+var catalogTypes = []string{"", "strength", "cardio", "flexibility", "balance"}
+
+// catalogExerciseBody is the request body creating or replacing a catalog
+// exercise
+type catalogExerciseBody struct {
+	Name         string   `json:"name"`
+	Aliases      []string `json:"aliases"`
+	MuscleGroups []string `json:"muscle_groups"`
+	Equipment    []string `json:"equipment"`
+	Type         string   `json:"type"`
+}
+
+// exercise validates the body and returns the catalog exercise it describes
+func (b catalogExerciseBody) exercise() (repository.CatalogExercise, error) {
+	ex := repository.CatalogExercise{
+		Name:         strings.TrimSpace(b.Name),
+		Aliases:      cleanNames(b.Aliases),
+		MuscleGroups: cleanNames(b.MuscleGroups),
+		Equipment:    cleanNames(b.Equipment),
+		Type:         strings.ToLower(strings.TrimSpace(b.Type)),
+	}
+	if ex.Name == "" {
+		return ex, errors.New("name is required")
+	}
+	if !slices.Contains(catalogTypes, ex.Type) {
+		return ex, errors.New("type must be one of strength, cardio, flexibility or balance")
+	}
+	return ex, nil
+}
+
+func (h *Handler) listCatalogExercises(writer http.ResponseWriter, req *http.Request) {
+	exercises, err := h.store.ListCatalogExercises()
+	if err != nil {
+		log.Printf("Error listing catalog exercises: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not list catalog exercises")
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]interface{}{"exercises": exercises})
+}
+
+func (h *Handler) getCatalogExercise(writer http.ResponseWriter, req *http.Request) {
+	ex, err := h.store.GetCatalogExercise(chi.URLParam(req, "id"))
+	if err != nil {
+		log.Printf("Error loading catalog exercise: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not load catalog exercise")
+		return
+	}
+	if ex == nil {
+		writeError(writer, http.StatusNotFound, "catalog exercise not found")
+		return
+	}
+	writeJSON(writer, http.StatusOK, ex)
+}
+
+func (h *Handler) createCatalogExercise(writer http.ResponseWriter, req *http.Request) {
+	var body catalogExerciseBody
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	ex, err := body.exercise()
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := h.store.CreateCatalogExercise(ex)
+	if err != nil {
+		writeCatalogError(writer, err)
+		return
+	}
+	writeJSON(writer, http.StatusCreated, created)
+}
+
+func (h *Handler) updateCatalogExercise(writer http.ResponseWriter, req *http.Request) {
+	var body catalogExerciseBody
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	ex, err := body.exercise()
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	ex.ID = chi.URLParam(req, "id")
+
+	updated, err := h.store.UpdateCatalogExercise(ex)
+	if err != nil {
+		writeCatalogError(writer, err)
+		return
+	}
+	if updated == nil {
+		writeError(writer, http.StatusNotFound, "catalog exercise not found")
+		return
+	}
+	writeJSON(writer, http.StatusOK, updated)
+}
+
+func (h *Handler) deleteCatalogExercise(writer http.ResponseWriter, req *http.Request) {
+	found, err := h.store.DeleteCatalogExercise(chi.URLParam(req, "id"))
+	if err != nil {
+		log.Printf("Error deleting catalog exercise: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not delete catalog exercise")
+		return
+	}
+	if !found {
+		writeError(writer, http.StatusNotFound, "catalog exercise not found")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) listCatalogAttributes(writer http.ResponseWriter, req *http.Request) {
+	attributes, err := h.store.ListCatalogAttributes()
+	if err != nil {
+		log.Printf("Error listing catalog attributes: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not list catalog attributes")
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]interface{}{"attributes": attributes})
+}
+
+func (h *Handler) createCatalogAttribute(writer http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		writeError(writer, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	created, err := h.store.CreateCatalogAttribute(name)
+	if err != nil {
+		writeCatalogError(writer, err)
+		return
+	}
+	writeJSON(writer, http.StatusCreated, created)
+}
+
+func (h *Handler) deleteCatalogAttribute(writer http.ResponseWriter, req *http.Request) {
+	found, err := h.store.DeleteCatalogAttribute(chi.URLParam(req, "id"))
+	if err != nil {
+		log.Printf("Error deleting catalog attribute: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not delete catalog attribute")
+		return
+	}
+	if !found {
+		writeError(writer, http.StatusNotFound, "catalog attribute not found")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// writeCatalogError reports a failed catalog write, as a conflict when the
+// name is taken
+func writeCatalogError(writer http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrCatalogConflict) {
+		writeError(writer, http.StatusConflict, err.Error())
+		return
+	}
+	log.Printf("Error writing catalog: %v", err)
+	writeError(writer, http.StatusInternalServerError, "could not update catalog")
+}
+
+// cleanNames trims names and drops empty and duplicate ones
+func cleanNames(names []string) []string {
+	cleaned := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name != "" && !slices.ContainsFunc(cleaned, func(c string) bool { return strings.EqualFold(c, name) }) {
+			cleaned = append(cleaned, name)
+		}
+	}
+	return cleaned
+}
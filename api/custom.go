@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	repository "noerkrieg.com/server/postgres_repository"
+)
+
+// customExerciseBody is the request body creating or replacing a custom
+// exercise
+type customExerciseBody struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+// exercise validates the body and returns the custom exercise it describes
+func (b customExerciseBody) exercise() (repository.CustomExercise, error) {
+	ex := repository.CustomExercise{
+		Name:    strings.TrimSpace(b.Name),
+		Aliases: cleanNames(b.Aliases),
+	}
+	if ex.Name == "" {
+		return ex, errors.New("name is required")
+	}
+	return ex, nil
+}
+
+func (h *Handler) listCustomExercises(writer http.ResponseWriter, req *http.Request) {
+	exercises, err := h.store.ListCustomExercises(userID(req))
+	if err != nil {
+		log.Printf("Error listing custom exercises: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not list custom exercises")
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]interface{}{"exercises": exercises})
+}
+
+func (h *Handler) createCustomExercise(writer http.ResponseWriter, req *http.Request) {
+	var body customExerciseBody
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	ex, err := body.exercise()
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := h.store.CreateCustomExercise(userID(req), ex)
+	if err != nil {
+		writeCatalogError(writer, err)
+		return
+	}
+	writeJSON(writer, http.StatusCreated, created)
+}
+
+func (h *Handler) updateCustomExercise(writer http.ResponseWriter, req *http.Request) {
+	var body customExerciseBody
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	ex, err := body.exercise()
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	ex.ID = chi.URLParam(req, "id")
+
+	updated, err := h.store.UpdateCustomExercise(userID(req), ex)
+	if err != nil {
+		writeCatalogError(writer, err)
+		return
+	}
+	if updated == nil {
+		writeError(writer, http.StatusNotFound, "custom exercise not found")
+		return
+	}
+	writeJSON(writer, http.StatusOK, updated)
+}
+
+func (h *Handler) deleteCustomExercise(writer http.ResponseWriter, req *http.Request) {
+	found, err := h.store.DeleteCustomExercise(chi.URLParam(req, "id"), userID(req))
+	if err != nil {
+		log.Printf("Error deleting custom exercise: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not delete custom exercise")
+		return
+	}
+	if !found {
+		writeError(writer, http.StatusNotFound, "custom exercise not found")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) listCustomAttributes(writer http.ResponseWriter, req *http.Request) {
+	attributes, err := h.store.ListCustomAttributes(userID(req))
+	if err != nil {
+		log.Printf("Error listing custom attributes: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not list custom attributes")
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]interface{}{"attributes": attributes})
+}
+
+func (h *Handler) createCustomAttribute(writer http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		writeError(writer, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	created, err := h.store.CreateCustomAttribute(userID(req), name)
+	if err != nil {
+		writeCatalogError(writer, err)
+		return
+	}
+	writeJSON(writer, http.StatusCreated, created)
+}
+
+func (h *Handler) deleteCustomAttribute(writer http.ResponseWriter, req *http.Request) {
+	found, err := h.store.DeleteCustomAttribute(chi.URLParam(req, "id"), userID(req))
+	if err != nil {
+		log.Printf("Error deleting custom attribute: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not delete custom attribute")
+		return
+	}
+	if !found {
+		writeError(writer, http.StatusNotFound, "custom attribute not found")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
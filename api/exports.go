@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"noerkrieg.com/server/export"
+	repository "noerkrieg.com/server/postgres_repository"
+)
+
+// createExport enqueues an export of the user's workout history
+func (h *Handler) createExport(writer http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Format string `json:"format"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil && err != io.EOF {
+		writeError(writer, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if body.Format == "" {
+		body.Format = export.FormatCSV
+	}
+	if !export.Valid(body.Format) {
+		writeError(writer, http.StatusBadRequest, "format must be csv, ndjson or xlsx")
+		return
+	}
+
+	record, err := h.store.CreateExport(userID(req), body.Format)
+	if err != nil {
+		log.Printf("Error creating export: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not create export")
+		return
+	}
+	writeJSON(writer, http.StatusAccepted, record)
+}
+
+// getExport downloads a completed export, or reports its status while the
+// export job is still running
+func (h *Handler) getExport(writer http.ResponseWriter, req *http.Request) {
+	record, err := h.store.GetExport(chi.URLParam(req, "id"), userID(req))
+	if err != nil {
+		log.Printf("Error loading export: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not load export")
+		return
+	}
+	if record == nil {
+		writeError(writer, http.StatusNotFound, "export not found")
+		return
+	}
+
+	switch record.Status {
+	case repository.StatusCompleted:
+		writer.Header().Set("Content-Type", export.ContentType(record.Format))
+		writer.Header().Set("Content-Disposition",
+			`attachment; filename="`+export.Filename(record.Format, record.CreatedAt)+`"`)
+		writer.Header().Set("Content-Length", strconv.Itoa(len(record.Artifact)))
+		writer.WriteHeader(http.StatusOK)
+		writer.Write(record.Artifact)
+	case repository.StatusFailed:
+		writeJSON(writer, http.StatusConflict, record)
+	default:
+		writeJSON(writer, http.StatusAccepted, record)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"github.com/go-chi/chi/v5"
+	repository "noerkrieg.com/server/postgres_repository"
+)
+
+// Handler serves the authenticated /v1 endpoints
+type Handler struct {
+	store *repository.SupabaseStore
+}
+
+func NewHandler(store *repository.SupabaseStore) *Handler {
+	return &Handler{store: store}
+}
+
+// Routes registers the handler's endpoints on the router
+func (h *Handler) Routes(r chi.Router) {
+	r.Get("/jobs/{id}", h.getJob)
+	r.Post("/jobs/{id}/reparse", h.reparseJob)
+	r.Post("/jobs/{id}/apply", h.applyReparse)
+	r.Post("/imports", h.createImport)
+	r.Post("/imports/csv", h.createCSVImport)
+	r.Post("/activities", h.uploadActivity)
+	r.Get("/usage", h.getUsage)
+	r.Get("/preferences", h.getPreferences)
+	r.Put("/preferences", h.updatePreferences)
+	r.Post("/exports", h.createExport)
+	r.Get("/exports/{id}", h.getExport)
+	r.Get("/imports/{id}", h.getImport)
+	r.Get("/workouts", h.listWorkouts)
+	r.Get("/workouts/{id}", h.getWorkout)
+	r.Get("/catalog/exercises", h.listCatalogExercises)
+	r.Get("/catalog/exercises/{id}", h.getCatalogExercise)
+	r.Get("/catalog/attributes", h.listCatalogAttributes)
+	r.Get("/custom/exercises", h.listCustomExercises)
+	r.Post("/custom/exercises", h.createCustomExercise)
+	r.Put("/custom/exercises/{id}", h.updateCustomExercise)
+	r.Delete("/custom/exercises/{id}", h.deleteCustomExercise)
+	r.Get("/custom/attributes", h.listCustomAttributes)
+	r.Post("/custom/attributes", h.createCustomAttribute)
+	r.Delete("/custom/attributes/{id}", h.deleteCustomAttribute)
+
+	r.Group(func(r chi.Router) {
+		r.Use(RequireAdmin)
+		r.Post("/catalog/exercises", h.createCatalogExercise)
+		r.Put("/catalog/exercises/{id}", h.updateCatalogExercise)
+		r.Delete("/catalog/exercises/{id}", h.deleteCatalogExercise)
+		r.Post("/catalog/attributes", h.createCatalogAttribute)
+		r.Delete("/catalog/attributes/{id}", h.deleteCatalogAttribute)
+		r.Get("/catalog/proposals", h.listCatalogProposals)
+		r.Post("/catalog/proposals/{id}/approve", h.approveCatalogProposal)
+		r.Post("/catalog/proposals/{id}/reject", h.rejectCatalogProposal)
+	})
+}
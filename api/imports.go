@@ -0,0 +1,179 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"noerkrieg.com/server/importer"
+	repository "noerkrieg.com/server/postgres_repository"
+)
+
+const (
+	// maxImportSize bounds the total size of a notes upload
+	maxImportSize = 10 << 20
+	// maxImportEntries bounds the number of jobs a single import can enqueue
+	maxImportEntries = 5000
+)
+
+// skippedFile reports the undated text of an uploaded file that was not imported
+type skippedFile struct {
+	File string `json:"file"`
+	Text string `json:"text"`
+}
+
+// createImport splits uploaded plain-text or markdown notes into dated
+// entries and enqueues one low priority job per entry
+func (h *Handler) createImport(writer http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(writer, req.Body, maxImportSize)
+	if err := req.ParseMultipartForm(maxImportSize); err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid multipart upload")
+		return
+	}
+
+	loc := time.UTC
+	if tz := req.FormValue("timezone"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			writeError(writer, http.StatusBadRequest, "unknown timezone "+tz)
+			return
+		}
+	}
+
+	files := req.MultipartForm.File["files"]
+	if len(files) == 0 {
+		writeError(writer, http.StatusBadRequest, "no files uploaded")
+		return
+	}
+
+	entries := make([]importer.Entry, 0)
+	skipped := make([]skippedFile, 0)
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "could not read "+header.Filename)
+			return
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil || !utf8.Valid(content) {
+			writeError(writer, http.StatusBadRequest, header.Filename+" is not a text file")
+			return
+		}
+
+		found, rest := importer.SplitNotes(header.Filename, string(content), loc)
+		entries = append(entries, found...)
+		if rest != "" {
+			skipped = append(skipped, skippedFile{File: header.Filename, Text: rest})
+		}
+	}
+
+	if len(entries) == 0 {
+		writeError(writer, http.StatusUnprocessableEntity, "no dated entries found")
+		return
+	}
+	if len(entries) > maxImportEntries {
+		writeError(writer, http.StatusRequestEntityTooLarge, "too many entries in upload")
+		return
+	}
+
+	if !h.checkBudget(writer, userID(req)) {
+		return
+	}
+
+	record, err := h.store.CreateImport(userID(req), entries, loc.String())
+	if err != nil {
+		log.Printf("Error creating import: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not create import")
+		return
+	}
+
+	writeJSON(writer, http.StatusAccepted, map[string]interface{}{
+		"import":  record,
+		"skipped": skipped,
+	})
+}
+
+func (h *Handler) getImport(writer http.ResponseWriter, req *http.Request) {
+	record, err := h.store.GetImport(chi.URLParam(req, "id"), userID(req))
+	if err != nil {
+		log.Printf("Error loading import: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not load import")
+		return
+	}
+	if record == nil {
+		writeError(writer, http.StatusNotFound, "import not found")
+		return
+	}
+	writeJSON(writer, http.StatusOK, record)
+}
+
+// createCSVImport enqueues a job that imports a Strong, Hevy or FitNotes CSV
+// export directly, without the LLM
+func (h *Handler) createCSVImport(writer http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(writer, req.Body, maxImportSize)
+	if err := req.ParseMultipartForm(maxImportSize); err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid multipart upload")
+		return
+	}
+
+	file, header, err := req.FormFile("file")
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "no file uploaded")
+		return
+	}
+	content, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || !utf8.Valid(content) {
+		writeError(writer, http.StatusBadRequest, header.Filename+" is not a text file")
+		return
+	}
+
+	columns, err := importer.ReadHeader(bytes.NewReader(content))
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "could not read CSV header")
+		return
+	}
+	detected, ok := importer.DetectSource(columns)
+	source := req.FormValue("source")
+	if source == "" {
+		if !ok {
+			writeError(writer, http.StatusUnprocessableEntity, "unrecognized CSV export format")
+			return
+		}
+		source = detected
+	} else if ok && source != detected {
+		writeError(writer, http.StatusUnprocessableEntity, "file looks like a "+detected+" export, not "+source)
+		return
+	}
+
+	weightUnit := req.FormValue("weight_unit")
+	if weightUnit != "" && weightUnit != "pounds" && weightUnit != "kilograms" {
+		writeError(writer, http.StatusBadRequest, "weight_unit must be pounds or kilograms")
+		return
+	}
+	timezone := req.FormValue("timezone")
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			writeError(writer, http.StatusBadRequest, "unknown timezone "+timezone)
+			return
+		}
+	}
+
+	job, err := h.store.CreateUploadJob(userID(req), header.Filename, content, &repository.CSVImportRequest{
+		Type:       repository.JobTypeCSVImport,
+		Source:     source,
+		WeightUnit: weightUnit,
+		Timezone:   timezone,
+	}, repository.PriorityLow)
+	if err != nil {
+		log.Printf("Error creating csv import job: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not create job")
+		return
+	}
+	writeJSON(writer, http.StatusAccepted, job)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	repository "noerkrieg.com/server/postgres_repository"
+)
+
+func (h *Handler) getJob(writer http.ResponseWriter, req *http.Request) {
+	system, err := h.unitSystem(req)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	job, err := h.store.GetJob(chi.URLParam(req, "id"), userID(req))
+	if err != nil {
+		log.Printf("Error loading job: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not load job")
+		return
+	}
+	if job == nil {
+		writeError(writer, http.StatusNotFound, "job not found")
+		return
+	}
+	displayJob(job, system)
+	writeJSON(writer, http.StatusOK, job)
+}
+
+// reparseJob enqueues a reparse of a completed message job. With apply set
+// the new extraction replaces the stored exercises, otherwise the job result
+// only holds the diff until it is confirmed through applyReparse.
+func (h *Handler) reparseJob(writer http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Apply bool `json:"apply"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil && err != io.EOF {
+		writeError(writer, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	source, err := h.store.GetJob(chi.URLParam(req, "id"), userID(req))
+	if err != nil {
+		log.Printf("Error loading job: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not load job")
+		return
+	}
+	if source == nil {
+		writeError(writer, http.StatusNotFound, "job not found")
+		return
+	}
+	if source.Status != repository.StatusCompleted {
+		writeError(writer, http.StatusConflict, "only completed jobs can be reparsed")
+		return
+	}
+	if !repository.IsMessageJob(source) {
+		writeError(writer, http.StatusConflict, "only message jobs can be reparsed")
+		return
+	}
+
+	if !h.checkBudget(writer, source.UserID) {
+		return
+	}
+
+	job, err := h.store.CreateJob(source.UserID, repository.ReparseRequest{
+		Type:  repository.JobTypeReparse,
+		JobID: source.ID,
+		Apply: body.Apply,
+	}, repository.PriorityDefault)
+	if err != nil {
+		log.Printf("Error creating reparse job: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not create job")
+		return
+	}
+	writeJSON(writer, http.StatusAccepted, job)
+}
+
+// applyReparse confirms the diff held by a completed reparse job
+func (h *Handler) applyReparse(writer http.ResponseWriter, req *http.Request) {
+	system, err := h.unitSystem(req)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	job, err := h.store.ApplyReparse(chi.URLParam(req, "id"), userID(req))
+	if err != nil {
+		writeReparseError(writer, err)
+		return
+	}
+	if job == nil {
+		writeError(writer, http.StatusNotFound, "job not found")
+		return
+	}
+	displayJob(job, system)
+	writeJSON(writer, http.StatusOK, job)
+}
+
+// writeReparseError reports a failed reparse application, as a conflict when
+// the reparse job can't be applied
+func writeReparseError(writer http.ResponseWriter, err error) {
+	for _, conflict := range []error{repository.ErrNotReparseJob, repository.ErrReparseNotCompleted,
+		repository.ErrReparseApplied, repository.ErrReparseStale} {
+		if errors.Is(err, conflict) {
+			writeError(writer, http.StatusConflict, conflict.Error())
+			return
+		}
+	}
+	log.Printf("Error applying reparse: %v", err)
+	writeError(writer, http.StatusInternalServerError, "could not apply reparse")
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	repository "noerkrieg.com/server/postgres_repository"
+	"noerkrieg.com/server/units"
+)
+
+func (h *Handler) getPreferences(writer http.ResponseWriter, req *http.Request) {
+	prefs, err := h.store.GetPreferences(req.Context(), userID(req))
+	if err != nil {
+		log.Printf("Error loading preferences: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not load preferences")
+		return
+	}
+	writeJSON(writer, http.StatusOK, prefs)
+}
+
+func (h *Handler) updatePreferences(writer http.ResponseWriter, req *http.Request) {
+	var body repository.Preferences
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	body.UnitSystem = strings.ToLower(strings.TrimSpace(body.UnitSystem))
+	if !units.Valid(body.UnitSystem) {
+		writeError(writer, http.StatusBadRequest, "unit_system must be metric, imperial or empty")
+		return
+	}
+
+	prefs, err := h.store.SetPreferences(req.Context(), userID(req), body)
+	if err != nil {
+		log.Printf("Error storing preferences: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not store preferences")
+		return
+	}
+	writeJSON(writer, http.StatusOK, prefs)
+}
+
+// unitSystem returns the unit system exercises are returned in: the units
+// query parameter when it is set, and the user's preference otherwise
+func (h *Handler) unitSystem(req *http.Request) (string, error) {
+	if system := req.URL.Query().Get("units"); system != "" {
+		if system == "logged" {
+			return units.AsLogged, nil
+		}
+		if !units.Valid(system) {
+			return "", errors.New("units must be metric, imperial or logged")
+		}
+		return system, nil
+	}
+	prefs, err := h.store.GetPreferences(req.Context(), userID(req))
+	if err != nil {
+		log.Printf("Reading exercises as logged: %v", err)
+		return units.AsLogged, nil
+	}
+	return prefs.UnitSystem, nil
+}
+
+// displayWorkout converts the exercises of a workout to the unit system
+func displayWorkout(workout *repository.Workout, system string) {
+	for _, group := range workout.Groups {
+		for i, ex := range group.Exercises {
+			group.Exercises[i] = units.Display(ex, system)
+		}
+	}
+}
+
+// displayJob converts the exercises in a job's result to the unit system,
+// leaving them in SI units when the result can't be converted
+func displayJob(job *repository.Job, system string) {
+	if err := repository.DisplayJob(job, system); err != nil {
+		log.Printf("Returning job %s in SI units: %v", job.ID, err)
+	}
+}
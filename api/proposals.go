@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	repository "noerkrieg.com/server/postgres_repository"
+)
+
+const (
+	defaultProposalLimit = 50
+	maxProposalLimit     = 200
+)
+
+// listCatalogProposals lists catalog proposals, pending ones unless the status
+// parameter asks for approved or rejected ones, optionally of one kind
+func (h *Handler) listCatalogProposals(writer http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	status := query.Get("status")
+	if status == "" {
+		status = repository.ProposalPending
+	}
+	if !slices.Contains([]string{repository.ProposalPending, repository.ProposalApproved, repository.ProposalRejected}, status) {
+		writeError(writer, http.StatusBadRequest, "status must be pending, approved or rejected")
+		return
+	}
+	kind := query.Get("kind")
+	if !slices.Contains([]string{"", repository.ProposalKindExercise, repository.ProposalKindAttribute}, kind) {
+		writeError(writer, http.StatusBadRequest, "kind must be exercise or attribute")
+		return
+	}
+
+	limit := defaultProposalLimit
+	if limitParam := query.Get("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxProposalLimit {
+			writeError(writer, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxProposalLimit))
+			return
+		}
+	}
+
+	proposals, err := h.store.ListCatalogProposals(status, kind, limit)
+	if err != nil {
+		log.Printf("Error listing catalog proposals: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not list catalog proposals")
+		return
+	}
+	writeJSON(writer, http.StatusOK, map[string]interface{}{"proposals": proposals})
+}
+
+// approveCatalogProposal applies a proposal to the catalog. The optional body
+// overrides the proposed action, name or target exercise.
+func (h *Handler) approveCatalogProposal(writer http.ResponseWriter, req *http.Request) {
+	var decision repository.ProposalDecision
+	if err := json.NewDecoder(req.Body).Decode(&decision); err != nil && err != io.EOF {
+		writeError(writer, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	decision.Action = strings.ToLower(strings.TrimSpace(decision.Action))
+	decision.Name = strings.TrimSpace(decision.Name)
+	decision.TargetName = strings.TrimSpace(decision.TargetName)
+	if !slices.Contains([]string{"", repository.ProposalActionAlias, repository.ProposalActionNew}, decision.Action) {
+		writeError(writer, http.StatusBadRequest, "action must be alias or new")
+		return
+	}
+
+	approved, err := h.store.ApproveCatalogProposal(chi.URLParam(req, "id"), decision)
+	if err != nil {
+		writeProposalError(writer, err)
+		return
+	}
+	if approved == nil {
+		writeError(writer, http.StatusNotFound, "catalog proposal not found")
+		return
+	}
+	writeJSON(writer, http.StatusOK, approved)
+}
+
+// rejectCatalogProposal rejects a proposal, so its names are not proposed again
+func (h *Handler) rejectCatalogProposal(writer http.ResponseWriter, req *http.Request) {
+	rejected, err := h.store.RejectCatalogProposal(chi.URLParam(req, "id"))
+	if err != nil {
+		writeProposalError(writer, err)
+		return
+	}
+	if rejected == nil {
+		writeError(writer, http.StatusNotFound, "catalog proposal not found")
+		return
+	}
+	writeJSON(writer, http.StatusOK, rejected)
+}
+
+// writeProposalError reports a failed proposal decision
+func writeProposalError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrProposalDecided):
+		writeError(writer, http.StatusConflict, err.Error())
+	case errors.Is(err, repository.ErrProposalTarget), errors.Is(err, repository.ErrProposalAction):
+		writeError(writer, http.StatusUnprocessableEntity, err.Error())
+	default:
+		writeCatalogError(writer, err)
+	}
+}
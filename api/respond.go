@@ -0,0 +1,21 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// writeJSON writes body as a JSON response with the given status
+func writeJSON(writer http.ResponseWriter, status int, body interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if err := json.NewEncoder(writer).Encode(body); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// writeError writes a JSON error response with the given status
+func writeError(writer http.ResponseWriter, status int, message string) {
+	writeJSON(writer, status, map[string]string{"error": message})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	repository "noerkrieg.com/server/postgres_repository"
+)
+
+// usageDays is the number of days of history returned by getUsage
+const usageDays = 31
+
+// getUsage reports the user's LLM spend this month and per day
+func (h *Handler) getUsage(writer http.ResponseWriter, req *http.Request) {
+	spent, err := h.store.MonthlySpend(userID(req))
+	if err != nil {
+		log.Printf("Error loading monthly spend: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not load usage")
+		return
+	}
+	days, err := h.store.DailyUsage(userID(req), usageDays)
+	if err != nil {
+		log.Printf("Error loading daily usage: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not load usage")
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, map[string]interface{}{
+		"month_to_date_usd":  spent,
+		"monthly_budget_usd": h.store.MonthlyBudgetUSD,
+		"days":               days,
+	})
+}
+
+// checkBudget rejects the request when the user has spent their monthly LLM
+// budget, so jobs that would call the LLM fail before they are enqueued
+func (h *Handler) checkBudget(writer http.ResponseWriter, user string) bool {
+	err := h.store.CheckBudget(user)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, repository.ErrBudgetExceeded) {
+		writeError(writer, http.StatusTooManyRequests, err.Error())
+	} else {
+		log.Printf("Error checking budget: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not check budget")
+	}
+	return false
+}
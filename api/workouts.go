@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// defaultWorkoutLimit is the number of workouts listed unless the
+	// request asks for fewer or more
+	defaultWorkoutLimit = 20
+	maxWorkoutLimit     = 100
+)
+
+// listWorkouts lists the user's workouts with their exercises, most recent
+// first. The optional from and to parameters bound when they started, as
+// RFC 3339 timestamps or dates. Exercises are in the user's preferred units
+// unless the units parameter asks for others.
+func (h *Handler) listWorkouts(writer http.ResponseWriter, req *http.Request) {
+	system, err := h.unitSystem(req)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	from, err := timeParam(req, "from", time.Time{})
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := timeParam(req, "to", time.Now().Add(24*time.Hour))
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := defaultWorkoutLimit
+	if limitParam := req.URL.Query().Get("limit"); limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxWorkoutLimit {
+			writeError(writer, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxWorkoutLimit))
+			return
+		}
+	}
+
+	workouts, err := h.store.ListWorkouts(userID(req), from, to, limit)
+	if err != nil {
+		log.Printf("Error listing workouts: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not list workouts")
+		return
+	}
+	for i := range workouts {
+		displayWorkout(&workouts[i], system)
+	}
+	writeJSON(writer, http.StatusOK, map[string]interface{}{
+		"workouts": workouts,
+	})
+}
+
+func (h *Handler) getWorkout(writer http.ResponseWriter, req *http.Request) {
+	system, err := h.unitSystem(req)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	workout, err := h.store.GetWorkout(chi.URLParam(req, "id"), userID(req))
+	if err != nil {
+		log.Printf("Error loading workout: %v", err)
+		writeError(writer, http.StatusInternalServerError, "could not load workout")
+		return
+	}
+	if workout == nil {
+		writeError(writer, http.StatusNotFound, "workout not found")
+		return
+	}
+	displayWorkout(workout, system)
+	writeJSON(writer, http.StatusOK, workout)
+}
+
+// timeParam parses a query parameter holding an RFC 3339 timestamp or a date,
+// returning fallback when it is absent
+func timeParam(req *http.Request, name string, fallback time.Time) (time.Time, error) {
+	value := req.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", name)
+	}
+	return t, nil
+}
@@ -0,0 +1,209 @@
+// Command eval runs a labeled dataset of messages through an extractor and
+// reports how closely the extracted exercises match the labels.
+//
+// The dataset is JSON lines, one case per line:
+//
+//	{"message": "...", "expected": [{"exercise_name": "...", ...}], "response": "...", "now": "..."}
+//
+// response is an optional recorded model completion, replayed by
+// -extractor=recorded so prompt parsing can be evaluated offline. Full
+// prompts can be replayed offline with -extractor=openai -cassette dir.
+// now is an optional RFC 3339 time the message was sent, defaulting to -now,
+// and -catalog is a JSON file of the known exercises, attributes and aliases
+// the prompts are built with. Both are fixed so recorded prompts replay.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	llm "noerkrieg.com/server/llm"
+	"noerkrieg.com/server/redis_repository"
+)
+
+// Case is one labeled message
+type Case struct {
+	Message  string         `json:"message"`
+	Expected []llm.Exercise `json:"expected"`
+	Response string         `json:"response,omitempty"`
+	Now      *time.Time     `json:"now,omitempty"`
+}
+
+// fileCatalog is a catalog loaded once from a file
+type fileCatalog struct {
+	known *redis_repository.ExerciseContext
+}
+
+func (c fileCatalog) Context() *redis_repository.ExerciseContext {
+	return c.known
+}
+
+// recordedExtractor replays the completion recorded with each case
+type recordedExtractor struct {
+	responses map[string]string
+}
+
+func (r *recordedExtractor) Extract(ctx context.Context, req llm.Request) (*llm.Result, error) {
+	result := &llm.Result{PromptVersion: "recorded"}
+	completion, ok := r.responses[req.Message]
+	if !ok {
+		return result, fmt.Errorf("no recorded response for %q", req.Message)
+	}
+	var err error
+	result.Exercises, err = llm.ParseCompletion(completion)
+	return result, err
+}
+
+func main() {
+	dataset := flag.String("dataset", "", "path to the labeled JSON lines dataset")
+	extractorName := flag.String("extractor", "recorded", "extractor to evaluate: recorded or openai")
+	cassetteDir := flag.String("cassette", "", "cassette directory for the openai extractor")
+	cassetteMode := flag.String("cassette-mode", llm.CassetteReplay, "cassette mode: record or replay")
+	promptDir := flag.String("prompt-dir", "", "directory of prompt templates overriding the embedded ones")
+	promptVersion := flag.String("prompt", "", "prompt version to evaluate")
+	catalogPath := flag.String("catalog", "", "JSON file of the exercise catalog prompts are built with")
+	nowFlag := flag.String("now", "2026-03-02T18:30:00Z", "RFC 3339 time messages are sent at, unless a case sets its own")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	verbose := flag.Bool("v", false, "print each case's extraction")
+	flag.Parse()
+
+	if *dataset == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cases, err := loadDataset(*dataset)
+	if err != nil {
+		log.Fatalf("Could not load dataset: %v", err)
+	}
+	if err := llm.ConfigurePrompts(*promptDir, *promptVersion, "", 0); err != nil {
+		log.Fatalf("Could not configure prompts: %v", err)
+	}
+	now, err := time.Parse(time.RFC3339, *nowFlag)
+	if err != nil {
+		log.Fatalf("Invalid -now: %v", err)
+	}
+	if *catalogPath != "" {
+		catalog, err := loadCatalog(*catalogPath)
+		if err != nil {
+			log.Fatalf("Could not load catalog: %v", err)
+		}
+		llm.UseCatalog(catalog)
+	}
+
+	var extractor llm.Extractor
+	switch *extractorName {
+	case "recorded":
+		recorded := &recordedExtractor{responses: map[string]string{}}
+		for _, c := range cases {
+			recorded.responses[c.Message] = c.Response
+		}
+		extractor = recorded
+	case "openai":
+		mode := ""
+		if *cassetteDir != "" {
+			mode = *cassetteMode
+		}
+		if extractor, err = llm.NewExtractor(mode, *cassetteDir); err != nil {
+			log.Fatalf("Could not create OpenAI extractor: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown extractor %q", *extractorName)
+	}
+
+	report := newReport()
+	ctx := context.Background()
+	for i, c := range cases {
+		sentAt := now
+		if c.Now != nil {
+			sentAt = *c.Now
+		}
+		result, err := extractor.Extract(ctx, llm.Request{Message: c.Message, Key: fmt.Sprint(i), Now: sentAt})
+		if result != nil && result.Usage != nil {
+			report.CostUSD += result.Usage.CostUSD
+		}
+		if err != nil {
+			log.Printf("Case %d failed: %v", i+1, err)
+			report.Errors++
+			report.Score(c.Expected, nil)
+			continue
+		}
+		if *verbose {
+			got, _ := json.Marshal(result.Exercises)
+			log.Printf("Case %d: %s\n  got: %s", i+1, c.Message, got)
+		}
+		report.Score(c.Expected, result.Exercises)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+		return
+	}
+	printReport(report)
+}
+
+func loadDataset(path string) ([]Case, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cases := make([]Case, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1<<20), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var c Case
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		cases = append(cases, c)
+	}
+	return cases, scanner.Err()
+}
+
+func loadCatalog(path string) (fileCatalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileCatalog{}, err
+	}
+	var known redis_repository.ExerciseContext
+	if err := json.Unmarshal(data, &known); err != nil {
+		return fileCatalog{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return fileCatalog{known: &known}, nil
+}
+
+func printReport(r *Report) {
+	fmt.Printf("Cases: %d (%d errors), cost $%.4f\n\n", r.Cases, r.Errors, r.CostUSD)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FIELD\tPRECISION\tRECALL\tCORRECT\tPREDICTED\tEXPECTED")
+	fmt.Fprintf(w, "exercises\t%.3f\t%.3f\t%d\t%d\t%d\n", r.Exercises.Precision(), r.Exercises.Recall(),
+		r.Exercises.Correct, r.Exercises.Predicted, r.Exercises.Expected)
+	for _, f := range fields {
+		c := r.Fields[f.name]
+		fmt.Fprintf(w, "%s\t%.3f\t%.3f\t%d\t%d\t%d\n", f.name, c.Precision(), c.Recall(),
+			c.Correct, c.Predicted, c.Expected)
+	}
+	w.Flush()
+
+	a := r.Attributes
+	fmt.Printf("\nAttributes: precision %.3f, recall %.3f, false positive rate %.3f (%d of %d cases had a false positive)\n",
+		ratio(a.TruePositives, a.TruePositives+a.FalsePositives),
+		ratio(a.TruePositives, a.TruePositives+a.FalseNegatives),
+		r.AttributeFalsePositiveRate(), a.CasesWithFalsePositive, r.Cases)
+	fmt.Printf("Unit normalization accuracy: %.3f (%d of %d)\n", r.UnitAccuracy(), r.Units.Correct, r.Units.Scored)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	llm "noerkrieg.com/server/llm"
+)
+
+// field reads one extracted field, reporting whether it has a value
+type field struct {
+	name  string
+	value func(llm.Exercise) (string, bool)
+	// unit fields are also scored for normalization to the canonical spelling
+	unit bool
+}
+
+var fields = []field{
+	{name: "exercise_name", value: func(e llm.Exercise) (string, bool) { return text(e.Exercise) }},
+	{name: "type", value: func(e llm.Exercise) (string, bool) { return text(strings.ToLower(e.Type)) }},
+	{name: "sets", value: func(e llm.Exercise) (string, bool) { return number(e.Sets) }},
+	{name: "work", value: func(e llm.Exercise) (string, bool) { return number(e.Quantity) }},
+	{name: "work_type", value: func(e llm.Exercise) (string, bool) { return text(e.QuantityType) }, unit: true},
+	{name: "resistance", value: func(e llm.Exercise) (string, bool) { return number(e.Resistance) }},
+	{name: "resistance_type", value: func(e llm.Exercise) (string, bool) { return text(e.ResistanceType) }, unit: true},
+	{name: "duration", value: func(e llm.Exercise) (string, bool) { return number(e.Duration) }},
+}
+
+func text(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	return s, s != ""
+}
+
+func number(n float64) (string, bool) {
+	return strconv.FormatFloat(math.Round(n*1000)/1000, 'f', -1, 64), n != 0
+}
+
+// counts accumulates precision and recall for one field
+type counts struct {
+	Predicted int `json:"predicted"`
+	Expected  int `json:"expected"`
+	Correct   int `json:"correct"`
+}
+
+func (c counts) Precision() float64 { return ratio(c.Correct, c.Predicted) }
+func (c counts) Recall() float64    { return ratio(c.Correct, c.Expected) }
+
+// Report is the outcome of an evaluation run
+type Report struct {
+	Cases     int                `json:"cases"`
+	Errors    int                `json:"errors"`
+	CostUSD   float64            `json:"cost_usd"`
+	Exercises counts             `json:"exercises"`
+	Fields    map[string]*counts `json:"fields"`
+
+	Attributes struct {
+		TruePositives  int `json:"true_positives"`
+		FalsePositives int `json:"false_positives"`
+		FalseNegatives int `json:"false_negatives"`
+		// CasesWithFalsePositive counts messages that got any unrelated attribute
+		CasesWithFalsePositive int `json:"cases_with_false_positive"`
+	} `json:"attributes"`
+
+	Units struct {
+		Scored  int `json:"scored"`
+		Correct int `json:"correct"`
+	} `json:"units"`
+}
+
+func newReport() *Report {
+	r := &Report{Fields: map[string]*counts{}}
+	for _, f := range fields {
+		r.Fields[f.name] = &counts{}
+	}
+	return r
+}
+
+// Score adds one labeled case to the report
+func (r *Report) Score(expected []llm.Exercise, predicted []llm.Exercise) {
+	r.Cases++
+	r.Exercises.Expected += len(expected)
+	r.Exercises.Predicted += len(predicted)
+
+	falsePositive := false
+	pairs, unmatchedPredicted, unmatchedExpected := pair(expected, predicted)
+	for _, p := range pairs {
+		r.Exercises.Correct++
+		r.scoreFields(&p.expected, &p.predicted)
+		if r.scoreAttributes(p.expected.Attributes, p.predicted.Attributes) {
+			falsePositive = true
+		}
+	}
+	for _, ex := range unmatchedPredicted {
+		r.scoreFields(nil, &ex)
+		if r.scoreAttributes(nil, ex.Attributes) {
+			falsePositive = true
+		}
+	}
+	for _, ex := range unmatchedExpected {
+		r.scoreFields(&ex, nil)
+		r.scoreAttributes(ex.Attributes, nil)
+	}
+	if falsePositive {
+		r.Attributes.CasesWithFalsePositive++
+	}
+}
+
+func (r *Report) scoreFields(expected *llm.Exercise, predicted *llm.Exercise) {
+	for _, f := range fields {
+		c := r.Fields[f.name]
+		var want, got string
+		var hasWant, hasGot bool
+		if expected != nil {
+			want, hasWant = f.value(*expected)
+		}
+		if predicted != nil {
+			got, hasGot = f.value(*predicted)
+		}
+		if hasWant {
+			c.Expected++
+		}
+		if hasGot {
+			c.Predicted++
+		}
+		if hasWant && hasGot && want == got {
+			c.Correct++
+		}
+		if f.unit && hasWant && predicted != nil {
+			r.Units.Scored++
+			if want == got {
+				r.Units.Correct++
+			}
+		}
+	}
+}
+
+// scoreAttributes counts attribute matches and reports whether any predicted
+// attribute was unrelated
+func (r *Report) scoreAttributes(expected []string, predicted []string) bool {
+	want := make(map[string]bool, len(expected))
+	for _, a := range expected {
+		want[strings.ToLower(strings.TrimSpace(a))] = true
+	}
+	falsePositive := false
+	for _, a := range predicted {
+		key := strings.ToLower(strings.TrimSpace(a))
+		if want[key] {
+			r.Attributes.TruePositives++
+			delete(want, key)
+		} else {
+			r.Attributes.FalsePositives++
+			falsePositive = true
+		}
+	}
+	r.Attributes.FalseNegatives += len(want)
+	return falsePositive
+}
+
+// AttributeFalsePositiveRate is the share of predicted attributes that were
+// not expected
+func (r *Report) AttributeFalsePositiveRate() float64 {
+	return ratio(r.Attributes.FalsePositives, r.Attributes.TruePositives+r.Attributes.FalsePositives)
+}
+
+// UnitAccuracy is the share of expected units produced with the exact
+// canonical spelling
+func (r *Report) UnitAccuracy() float64 {
+	return ratio(r.Units.Correct, r.Units.Scored)
+}
+
+type match struct {
+	expected  llm.Exercise
+	predicted llm.Exercise
+}
+
+// pair matches predicted to expected exercises by loosely normalized name,
+// so a near-miss name is scored as a wrong exercise_name rather than as a
+// missing exercise with every field wrong
+func pair(expected []llm.Exercise, predicted []llm.Exercise) ([]match, []llm.Exercise, []llm.Exercise) {
+	used := make([]bool, len(predicted))
+	pairs := make([]match, 0)
+	unmatched := make([]llm.Exercise, 0)
+	for _, e := range expected {
+		found := -1
+		for i, p := range predicted {
+			if !used[i] && looseName(p.Exercise) == looseName(e.Exercise) {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			unmatched = append(unmatched, e)
+			continue
+		}
+		used[found] = true
+		pairs = append(pairs, match{expected: e, predicted: predicted[found]})
+	}
+
+	extra := make([]llm.Exercise, 0)
+	for i, p := range predicted {
+		if !used[i] {
+			extra = append(extra, p)
+		}
+	}
+	return pairs, extra, unmatched
+}
+
+// looseName lower-cases a name and strips plural endings from each word
+func looseName(name string) string {
+	words := strings.Fields(strings.ToLower(name))
+	for i, w := range words {
+		w = strings.TrimSuffix(w, "es")
+		words[i] = strings.TrimSuffix(w, "s")
+	}
+	return strings.Join(words, " ")
+}
+
+func ratio(a int, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
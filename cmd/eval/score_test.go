@@ -0,0 +1,113 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	llm "noerkrieg.com/server/llm"
+)
+
+func TestPair(t *testing.T) {
+	tests := []struct {
+		name      string
+		expected  []string
+		predicted []string
+		pairs     []string
+		extra     []string
+		missing   []string
+	}{
+		{name: "exact names", expected: []string{"Bench Presses", "Curls"}, predicted: []string{"Curls", "Bench Presses"},
+			pairs: []string{"Bench Presses", "Curls"}},
+		{name: "plural and case", expected: []string{"Pull Ups"}, predicted: []string{"pull up"}, pairs: []string{"Pull Ups"}},
+		{name: "extra prediction", expected: []string{"Runs"}, predicted: []string{"Runs", "Walks"},
+			pairs: []string{"Runs"}, extra: []string{"Walks"}},
+		{name: "missed exercise", expected: []string{"Runs", "Rows"}, predicted: []string{"Runs"},
+			pairs: []string{"Runs"}, missing: []string{"Rows"}},
+		{name: "each prediction pairs once", expected: []string{"Curls", "Curls"}, predicted: []string{"Curl"},
+			pairs: []string{"Curls"}, missing: []string{"Curls"}},
+		{name: "nothing predicted", expected: []string{"Runs"}, missing: []string{"Runs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pairs, extra, missing := pair(exercises(tt.expected...), exercises(tt.predicted...))
+			got := make([]string, len(pairs))
+			for i, p := range pairs {
+				got[i] = p.expected.Exercise
+			}
+			if !slices.Equal(got, tt.pairs) {
+				t.Errorf("pairs = %v, want %v", got, tt.pairs)
+			}
+			if got := names(extra); !slices.Equal(got, tt.extra) {
+				t.Errorf("extra = %v, want %v", got, tt.extra)
+			}
+			if got := names(missing); !slices.Equal(got, tt.missing) {
+				t.Errorf("missing = %v, want %v", got, tt.missing)
+			}
+		})
+	}
+}
+
+func TestReportScore(t *testing.T) {
+	expected := []llm.Exercise{
+		{Exercise: "Bench Presses", Sets: 3, Quantity: 5, QuantityType: "repetitions", Resistance: 185, ResistanceType: "pounds",
+			Attributes: []string{"Paused"}},
+		{Exercise: "Runs", Quantity: 3, QuantityType: "miles", Attributes: []string{"Treadmill"}},
+	}
+	predicted := []llm.Exercise{
+		{Exercise: "Bench Press", Sets: 3, Quantity: 5, QuantityType: "repetitions", Resistance: 185, ResistanceType: "lbs",
+			Attributes: []string{"paused", "Incline"}},
+		{Exercise: "Walks", Quantity: 1, QuantityType: "miles"},
+	}
+
+	r := newReport()
+	r.Score(expected, predicted)
+	r.Score(expected[:1], nil)
+
+	if r.Cases != 2 {
+		t.Errorf("cases = %d, want 2", r.Cases)
+	}
+	if want := (counts{Predicted: 2, Expected: 3, Correct: 1}); r.Exercises != want {
+		t.Errorf("exercises = %+v, want %+v", r.Exercises, want)
+	}
+	fieldTests := map[string]counts{
+		"exercise_name":   {Predicted: 2, Expected: 3, Correct: 0},
+		"sets":            {Predicted: 1, Expected: 2, Correct: 1},
+		"work_type":       {Predicted: 2, Expected: 3, Correct: 1},
+		"resistance_type": {Predicted: 1, Expected: 2, Correct: 0},
+		"duration":        {},
+	}
+	for name, want := range fieldTests {
+		if got := *r.Fields[name]; got != want {
+			t.Errorf("%s = %+v, want %+v", name, got, want)
+		}
+	}
+
+	a := r.Attributes
+	if a.TruePositives != 1 || a.FalsePositives != 1 || a.FalseNegatives != 2 || a.CasesWithFalsePositive != 1 {
+		t.Errorf("attributes = %+v, want 1 true positive, 1 false positive, 2 false negatives in 1 case", a)
+	}
+	if got := r.AttributeFalsePositiveRate(); got != 0.5 {
+		t.Errorf("attribute false positive rate = %v, want 0.5", got)
+	}
+	// Units are scored where an exercise was predicted for the expected one:
+	// the paired bench press, but not the unpaired run or the second case
+	if r.Units.Scored != 2 || r.Units.Correct != 1 {
+		t.Errorf("units = %+v, want 1 of 2 correct", r.Units)
+	}
+}
+
+func exercises(names ...string) []llm.Exercise {
+	out := make([]llm.Exercise, len(names))
+	for i, name := range names {
+		out[i] = llm.Exercise{Exercise: name}
+	}
+	return out
+}
+
+func names(exercises []llm.Exercise) []string {
+	out := make([]string, len(exercises))
+	for i, ex := range exercises {
+		out[i] = ex.Exercise
+	}
+	return out
+}
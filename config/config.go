@@ -0,0 +1,421 @@
+// Package config loads the server configuration from the environment and an
+// optional file, validates it and reports the effective settings.
+//
+// Every setting is named by its environment variable. The file is a JSON
+// object keyed by the same names, such as {"PORT": 3000, "REDIS_ADDR":
+// ["redis-1:6379", "redis-2:6379"]}, and the environment overrides it.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	llm "noerkrieg.com/server/llm"
+	repository "noerkrieg.com/server/postgres_repository"
+	"noerkrieg.com/server/redis_repository"
+)
+
+// FileEnv names the environment variable holding the path of the
+// configuration file, when none is passed to Load
+const FileEnv = "BPYP_CONFIG_FILE"
+
+// Process modes. An API process serves the HTTP API without claiming jobs, a
+// worker process claims jobs and serves only its health and metrics, and an
+// all process does both.
+const (
+	ModeAPI    = "api"
+	ModeWorker = "worker"
+	ModeAll    = "all"
+)
+
+// Config is the configuration of the server
+type Config struct {
+	Mode string
+	Port string
+
+	// DatabaseURL is the Postgres session connection string
+	DatabaseURL string
+	// JWTSecret verifies the tokens authenticating API requests
+	JWTSecret string
+	// DBMaxConns caps the connections of the Postgres pool
+	DBMaxConns int
+	// NotificationBuffer is the number of job notifications held for workers
+	NotificationBuffer int
+	// Migrate applies the schema migrations at startup
+	Migrate bool
+
+	// WorkerMultiplier scales the number of workers with the CPU count
+	WorkerMultiplier int
+	// PollInterval is how often idle workers look for jobs they were not
+	// notified of
+	PollInterval time.Duration
+
+	MonthlyBudgetUSD       float64
+	WorkoutMergeWindow     time.Duration
+	ContextRefreshInterval time.Duration
+	ContextTokenBudget     int
+	ContextTopN            int
+	NameConfidence         float64
+
+	PromptDir               string
+	PromptVersion           string
+	PromptExperiment        string
+	PromptExperimentPercent int
+
+	// Model is the OpenAI model messages are extracted with
+	Model        string
+	CassetteMode string
+	CassetteDir  string
+	// LLMCache is where extractions are cached: redis, postgres, or empty
+	// for no caching
+	LLMCache    string
+	LLMCacheTTL time.Duration
+
+	Redis redis_repository.Config
+	// RedisHealthInterval is how often Redis is pinged
+	RedisHealthInterval time.Duration
+}
+
+// Default returns the configuration used for settings that are not set
+func Default() *Config {
+	return &Config{
+		Mode:                   ModeAll,
+		Port:                   "3000",
+		DBMaxConns:             repository.DefaultMaxConns,
+		NotificationBuffer:     repository.DefaultNotificationBuffer,
+		Migrate:                true,
+		WorkerMultiplier:       2,
+		PollInterval:           repository.DefaultPollInterval,
+		WorkoutMergeWindow:     repository.DefaultWorkoutMergeWindow,
+		ContextRefreshInterval: 5 * time.Minute,
+		ContextTokenBudget:     llm.ContextSelection.TokenBudget,
+		ContextTopN:            llm.ContextSelection.TopN,
+		NameConfidence:         llm.MinNameConfidence,
+		Model:                  llm.Model,
+		LLMCacheTTL:            llm.DefaultCacheTTL,
+		RedisHealthInterval:    30 * time.Second,
+	}
+}
+
+// ServesAPI reports whether the process serves the HTTP API
+func (c *Config) ServesAPI() bool {
+	return c.Mode != ModeWorker
+}
+
+// RunsWorkers reports whether the process claims and processes jobs
+func (c *Config) RunsWorkers() bool {
+	return c.Mode != ModeAPI
+}
+
+// setting binds a configuration field to the variable naming it
+type setting struct {
+	name string
+	// secret settings are redacted from the dump
+	secret bool
+	parse  func(value string) error
+	format func() string
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		stringSetting("BPYP_MODE", &c.Mode),
+		stringSetting("PORT", &c.Port),
+		{name: "BPYP_POSTGRES_DIR_CONN", parse: assign(&c.DatabaseURL), format: func() string { return redactURL(c.DatabaseURL) }},
+		secretSetting("BPYP_POSTGRES_JWT_SECRET", &c.JWTSecret),
+		intSetting("BPYP_DB_MAX_CONNS", &c.DBMaxConns),
+		intSetting("BPYP_NOTIFICATION_BUFFER", &c.NotificationBuffer),
+		boolSetting("BPYP_MIGRATE", &c.Migrate),
+		intSetting("BPYP_WORKER_MULTIPLIER", &c.WorkerMultiplier),
+		durationSetting("BPYP_POLL_INTERVAL", &c.PollInterval),
+		floatSetting("BPYP_MONTHLY_BUDGET_USD", &c.MonthlyBudgetUSD),
+		durationSetting("BPYP_WORKOUT_MERGE_WINDOW", &c.WorkoutMergeWindow),
+		durationSetting("BPYP_CONTEXT_REFRESH_INTERVAL", &c.ContextRefreshInterval),
+		intSetting("BPYP_CONTEXT_TOKEN_BUDGET", &c.ContextTokenBudget),
+		intSetting("BPYP_CONTEXT_TOP_N", &c.ContextTopN),
+		floatSetting("BPYP_NAME_CONFIDENCE", &c.NameConfidence),
+		stringSetting("BPYP_PROMPT_DIR", &c.PromptDir),
+		stringSetting("BPYP_PROMPT_VERSION", &c.PromptVersion),
+		stringSetting("BPYP_PROMPT_EXPERIMENT", &c.PromptExperiment),
+		intSetting("BPYP_PROMPT_EXPERIMENT_PERCENT", &c.PromptExperimentPercent),
+		stringSetting("BPYP_LLM_MODEL", &c.Model),
+		stringSetting("BPYP_LLM_CASSETTE_MODE", &c.CassetteMode),
+		stringSetting("BPYP_LLM_CASSETTE_DIR", &c.CassetteDir),
+		stringSetting("BPYP_LLM_CACHE", &c.LLMCache),
+		durationSetting("BPYP_LLM_CACHE_TTL", &c.LLMCacheTTL),
+		listSetting("REDIS_ADDR", &c.Redis.Addrs),
+		stringSetting("REDIS_USERNAME", &c.Redis.Username),
+		secretSetting("REDIS_PW", &c.Redis.Password),
+		intSetting("REDIS_DB", &c.Redis.DB),
+		intSetting("REDIS_POOL_SIZE", &c.Redis.PoolSize),
+		boolSetting("REDIS_TLS", &c.Redis.TLS),
+		stringSetting("REDIS_SENTINEL_MASTER", &c.Redis.SentinelMaster),
+		secretSetting("REDIS_SENTINEL_PW", &c.Redis.SentinelPassword),
+		durationSetting("REDIS_HEALTH_INTERVAL", &c.RedisHealthInterval),
+	}
+}
+
+// Load reads the configuration file at path, or at the path in
+// BPYP_CONFIG_FILE when path is empty, overrides it with the environment and
+// then with flags, keyed by setting name like the file, and validates the
+// result. Without a file only the environment and flags are read.
+func Load(path string, flags map[string]string) (*Config, error) {
+	if path == "" {
+		path = os.Getenv(FileEnv)
+	}
+	values := map[string]string{}
+	if path != "" {
+		var err error
+		if values, err = readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := Default()
+	var errs []error
+	for _, s := range cfg.settings() {
+		if value, ok := os.LookupEnv(s.name); ok && value != "" {
+			values[s.name] = value
+		}
+		if value, ok := flags[s.name]; ok && value != "" {
+			values[s.name] = value
+		}
+		value, ok := values[s.name]
+		delete(values, s.name)
+		if !ok {
+			continue
+		}
+		if err := s.parse(strings.TrimSpace(value)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	for name := range values {
+		errs = append(errs, fmt.Errorf("%s: unknown setting in %s", name, path))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile reads the settings of a configuration file as strings, joining
+// lists with commas as they are written in the environment
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading configuration file: %w", err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing configuration file %s: %w", path, err)
+	}
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		text, err := fileValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing configuration file %s: %s: %w", path, name, err)
+		}
+		values[name] = text
+	}
+	return values, nil
+}
+
+func fileValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case nil:
+		return "", nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			text, ok := item.(string)
+			if !ok {
+				return "", errors.New("expected a list of strings")
+			}
+			items[i] = text
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", errors.New("expected a string, number, boolean or list of strings")
+}
+
+// Validate checks that every setting is usable, reporting each one that is
+// not
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, name string, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(c.Mode == ModeAPI || c.Mode == ModeWorker || c.Mode == ModeAll,
+		"BPYP_MODE", "%q is not %s, %s or %s", c.Mode, ModeAPI, ModeWorker, ModeAll)
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port < 65536, "PORT", "%q is not a port number", c.Port)
+	check(c.DatabaseURL != "", "BPYP_POSTGRES_DIR_CONN", "is required")
+	check(c.JWTSecret != "" || !c.ServesAPI(), "BPYP_POSTGRES_JWT_SECRET", "is required to serve the API")
+	check(c.DBMaxConns > 0, "BPYP_DB_MAX_CONNS", "must be positive, got %d", c.DBMaxConns)
+	check(c.NotificationBuffer > 0, "BPYP_NOTIFICATION_BUFFER", "must be positive, got %d", c.NotificationBuffer)
+	check(c.WorkerMultiplier > 0, "BPYP_WORKER_MULTIPLIER", "must be positive, got %d", c.WorkerMultiplier)
+	check(c.PollInterval > 0, "BPYP_POLL_INTERVAL", "must be positive, got %v", c.PollInterval)
+	check(c.MonthlyBudgetUSD >= 0, "BPYP_MONTHLY_BUDGET_USD", "must not be negative, got %v", c.MonthlyBudgetUSD)
+	check(c.WorkoutMergeWindow > 0, "BPYP_WORKOUT_MERGE_WINDOW", "must be positive, got %v", c.WorkoutMergeWindow)
+	check(c.ContextRefreshInterval > 0, "BPYP_CONTEXT_REFRESH_INTERVAL", "must be positive, got %v", c.ContextRefreshInterval)
+	check(c.ContextTokenBudget > 0, "BPYP_CONTEXT_TOKEN_BUDGET", "must be positive, got %d", c.ContextTokenBudget)
+	check(c.ContextTopN > 0, "BPYP_CONTEXT_TOP_N", "must be positive, got %d", c.ContextTopN)
+	check(c.NameConfidence > 0 && c.NameConfidence <= 1, "BPYP_NAME_CONFIDENCE", "must be in (0, 1], got %v", c.NameConfidence)
+	check(c.PromptExperimentPercent >= 0 && c.PromptExperimentPercent <= 100,
+		"BPYP_PROMPT_EXPERIMENT_PERCENT", "must be between 0 and 100, got %d", c.PromptExperimentPercent)
+	check(c.Model != "", "BPYP_LLM_MODEL", "is required")
+	check(c.CassetteMode == "" || c.CassetteMode == llm.CassetteRecord || c.CassetteMode == llm.CassetteReplay,
+		"BPYP_LLM_CASSETTE_MODE", "%q is not %s or %s", c.CassetteMode, llm.CassetteRecord, llm.CassetteReplay)
+	check(c.CassetteMode == "" || c.CassetteDir != "", "BPYP_LLM_CASSETTE_DIR", "is required with a cassette mode")
+	check(c.LLMCache == "" || c.LLMCache == "redis" || c.LLMCache == "postgres",
+		"BPYP_LLM_CACHE", "%q is not redis or postgres", c.LLMCache)
+	check(c.LLMCacheTTL > 0, "BPYP_LLM_CACHE_TTL", "must be positive, got %v", c.LLMCacheTTL)
+	check(c.Redis.DB >= 0, "REDIS_DB", "must not be negative, got %d", c.Redis.DB)
+	check(c.Redis.PoolSize >= 0, "REDIS_POOL_SIZE", "must not be negative, got %d", c.Redis.PoolSize)
+	check(c.Redis.SentinelMaster == "" || len(c.Redis.Addrs) > 0,
+		"REDIS_SENTINEL_MASTER", "needs the sentinel addresses in REDIS_ADDR")
+	check(c.RedisHealthInterval > 0, "REDIS_HEALTH_INTERVAL", "must be positive, got %v", c.RedisHealthInterval)
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
+
+// Dump lists the effective settings, one NAME=value per line, with secrets
+// and the database password redacted
+func (c *Config) Dump() string {
+	var b strings.Builder
+	for _, s := range c.settings() {
+		value := s.format()
+		if s.secret && value != "" {
+			value = "[redacted]"
+		}
+		fmt.Fprintf(&b, "%s=%s\n", s.name, value)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// redactURL hides the password of a connection URL. Connection strings that
+// are not URLs are hidden entirely, as they may hold a password too.
+func redactURL(conn string) string {
+	if conn == "" {
+		return ""
+	}
+	u, err := url.Parse(conn)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "[redacted]"
+	}
+	return u.Redacted()
+}
+
+func assign(field *string) func(string) error {
+	return func(value string) error {
+		*field = value
+		return nil
+	}
+}
+
+func stringSetting(name string, field *string) setting {
+	return setting{name: name, parse: assign(field), format: func() string { return *field }}
+}
+
+func secretSetting(name string, field *string) setting {
+	s := stringSetting(name, field)
+	s.secret = true
+	return s
+}
+
+func intSetting(name string, field *int) setting {
+	return setting{
+		name: name,
+		parse: func(value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%q is not an integer", value)
+			}
+			*field = n
+			return nil
+		},
+		format: func() string { return strconv.Itoa(*field) },
+	}
+}
+
+func floatSetting(name string, field *float64) setting {
+	return setting{
+		name: name,
+		parse: func(value string) error {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%q is not a number", value)
+			}
+			*field = f
+			return nil
+		},
+		format: func() string { return strconv.FormatFloat(*field, 'f', -1, 64) },
+	}
+}
+
+func boolSetting(name string, field *bool) setting {
+	return setting{
+		name: name,
+		parse: func(value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%q is not true or false", value)
+			}
+			*field = b
+			return nil
+		},
+		format: func() string { return strconv.FormatBool(*field) },
+	}
+}
+
+func durationSetting(name string, field *time.Duration) setting {
+	return setting{
+		name: name,
+		parse: func(value string) error {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%q is not a duration such as 30s or 5m", value)
+			}
+			*field = d
+			return nil
+		},
+		format: func() string { return field.String() },
+	}
+}
+
+// listSetting reads a comma separated list
+func listSetting(name string, field *[]string) setting {
+	return setting{
+		name: name,
+		parse: func(value string) error {
+			*field = nil
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*field = append(*field, item)
+				}
+			}
+			return nil
+		},
+		format: func() string { return strings.Join(*field, ",") },
+	}
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadModeFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		mode string
+		want string
+		err  string
+	}{
+		{name: "worker without an API secret", mode: ModeWorker, want: ModeWorker},
+		{name: "flag overrides the environment", env: map[string]string{"BPYP_MODE": ModeAPI}, mode: ModeWorker, want: ModeWorker},
+		{name: "environment without a flag", env: map[string]string{"BPYP_MODE": ModeWorker}, want: ModeWorker},
+		{name: "api needs its secret", mode: ModeAPI, err: "BPYP_POSTGRES_JWT_SECRET: is required to serve the API"},
+		{name: "unknown mode", mode: "batch", err: `BPYP_MODE: "batch" is not api, worker or all`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(FileEnv, "")
+			t.Setenv("BPYP_POSTGRES_JWT_SECRET", "")
+			t.Setenv("BPYP_MODE", "")
+			t.Setenv("BPYP_POSTGRES_DIR_CONN", "postgres://localhost/bpyp")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := Load("", map[string]string{"BPYP_MODE": tt.mode})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Load error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Mode != tt.want {
+				t.Errorf("mode = %q, want %q", cfg.Mode, tt.want)
+			}
+		})
+	}
+}
+
+// clearEnv unsets every setting's variable for the test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv(FileEnv, "")
+	for _, s := range Default().settings() {
+		t.Setenv(s.name, "")
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	path := writeFile(t, `{
+		"BPYP_POSTGRES_DIR_CONN": "postgres://file/bpyp",
+		"BPYP_MODE": "worker",
+		"PORT": 4000,
+		"BPYP_MIGRATE": false,
+		"BPYP_POLL_INTERVAL": "10s",
+		"REDIS_ADDR": ["redis-1:6379", "redis-2:6379"]
+	}`)
+	t.Setenv("PORT", "5000")
+	t.Setenv("BPYP_POLL_INTERVAL", "")
+	t.Setenv("BPYP_DB_MAX_CONNS", " 12 ")
+
+	cfg, err := Load(path, nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "file only", got: cfg.DatabaseURL, want: "postgres://file/bpyp"},
+		{name: "environment over file", got: cfg.Port, want: "5000"},
+		{name: "empty environment keeps the file", got: cfg.PollInterval, want: 10 * time.Second},
+		{name: "environment only, trimmed", got: cfg.DBMaxConns, want: 12},
+		{name: "file boolean", got: cfg.Migrate, want: false},
+		{name: "file list", got: strings.Join(cfg.Redis.Addrs, ","), want: "redis-1:6379,redis-2:6379"},
+		{name: "default", got: cfg.WorkerMultiplier, want: 2},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	t.Setenv(FileEnv, path)
+	if cfg, err := Load("", nil); err != nil || cfg.Mode != ModeWorker {
+		t.Errorf("Load from %s = %+v, %v, want the file's worker mode", FileEnv, cfg, err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		errs []string
+	}{
+		{
+			name: "unknown keys",
+			file: `{"BPYP_POSTGRES_DIR_CONN": "postgres://file/bpyp", "PROT": 3000, "REDIS_ADDRESS": "redis:6379"}`,
+			errs: []string{"PROT: unknown setting in", "REDIS_ADDRESS: unknown setting in"},
+		},
+		{
+			name: "unparsable values",
+			file: `{"BPYP_POSTGRES_DIR_CONN": "postgres://file/bpyp", "BPYP_MIGRATE": "sometimes"}`,
+			env:  map[string]string{"BPYP_DB_MAX_CONNS": "many", "BPYP_POLL_INTERVAL": "5"},
+			errs: []string{`BPYP_MIGRATE: "sometimes" is not true or false`, `BPYP_DB_MAX_CONNS: "many" is not an integer`,
+				`BPYP_POLL_INTERVAL: "5" is not a duration such as 30s or 5m`},
+		},
+		{
+			name: "file value of the wrong type",
+			file: `{"REDIS_ADDR": [6379]}`,
+			errs: []string{"REDIS_ADDR: expected a list of strings"},
+		},
+		{
+			name: "malformed file",
+			file: `{"PORT": 3000,}`,
+			errs: []string{"error parsing configuration file"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			_, err := Load(writeFile(t, tt.file), nil)
+			if err == nil {
+				t.Fatalf("Load succeeded, want errors %v", tt.errs)
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load error = %v, want one containing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDump(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		lines   []string
+		secrets []string
+	}{
+		{
+			name: "secrets and database password",
+			change: func(c *Config) {
+				c.DatabaseURL = "postgres://bpyp:hunter2@db:5432/bpyp"
+				c.JWTSecret = "jwt-secret"
+				c.Redis.Password = "redis-secret"
+			},
+			lines: []string{"BPYP_POSTGRES_DIR_CONN=postgres://bpyp:xxxxx@db:5432/bpyp",
+				"BPYP_POSTGRES_JWT_SECRET=[redacted]", "REDIS_PW=[redacted]", "REDIS_SENTINEL_PW=", "PORT=3000"},
+			secrets: []string{"hunter2", "jwt-secret", "redis-secret"},
+		},
+		{
+			name:    "connection string that is not a URL",
+			change:  func(c *Config) { c.DatabaseURL = "host=db user=bpyp password=hunter2" },
+			lines:   []string{"BPYP_POSTGRES_DIR_CONN=[redacted]"},
+			secrets: []string{"hunter2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(cfg)
+			dump := cfg.Dump()
+			lines := strings.Split(dump, "\n")
+			for _, want := range tt.lines {
+				if !slices.Contains(lines, want) {
+					t.Errorf("dump has no line %q:\n%s", want, dump)
+				}
+			}
+			for _, secret := range tt.secrets {
+				if strings.Contains(dump, secret) {
+					t.Errorf("dump shows %q:\n%s", secret, dump)
+				}
+			}
+			if len(lines) != len(cfg.settings()) {
+				t.Errorf("dump has %d lines, want one per setting (%d)", len(lines), len(cfg.settings()))
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		errs   []string
+	}{
+		{name: "valid", change: func(c *Config) {}},
+		{name: "missing database", change: func(c *Config) { c.DatabaseURL = "" }, errs: []string{"BPYP_POSTGRES_DIR_CONN: is required"}},
+		{name: "port", change: func(c *Config) { c.Port = "http" }, errs: []string{`PORT: "http" is not a port number`}},
+		{name: "port out of range", change: func(c *Config) { c.Port = "70000" }, errs: []string{`PORT: "70000" is not a port number`}},
+		{name: "negative budget", change: func(c *Config) { c.MonthlyBudgetUSD = -1 }, errs: []string{"BPYP_MONTHLY_BUDGET_USD: must not be negative, got -1"}},
+		{name: "name confidence", change: func(c *Config) { c.NameConfidence = 1.5 }, errs: []string{"BPYP_NAME_CONFIDENCE: must be in (0, 1], got 1.5"}},
+		{name: "experiment percent", change: func(c *Config) { c.PromptExperimentPercent = 120 },
+			errs: []string{"BPYP_PROMPT_EXPERIMENT_PERCENT: must be between 0 and 100, got 120"}},
+		{name: "cassette without a directory", change: func(c *Config) { c.CassetteMode = "replay" },
+			errs: []string{"BPYP_LLM_CASSETTE_DIR: is required with a cassette mode"}},
+		{name: "cache", change: func(c *Config) { c.LLMCache = "memcached" }, errs: []string{`BPYP_LLM_CACHE: "memcached" is not redis or postgres`}},
+		{name: "sentinel without addresses", change: func(c *Config) { c.Redis.SentinelMaster = "mymaster" },
+			errs: []string{"REDIS_SENTINEL_MASTER: needs the sentinel addresses in REDIS_ADDR"}},
+		{
+			name: "every problem is reported",
+			change: func(c *Config) {
+				c.WorkerMultiplier = 0
+				c.PollInterval = -time.Second
+				c.Redis.DB = -1
+			},
+			errs: []string{"BPYP_WORKER_MULTIPLIER: must be positive, got 0", "BPYP_POLL_INTERVAL: must be positive, got -1s",
+				"REDIS_DB: must not be negative, got -1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DatabaseURL = "postgres://localhost/bpyp"
+			cfg.JWTSecret = "secret"
+			tt.change(cfg)
+			err := cfg.Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate succeeded, want errors %v", tt.errs)
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate error = %v, want one containing %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	llm "noerkrieg.com/server/llm"
+)
+
+// Supported export formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+// Writer streams exercises into an export file. Close must be called to
+// flush the file's trailer.
+type Writer interface {
+	Write(ex llm.Exercise) error
+	Close() error
+}
+
+// header names the exported columns, matching the exercises table. Metrics
+// and set details are written as JSON.
+var header = []string{
+	"id", "exercise_name", "summary", "type", "sets", "work", "work_type",
+	"resistance", "resistance_type", "duration", "attributes", "user_id", "created_ts",
+	"performed_at", "raw_exercise_name", "workout_id", "position", "group_number",
+	"original_resistance_type", "original_work_type", "metrics", "set_details",
+}
+
+// NewWriter returns a Writer producing the given format on w
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatNDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(w)}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// Valid reports whether format is a supported export format
+func Valid(format string) bool {
+	return format == FormatCSV || format == FormatNDJSON || format == FormatXLSX
+}
+
+// ContentType returns the MIME type of an export format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// Filename returns the download name of an export created at the given time
+func Filename(format string, createdAt time.Time) string {
+	return fmt.Sprintf("workouts-%s.%s", createdAt.Format("2006-01-02"), format)
+}
+
+// fields returns an exercise's values in header order
+func fields(ex llm.Exercise) []string {
+	return []string{
+		ex.Id,
+		ex.Exercise,
+		ex.Summary,
+		ex.Type,
+		number(ex.Sets),
+		number(ex.Quantity),
+		ex.QuantityType,
+		number(ex.Resistance),
+		ex.ResistanceType,
+		number(ex.Duration),
+		strings.Join(ex.Attributes, "; "),
+		ex.UserId,
+		ex.Timestamp.Format(time.RFC3339),
+		performedAt(ex),
+		ex.RawName,
+		ex.WorkoutID,
+		optionalNumber(ex.Position),
+		optionalNumber(ex.Group),
+		ex.OriginalResistanceType,
+		ex.OriginalWorkType,
+		jsonValue(len(ex.Metrics) > 0, ex.Metrics),
+		jsonValue(len(ex.SetDetails) > 0, ex.SetDetails),
+	}
+}
+
+// performedAt formats when an exercise was performed, which defaults to when
+// it was logged
+func performedAt(ex llm.Exercise) string {
+	if ex.PerformedAt == nil {
+		return ex.Timestamp.Format(time.RFC3339)
+	}
+	return ex.PerformedAt.Format(time.RFC3339)
+}
+
+func number(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// optionalNumber formats a number that is unset when zero
+func optionalNumber(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// jsonValue encodes v for a single column, leaving the column empty when v
+// is not set
+func jsonValue(set bool, v any) string {
+	if !set {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	return &csvWriter{writer: writer}, nil
+}
+
+func (c *csvWriter) Write(ex llm.Exercise) error {
+	return c.writer.Write(fields(ex))
+}
+
+func (c *csvWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(ex llm.Exercise) error {
+	return n.encoder.Encode(ex)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,169 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	llm "noerkrieg.com/server/llm"
+)
+
+var (
+	loggedAt  = time.Date(2026, 3, 2, 18, 30, 0, 0, time.UTC)
+	performed = time.Date(2026, 3, 2, 17, 45, 0, 0, time.UTC)
+)
+
+var pyramid = llm.Exercise{
+	Id: "41", Exercise: "Bench Press", RawName: "bench", Type: "strength", Sets: 3, Quantity: 8, QuantityType: "repetitions",
+	Resistance: 155, ResistanceType: "pounds", Attributes: []string{"Paused", "Close Grip"}, UserId: "u1",
+	Timestamp: loggedAt, PerformedAt: &performed, WorkoutID: "w1", Position: 2, Group: 1,
+	OriginalResistanceType: "lbs", SetDetails: []llm.ExerciseSet{{Reps: 10, Load: 135}, {Reps: 8, Load: 155}, {Reps: 6, Load: 175}},
+}
+
+var run = llm.Exercise{
+	Id: "42", Exercise: "Run", Type: "cardio", Quantity: 5, QuantityType: "kilometers", Duration: 27, UserId: "u1",
+	Timestamp: loggedAt, Metrics: map[string]float64{"elevation_gain": 40, "avg_heart_rate": 151},
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writeAll(t, FormatCSV, &buf, pyramid, run)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("reading csv: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want a header and 2 rows", len(records))
+	}
+	if strings.Join(records[0], ",") != strings.Join(header, ",") {
+		t.Errorf("header = %v, want %v", records[0], header)
+	}
+
+	tests := []struct {
+		row    int
+		column string
+		want   string
+	}{
+		{row: 1, column: "exercise_name", want: "Bench Press"},
+		{row: 1, column: "attributes", want: "Paused; Close Grip"},
+		{row: 1, column: "performed_at", want: "2026-03-02T17:45:00Z"},
+		{row: 1, column: "raw_exercise_name", want: "bench"},
+		{row: 1, column: "workout_id", want: "w1"},
+		{row: 1, column: "position", want: "2"},
+		{row: 1, column: "group_number", want: "1"},
+		{row: 1, column: "original_resistance_type", want: "lbs"},
+		{row: 1, column: "metrics", want: ""},
+		{row: 1, column: "set_details", want: `[{"reps":10,"load":135},{"reps":8,"load":155},{"reps":6,"load":175}]`},
+		{row: 2, column: "performed_at", want: "2026-03-02T18:30:00Z"},
+		{row: 2, column: "group_number", want: ""},
+		{row: 2, column: "metrics", want: `{"avg_heart_rate":151,"elevation_gain":40}`},
+		{row: 2, column: "set_details", want: ""},
+	}
+	for _, tt := range tests {
+		if got := records[tt.row][column(t, tt.column)]; got != tt.want {
+			t.Errorf("row %d %s = %q, want %q", tt.row, tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writeAll(t, FormatNDJSON, &buf, pyramid, run)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var got llm.Exercise
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("decoding line: %v", err)
+	}
+	if len(got.SetDetails) != 3 || got.SetDetails[2].Load != 175 {
+		t.Errorf("set_details = %+v, want the 3 pyramid sets", got.SetDetails)
+	}
+	if got.WorkoutID != "w1" || got.Group != 1 || got.Position != 2 || got.OriginalResistanceType != "lbs" {
+		t.Errorf("exercise = %+v, want its workout, group, position and original unit", got)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil {
+		t.Fatalf("decoding line: %v", err)
+	}
+	if got.Metrics["elevation_gain"] != 40 {
+		t.Errorf("metrics = %v, want the elevation gain", got.Metrics)
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writeAll(t, FormatXLSX, &buf, pyramid, run)
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("opening workbook: %v", err)
+	}
+	var sheet string
+	for _, file := range archive.File {
+		if file.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sheet = string(data)
+	}
+	if sheet == "" {
+		t.Fatal("workbook has no sheet")
+	}
+
+	for _, want := range []string{
+		`<row r="3">`,
+		`<c><v>155</v></c>`,
+		`<c><v>2</v></c>`,
+		`<t xml:space="preserve">[{&#34;reps&#34;:10,&#34;load&#34;:135}`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet does not contain %s", want)
+		}
+	}
+	// Unset numeric columns are left empty rather than written as numbers
+	if strings.Contains(sheet, `<v></v>`) {
+		t.Error("sheet has an empty numeric cell")
+	}
+}
+
+func writeAll(t *testing.T, format string, w io.Writer, exercises ...llm.Exercise) {
+	t.Helper()
+	writer, err := NewWriter(format, w)
+	if err != nil {
+		t.Fatalf("NewWriter(%s): %v", format, err)
+	}
+	for _, ex := range exercises {
+		if err := writer.Write(ex); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func column(t *testing.T, name string) int {
+	t.Helper()
+	for i, h := range header {
+		if h == name {
+			return i
+		}
+	}
+	t.Fatalf("no column %s", name)
+	return -1
+}
@@ -0,0 +1,113 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strconv"
+
+	llm "noerkrieg.com/server/llm"
+)
+
+// Static parts of a single-sheet workbook
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Exercises" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`},
+}
+
+// numericColumns are the header columns written as numbers rather than text,
+// when they have a value
+var numericColumns = map[int]bool{4: true, 5: true, 7: true, 9: true, 16: true, 17: true}
+
+// xlsxWriter writes a minimal SpreadsheetML workbook, streaming rows into
+// the sheet part as they arrive
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   io.Writer
+	row     int
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return nil, err
+	}
+
+	x := &xlsxWriter{archive: archive, sheet: sheet}
+	if err := x.writeRow(header, false); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *xlsxWriter) Write(ex llm.Exercise) error {
+	return x.writeRow(fields(ex), true)
+}
+
+func (x *xlsxWriter) writeRow(values []string, typed bool) error {
+	x.row++
+	if _, err := io.WriteString(x.sheet, `<row r="`+strconv.Itoa(x.row)+`">`); err != nil {
+		return err
+	}
+	for i, value := range values {
+		if typed && numericColumns[i] && value != "" {
+			if _, err := io.WriteString(x.sheet, `<c><v>`+value+`</v></c>`); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.WriteString(x.sheet, `<c t="inlineStr"><is><t xml:space="preserve">`); err != nil {
+			return err
+		}
+		if err := xml.EscapeText(x.sheet, []byte(value)); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(x.sheet, `</t></is></c>`); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(x.sheet, `</row>`)
+	return err
+}
+
+func (x *xlsxWriter) Close() error {
+	if _, err := io.WriteString(x.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return x.archive.Close()
+}
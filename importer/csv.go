@@ -0,0 +1,462 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	llm "noerkrieg.com/server/llm"
+)
+
+// Apps whose CSV exports can be imported
+const (
+	SourceStrong   = "strong"
+	SourceHevy     = "hevy"
+	SourceFitNotes = "fitnotes"
+)
+
+// RowError reports a CSV row that could not be imported. Row is the 1-based
+// line number in the file, counting the header.
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// Record is an exercise built from one or more consecutive identical sets,
+// along with the first row it came from
+type Record struct {
+	Row      int
+	Exercise llm.Exercise
+}
+
+// Options controls how values without an explicit unit are interpreted
+type Options struct {
+	// WeightUnit is used when the export does not name one, "pounds" or "kilograms"
+	WeightUnit string
+	// Location is the time zone the export's local timestamps are in
+	Location *time.Location
+}
+
+// equipment matches the trailing equipment qualifier used by Strong and Hevy,
+// as in "Bench Press (Barbell)"
+var equipment = regexp.MustCompile(`^(.*?)\s*\(([^)]+)\)$`)
+
+// set is a single parsed row of an export
+type set struct {
+	row          int
+	date         time.Time
+	workout      string
+	exercise     string
+	kind         string
+	weight       float64
+	weightUnit   string
+	reps         float64
+	distance     float64
+	distanceUnit string
+	seconds      float64
+}
+
+// columns maps lower-cased header names to their index
+type columns map[string]int
+
+func (c columns) has(name string) bool {
+	_, ok := c[strings.ToLower(name)]
+	return ok
+}
+
+// get returns the value of the first named column present in the header
+func (c columns) get(record []string, names ...string) string {
+	for _, name := range names {
+		if i, ok := c[strings.ToLower(name)]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+	}
+	return ""
+}
+
+// DetectSource identifies the exporting app from a CSV header row
+func DetectSource(header []string) (string, bool) {
+	cols := indexColumns(header)
+	switch {
+	case cols.has("exercise_title"):
+		return SourceHevy, true
+	case cols.has("exercise name") && cols.has("set order"):
+		return SourceStrong, true
+	case cols.has("exercise") && cols.has("category"):
+		return SourceFitNotes, true
+	}
+	return "", false
+}
+
+// ReadHeader returns the header row of a CSV export
+func ReadHeader(r io.Reader) ([]string, error) {
+	reader, err := newReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return reader.Read()
+}
+
+// ParseCSV maps the rows of an app export to exercises without going through
+// the LLM. Consecutive sets of the same exercise with the same load and reps
+// become one exercise with a set count. Rows that cannot be mapped are
+// reported and skipped.
+func ParseCSV(source string, r io.Reader, opts Options) ([]Record, []RowError, error) {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.WeightUnit == "" {
+		opts.WeightUnit = "pounds"
+	}
+
+	reader, err := newReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read header: %w", err)
+	}
+	cols := indexColumns(header)
+	if source == "" {
+		var ok bool
+		if source, ok = DetectSource(header); !ok {
+			return nil, nil, fmt.Errorf("unrecognized CSV export format")
+		}
+	}
+
+	var parse func(columns, []string, Options) (set, error)
+	switch source {
+	case SourceStrong:
+		parse = parseStrong
+	case SourceHevy:
+		parse = parseHevy
+	case SourceFitNotes:
+		parse = parseFitNotes
+	default:
+		return nil, nil, fmt.Errorf("unsupported source %q", source)
+	}
+
+	records := make([]Record, 0)
+	errors := make([]RowError, 0)
+	// Exercises counted per workout start time, to key them by their order
+	ordinals := map[time.Time]int{}
+	var last *set
+	row := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			errors = append(errors, RowError{Row: row, Error: err.Error()})
+			continue
+		}
+
+		s, err := parse(cols, record, opts)
+		if err != nil {
+			errors = append(errors, RowError{Row: row, Error: err.Error()})
+			continue
+		}
+		s.row = row
+
+		if last != nil && sameSet(*last, s) {
+			records[len(records)-1].Exercise.Sets++
+			continue
+		}
+		ex := toExercise(source, s)
+		ordinals[s.date]++
+		ex.ImportKey = ImportKey(source, s.date, ordinals[s.date])
+		records = append(records, Record{Row: row, Exercise: ex})
+		last = &s
+	}
+
+	return records, errors, nil
+}
+
+func parseStrong(cols columns, record []string, opts Options) (set, error) {
+	s := set{
+		workout:      cols.get(record, "Workout Name"),
+		exercise:     cols.get(record, "Exercise Name"),
+		weightUnit:   unitName(cols.get(record, "Weight Unit")),
+		distanceUnit: unitName(cols.get(record, "Distance Unit")),
+	}
+	if s.weightUnit == "" {
+		s.weightUnit = opts.WeightUnit
+	}
+	if s.distanceUnit == "" {
+		s.distanceUnit = defaultDistanceUnit(opts.WeightUnit)
+	}
+	if cols.get(record, "Set Order") == "W" {
+		s.kind = "warmup"
+	}
+
+	var err error
+	if s.date, err = parseTime(cols.get(record, "Date"), opts.Location,
+		"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"); err != nil {
+		return s, err
+	}
+	return s, parseNumbers(&s, cols.get(record, "Weight"), cols.get(record, "Reps"),
+		cols.get(record, "Distance"), cols.get(record, "Seconds"))
+}
+
+func parseHevy(cols columns, record []string, opts Options) (set, error) {
+	s := set{
+		workout:  cols.get(record, "title"),
+		exercise: cols.get(record, "exercise_title"),
+		kind:     cols.get(record, "set_type"),
+	}
+
+	weight := cols.get(record, "weight_lbs")
+	s.weightUnit = "pounds"
+	if cols.has("weight_kg") {
+		weight = cols.get(record, "weight_kg")
+		s.weightUnit = "kilograms"
+	}
+	distance := cols.get(record, "distance_miles")
+	s.distanceUnit = "miles"
+	if cols.has("distance_km") {
+		distance = cols.get(record, "distance_km")
+		s.distanceUnit = "kilometers"
+	}
+
+	var err error
+	if s.date, err = parseTime(cols.get(record, "start_time"), opts.Location,
+		"2 Jan 2006, 15:04", "2 Jan 2006 15:04", time.RFC3339, "2006-01-02 15:04:05"); err != nil {
+		return s, err
+	}
+	return s, parseNumbers(&s, weight, cols.get(record, "reps"),
+		distance, cols.get(record, "duration_seconds"))
+}
+
+func parseFitNotes(cols columns, record []string, opts Options) (set, error) {
+	s := set{
+		workout:      cols.get(record, "Category"),
+		exercise:     cols.get(record, "Exercise"),
+		distanceUnit: unitName(cols.get(record, "Distance Unit")),
+	}
+
+	weight := cols.get(record, "Weight (lbs)")
+	s.weightUnit = "pounds"
+	if cols.has("Weight (kgs)") || cols.has("Weight (kg)") {
+		weight = cols.get(record, "Weight (kgs)", "Weight (kg)")
+		s.weightUnit = "kilograms"
+	}
+	if s.distanceUnit == "" {
+		s.distanceUnit = defaultDistanceUnit(s.weightUnit)
+	}
+
+	var err error
+	if s.date, err = parseTime(cols.get(record, "Date"), opts.Location, "2006-01-02"); err != nil {
+		return s, err
+	}
+	seconds, err := parseClock(cols.get(record, "Time"))
+	if err != nil {
+		return s, err
+	}
+	return s, parseNumbers(&s, weight, cols.get(record, "Reps"),
+		cols.get(record, "Distance"), strconv.FormatFloat(seconds, 'f', -1, 64))
+}
+
+// ImportKey identifies the exercise at ordinal, counting from 1, among those
+// of the workout started at start in an export from source. Exporting the
+// same workout again gives its exercises the same keys.
+func ImportKey(source string, start time.Time, ordinal int) string {
+	return fmt.Sprintf("%s/%s/%d", source, start.UTC().Format(time.RFC3339), ordinal)
+}
+
+// toExercise maps a set to the exercise schema the LLM produces
+func toExercise(source string, s set) llm.Exercise {
+	ex := llm.Exercise{
+		Exercise:   s.exercise,
+		Type:       "strength",
+		Sets:       1,
+		Attributes: []string{},
+		Timestamp:  s.date,
+		Summary:    fmt.Sprintf("Imported from %s", sourceName(source)),
+	}
+	if s.workout != "" {
+		ex.Summary += ": " + s.workout
+	}
+	if m := equipment.FindStringSubmatch(s.exercise); m != nil {
+		ex.Exercise = m[1]
+		ex.Attributes = append(ex.Attributes, m[2])
+	}
+	if kind := setKind(s.kind); kind != "" {
+		ex.Attributes = append(ex.Attributes, kind)
+	}
+
+	if s.reps > 0 {
+		ex.Quantity = s.reps
+		ex.QuantityType = "repetitions"
+	} else if s.distance > 0 {
+		ex.Type = "cardio"
+		ex.Quantity = s.distance
+		ex.QuantityType = s.distanceUnit
+	}
+	if s.weight > 0 {
+		ex.Resistance = s.weight
+		ex.ResistanceType = s.weightUnit
+	} else if s.reps > 0 {
+		ex.ResistanceType = "bodyweight"
+	}
+	if s.seconds > 0 {
+		ex.Duration = s.seconds / 60
+		if s.reps == 0 && s.weight == 0 && s.distance == 0 {
+			ex.Type = "cardio"
+		}
+	}
+	return ex
+}
+
+// sameSet reports whether two rows are repeated sets of one exercise
+func sameSet(a set, b set) bool {
+	return a.date.Equal(b.date) && a.exercise == b.exercise && a.kind == b.kind &&
+		a.weight == b.weight && a.weightUnit == b.weightUnit && a.reps == b.reps &&
+		a.distance == b.distance && a.seconds == b.seconds
+}
+
+func parseNumbers(s *set, weight, reps, distance, seconds string) error {
+	if s.exercise == "" {
+		return fmt.Errorf("missing exercise name")
+	}
+	var err error
+	if s.weight, err = parseNumber("weight", weight); err != nil {
+		return err
+	}
+	if s.reps, err = parseNumber("reps", reps); err != nil {
+		return err
+	}
+	if s.distance, err = parseNumber("distance", distance); err != nil {
+		return err
+	}
+	if s.seconds, err = parseNumber("duration", seconds); err != nil {
+		return err
+	}
+	if s.weight == 0 && s.reps == 0 && s.distance == 0 && s.seconds == 0 {
+		return fmt.Errorf("set for %s has no weight, reps, distance or duration", s.exercise)
+	}
+	return nil
+}
+
+func parseNumber(field string, value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", field, value)
+	}
+	return n, nil
+}
+
+func parseTime(value string, loc *time.Location, layouts ...string) (time.Time, error) {
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// parseClock parses an H:MM:SS or MM:SS duration into seconds
+func parseClock(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	seconds := 0.0
+	for _, part := range strings.Split(value, ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q", value)
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds, nil
+}
+
+// unitName standardizes a unit abbreviation to its full plural spelling
+func unitName(unit string) string {
+	switch strings.ToLower(strings.TrimSpace(unit)) {
+	case "":
+		return ""
+	case "lb", "lbs", "pound", "pounds":
+		return "pounds"
+	case "kg", "kgs", "kilogram", "kilograms":
+		return "kilograms"
+	case "mi", "mile", "miles":
+		return "miles"
+	case "km", "kilometer", "kilometers", "kilometre", "kilometres":
+		return "kilometers"
+	case "m", "meter", "meters", "metre", "metres":
+		return "meters"
+	case "ft", "feet":
+		return "feet"
+	case "yd", "yds", "yards":
+		return "yards"
+	}
+	return strings.ToLower(unit)
+}
+
+// setKind maps an export's set type to an attribute name
+func setKind(kind string) string {
+	switch strings.ToLower(kind) {
+	case "warmup", "warm_up", "w":
+		return "Warm Ups"
+	case "dropset", "drop_set", "d":
+		return "Drop Sets"
+	case "failure", "f":
+		return "To Failure"
+	}
+	return ""
+}
+
+func defaultDistanceUnit(weightUnit string) string {
+	if weightUnit == "kilograms" {
+		return "kilometers"
+	}
+	return "miles"
+}
+
+func sourceName(source string) string {
+	switch source {
+	case SourceStrong:
+		return "Strong"
+	case SourceHevy:
+		return "Hevy"
+	case SourceFitNotes:
+		return "FitNotes"
+	}
+	return source
+}
+
+func indexColumns(header []string) columns {
+	cols := make(columns, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	return cols
+}
+
+// newReader returns a CSV reader for the export, which Strong writes with
+// semicolons in some locales
+func newReader(r io.Reader) (*csv.Reader, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	firstLine, _, _ := strings.Cut(string(content), "\n")
+
+	reader := csv.NewReader(strings.NewReader(string(content)))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if strings.Count(firstLine, ";") > strings.Count(firstLine, ",") {
+		reader.Comma = ';'
+	}
+	return reader, nil
+}
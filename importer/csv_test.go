@@ -0,0 +1,169 @@
+package importer
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectSource(t *testing.T) {
+	tests := []struct {
+		header string
+		source string
+		ok     bool
+	}{
+		{header: "Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps", source: SourceStrong, ok: true},
+		{header: "\ufeffDate;Workout Name;Exercise Name;Set Order;Weight;Reps", source: SourceStrong, ok: true},
+		{header: "title,start_time,end_time,exercise_title,set_index,set_type,weight_kg,reps", source: SourceHevy, ok: true},
+		{header: "Date,Exercise,Category,Weight (kgs),Reps,Distance,Distance Unit,Time", source: SourceFitNotes, ok: true},
+		{header: "date,exercise,sets,reps"},
+	}
+	for _, tt := range tests {
+		header, err := ReadHeader(strings.NewReader(tt.header))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if source, ok := DetectSource(header); source != tt.source || ok != tt.ok {
+			t.Errorf("DetectSource(%q) = %q, %v, want %q, %v", tt.header, source, ok, tt.source, tt.ok)
+		}
+	}
+}
+
+// parsedExercise is the part of a parsed exercise the tests compare
+type parsedExercise struct {
+	row            int
+	name           string
+	attributes     []string
+	sets           float64
+	work           float64
+	workType       string
+	resistance     float64
+	resistanceType string
+	duration       float64
+	importKey      string
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		csv       string
+		opts      Options
+		exercises []parsedExercise
+		rowErrors []int
+	}{
+		{
+			name: "strong sets are grouped",
+			csv: "Date,Workout Name,Exercise Name,Set Order,Weight,Weight Unit,Reps,Distance,Seconds\n" +
+				"2024-03-01 18:00:00,Push,Bench Press (Barbell),W,60,kg,10,,\n" +
+				"2024-03-01 18:00:00,Push,Bench Press (Barbell),1,100,kg,5,,\n" +
+				"2024-03-01 18:00:00,Push,Bench Press (Barbell),2,100,kg,5,,\n" +
+				"2024-03-01 18:00:00,Push,Push Up,1,,,15,,\n",
+			exercises: []parsedExercise{
+				{row: 2, name: "Bench Press", attributes: []string{"Barbell", "Warm Ups"}, sets: 1, work: 10, workType: "repetitions",
+					resistance: 60, resistanceType: "kilograms", importKey: "strong/2024-03-01T18:00:00Z/1"},
+				{row: 3, name: "Bench Press", attributes: []string{"Barbell"}, sets: 2, work: 5, workType: "repetitions",
+					resistance: 100, resistanceType: "kilograms", importKey: "strong/2024-03-01T18:00:00Z/2"},
+				{row: 5, name: "Push Up", attributes: []string{}, sets: 1, work: 15, workType: "repetitions",
+					resistanceType: "bodyweight", importKey: "strong/2024-03-01T18:00:00Z/3"},
+			},
+		},
+		{
+			name:   "strong with semicolons and the default weight unit",
+			source: SourceStrong,
+			csv: "Date;Workout Name;Exercise Name;Set Order;Weight;Reps;Distance;Seconds\n" +
+				"2024-03-01 18:00;Legs;Squat;1;225;5;;\n" +
+				"2024-03-01 18:00;Legs;Rowing;1;;;2,5;600\n",
+			opts: Options{WeightUnit: "pounds"},
+			exercises: []parsedExercise{
+				{row: 2, name: "Squat", attributes: []string{}, sets: 1, work: 5, workType: "repetitions",
+					resistance: 225, resistanceType: "pounds", importKey: "strong/2024-03-01T18:00:00Z/1"},
+				{row: 3, name: "Rowing", attributes: []string{}, sets: 1, work: 2.5, workType: "miles",
+					duration: 10, importKey: "strong/2024-03-01T18:00:00Z/2"},
+			},
+		},
+		{
+			name: "hevy in its local time zone",
+			csv: "title,start_time,exercise_title,set_type,weight_kg,reps,distance_km,duration_seconds\n" +
+				"Pull,\"1 Mar 2024, 07:30\",Deadlift (Barbell),normal,140,5,,\n" +
+				"Pull,\"1 Mar 2024, 07:30\",Deadlift (Barbell),failure,140,3,,\n" +
+				"Run,\"2 Mar 2024, 08:00\",Running,normal,,,5,1500\n",
+			opts: Options{Location: time.FixedZone("CET", 60*60)},
+			exercises: []parsedExercise{
+				{row: 2, name: "Deadlift", attributes: []string{"Barbell"}, sets: 1, work: 5, workType: "repetitions",
+					resistance: 140, resistanceType: "kilograms", importKey: "hevy/2024-03-01T06:30:00Z/1"},
+				{row: 3, name: "Deadlift", attributes: []string{"Barbell", "To Failure"}, sets: 1, work: 3, workType: "repetitions",
+					resistance: 140, resistanceType: "kilograms", importKey: "hevy/2024-03-01T06:30:00Z/2"},
+				{row: 4, name: "Running", attributes: []string{}, sets: 1, work: 5, workType: "kilometers",
+					duration: 25, importKey: "hevy/2024-03-02T07:00:00Z/1"},
+			},
+		},
+		{
+			name: "fitnotes",
+			csv: "Date,Exercise,Category,Weight (kgs),Reps,Distance,Distance Unit,Time\n" +
+				"2024-03-01,Overhead Press,Shoulders,50,8,,,\n" +
+				"2024-03-01,Cycling,Cardio,,,20,km,0:45:00\n",
+			exercises: []parsedExercise{
+				{row: 2, name: "Overhead Press", attributes: []string{}, sets: 1, work: 8, workType: "repetitions",
+					resistance: 50, resistanceType: "kilograms", importKey: "fitnotes/2024-03-01T00:00:00Z/1"},
+				{row: 3, name: "Cycling", attributes: []string{}, sets: 1, work: 20, workType: "kilometers",
+					duration: 45, importKey: "fitnotes/2024-03-01T00:00:00Z/2"},
+			},
+		},
+		{
+			name: "invalid rows are reported and skipped",
+			csv: "Date,Workout Name,Exercise Name,Set Order,Weight,Reps\n" +
+				"yesterday,Push,Bench Press,1,100,5\n" +
+				"2024-03-01,Push,,1,100,5\n" +
+				"2024-03-01,Push,Bench Press,1,heavy,5\n" +
+				"2024-03-01,Push,Bench Press,1,-100,5\n" +
+				"2024-03-01,Push,Bench Press,1,,\n" +
+				"2024-03-01,Push,Bench Press,1,100,5\n",
+			exercises: []parsedExercise{
+				{row: 7, name: "Bench Press", attributes: []string{}, sets: 1, work: 5, workType: "repetitions",
+					resistance: 100, resistanceType: "pounds", importKey: "strong/2024-03-01T00:00:00Z/1"},
+			},
+			rowErrors: []int{2, 3, 4, 5, 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, rowErrors, err := ParseCSV(tt.source, strings.NewReader(tt.csv), tt.opts)
+			if err != nil {
+				t.Fatalf("ParseCSV: %v", err)
+			}
+			if len(records) != len(tt.exercises) {
+				t.Fatalf("got %d exercises, want %d: %+v", len(records), len(tt.exercises), records)
+			}
+			for i, record := range records {
+				ex, want := record.Exercise, tt.exercises[i]
+				got := parsedExercise{
+					row: record.Row, name: ex.Exercise, attributes: ex.Attributes, sets: ex.Sets,
+					work: ex.Quantity, workType: ex.QuantityType, resistance: ex.Resistance,
+					resistanceType: ex.ResistanceType, duration: ex.Duration, importKey: ex.ImportKey,
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("exercise %d = %+v, want %+v", i, got, want)
+				}
+			}
+			var rows []int
+			for _, rowError := range rowErrors {
+				rows = append(rows, rowError.Row)
+			}
+			if !slices.Equal(rows, tt.rowErrors) {
+				t.Errorf("row errors = %+v, want rows %v", rowErrors, tt.rowErrors)
+			}
+		})
+	}
+}
+
+func TestParseCSVRejectsUnknownExports(t *testing.T) {
+	if _, _, err := ParseCSV("", strings.NewReader("date,exercise,sets\n2024-03-01,squat,3\n"), Options{}); err == nil {
+		t.Error("ParseCSV accepted an unrecognized export")
+	}
+	if _, _, err := ParseCSV("myapp", strings.NewReader("Date,Exercise,Category\n"), Options{}); err == nil {
+		t.Error("ParseCSV accepted an unsupported source")
+	}
+}
@@ -0,0 +1,126 @@
+package importer
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Entry is a single dated workout note
+type Entry struct {
+	Date time.Time `json:"date"`
+	Text string    `json:"text"`
+}
+
+// Date layouts recognized in note headings and file names
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"2006.01.02",
+	"01/02/2006",
+	"1/2/2006",
+	"1/2/06",
+	"January 2, 2006",
+	"January 2 2006",
+	"Jan 2, 2006",
+	"Jan 2 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+	"Monday, January 2, 2006",
+	"Mon, Jan 2, 2006",
+	"Mon Jan 2 2006",
+}
+
+// headingPrefix strips markdown heading, list and emphasis markers
+var headingPrefix = regexp.MustCompile(`^[#>*\-\s]+`)
+
+// fileDate matches an ISO date anywhere in a file name, as produced by daily
+// note plugins
+var fileDate = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// SplitNotes splits the text of a notes file into dated entries. A line that
+// starts with a date begins a new entry; any text after the date on that line
+// belongs to the entry. Text before the first dated line is dated from the
+// file name when it contains one and is otherwise returned as skipped.
+func SplitNotes(name string, text string, loc *time.Location) ([]Entry, string) {
+	entries := make([]Entry, 0)
+	var current *Entry
+	var body strings.Builder
+	var skipped strings.Builder
+
+	if date, ok := parseDate(fileDate.FindString(filepath.Base(name)), loc); ok {
+		current = &Entry{Date: date}
+	}
+
+	flush := func() {
+		if current != nil {
+			current.Text = strings.TrimSpace(body.String())
+			if current.Text != "" {
+				entries = append(entries, *current)
+			}
+		}
+		body.Reset()
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if date, rest, ok := datedLine(line, loc); ok {
+			flush()
+			current = &Entry{Date: date}
+			if rest != "" {
+				body.WriteString(rest)
+				body.WriteString("\n")
+			}
+			continue
+		}
+
+		if current == nil {
+			skipped.WriteString(line)
+			skipped.WriteString("\n")
+			continue
+		}
+		body.WriteString(line)
+		body.WriteString("\n")
+	}
+	flush()
+
+	return entries, strings.TrimSpace(skipped.String())
+}
+
+// datedLine reports whether the line begins with a date and returns the
+// remainder of the line after it
+func datedLine(line string, loc *time.Location) (time.Time, string, bool) {
+	trimmed := strings.TrimSpace(headingPrefix.ReplaceAllString(line, ""))
+	trimmed = strings.Trim(trimmed, "*_")
+	if trimmed == "" {
+		return time.Time{}, "", false
+	}
+
+	// Try the longest prefix first so "Jan 2, 2006" wins over "Jan 2"
+	words := strings.Fields(trimmed)
+	for n := min(len(words), 4); n > 0; n-- {
+		candidate := strings.TrimRight(strings.Join(words[:n], " "), ":-–—*_")
+		if date, ok := parseDate(candidate, loc); ok {
+			rest := strings.TrimSpace(strings.Join(words[n:], " "))
+			rest = strings.TrimSpace(strings.TrimLeft(rest, ":-–—*_"))
+			return date, rest, true
+		}
+	}
+	return time.Time{}, "", false
+}
+
+// parseDate parses a date in any of the recognized layouts
+func parseDate(value string, loc *time.Location) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		if date, err := time.ParseInLocation(layout, value, loc); err == nil {
+			if date.Year() < 1970 || date.After(time.Now().In(loc).AddDate(0, 0, 1)) {
+				return time.Time{}, false
+			}
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSplitNotes(t *testing.T) {
+	loc := time.FixedZone("EST", -5*60*60)
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		text    string
+		entries []Entry
+		skipped string
+	}{
+		{
+			name: "dated headings",
+			file: "log.md",
+			text: "# 2024-03-01\nbench 3x5 100kg\n\n## March 3, 2024\nsquat 5x5\nrows 3x10\n",
+			entries: []Entry{
+				{Date: day(2024, 3, 1), Text: "bench 3x5 100kg"},
+				{Date: day(2024, 3, 3), Text: "squat 5x5\nrows 3x10"},
+			},
+		},
+		{
+			name: "text after the date",
+			file: "log.txt",
+			text: "- **3/5/2024**: deadlift 1x5 140kg\nfelt strong\nMon, Mar 11, 2024 - pullups 3x8",
+			entries: []Entry{
+				{Date: day(2024, 3, 5), Text: "deadlift 1x5 140kg\nfelt strong"},
+				{Date: day(2024, 3, 11), Text: "pullups 3x8"},
+			},
+		},
+		{
+			name:    "text before the first date is skipped",
+			file:    "log.txt",
+			text:    "Training log\r\n2024-03-01\r\nbench 3x5\r\n",
+			entries: []Entry{{Date: day(2024, 3, 1), Text: "bench 3x5"}},
+			skipped: "Training log",
+		},
+		{
+			name:    "undated text dated from the file name",
+			file:    "notes/2024-02-28 daily.md",
+			text:    "ran 5k\n",
+			entries: []Entry{{Date: day(2024, 2, 28), Text: "ran 5k"}},
+		},
+		{
+			name:    "empty entries are dropped",
+			file:    "log.txt",
+			text:    "2024-03-01\n\n2024-03-02\nsquat 5x5",
+			entries: []Entry{{Date: day(2024, 3, 2), Text: "squat 5x5"}},
+		},
+		{
+			name:    "future and implausible dates are not headings",
+			file:    "log.txt",
+			text:    "2024-03-01\n2999-01-01 plan\n1900-01-01 history",
+			entries: []Entry{{Date: day(2024, 3, 1), Text: "2999-01-01 plan\n1900-01-01 history"}},
+		},
+		{
+			name:    "no dates",
+			file:    "log.txt",
+			text:    "bench 3x5",
+			entries: []Entry{},
+			skipped: "bench 3x5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, skipped := SplitNotes(tt.file, tt.text, loc)
+			if len(entries) != len(tt.entries) {
+				t.Fatalf("got %d entries, want %d: %+v", len(entries), len(tt.entries), entries)
+			}
+			for i, entry := range entries {
+				if !entry.Date.Equal(tt.entries[i].Date) || entry.Text != tt.entries[i].Text {
+					t.Errorf("entry %d = %v %q, want %v %q", i, entry.Date, entry.Text, tt.entries[i].Date, tt.entries[i].Text)
+				}
+			}
+			if skipped != tt.skipped {
+				t.Errorf("skipped = %q, want %q", skipped, tt.skipped)
+			}
+		})
+	}
+}
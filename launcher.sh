@@ -1,19 +1,35 @@
 #!/bin/sh
-# Number of instances to run
+# Number of instances to run. INSTANCE_COUNT instances serve the API and
+# process jobs; API_INSTANCE_COUNT and WORKER_INSTANCE_COUNT run instances
+# doing only one of them, so each can be scaled on its own.
 INSTANCE_COUNT=${INSTANCE_COUNT:-3}
+API_INSTANCE_COUNT=${API_INSTANCE_COUNT:-0}
+WORKER_INSTANCE_COUNT=${WORKER_INSTANCE_COUNT:-0}
+if [ "$API_INSTANCE_COUNT" -gt 0 ] || [ "$WORKER_INSTANCE_COUNT" -gt 0 ]; then
+  INSTANCE_COUNT=0
+fi
 BASE_PORT=${PORT:-3000}
 
 # Calculate optimal worker count per instance based on available CPUs
 TOTAL_CPUS=$(nproc)
 export BPYP_WORKER_MULTIPLIER=${BPYP_WORKER_MULTIPLIER:-2}
-echo "Starting $INSTANCE_COUNT instances on a $TOTAL_CPUS CPU system with $BPYP_WORKER_MULTIPLIER workers"
+echo "Starting $INSTANCE_COUNT combined, $API_INSTANCE_COUNT API and $WORKER_INSTANCE_COUNT worker instances on a $TOTAL_CPUS CPU system with $BPYP_WORKER_MULTIPLIER workers"
 
-# Launch instances
-for i in $(seq 1 $INSTANCE_COUNT); do
-  export PORT=$(($BASE_PORT + $i - 1))
-  echo "Starting instance $i on port $PORT"
-  ./server &
-done
+# Launch instances on consecutive ports; worker instances serve only their
+# health and metrics on theirs
+NEXT_PORT=$BASE_PORT
+launch() {
+  MODE=$1
+  COUNT=$2
+  for i in $(seq 1 $COUNT); do
+    echo "Starting $MODE instance $i on port $NEXT_PORT"
+    PORT=$NEXT_PORT ./server --mode=$MODE &
+    NEXT_PORT=$(($NEXT_PORT + 1))
+  done
+}
+launch all $INSTANCE_COUNT
+launch api $API_INSTANCE_COUNT
+launch worker $WORKER_INSTANCE_COUNT
 
 # Wait for all background processes
-wait
\ No newline at end of file
+wait
@@ -2,10 +2,8 @@ package o4mini
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	"github.com/tmc/langchaingo/llms"
@@ -13,89 +11,186 @@ import (
 	"noerkrieg.com/server/redis_repository"
 )
 
-func ProcessMessage(message string) ([]Exercise, error) {
-	ctx := context.Background()
-	llm, err := openai.New(openai.WithModel("gpt-4.1-nano"), openai.WithResponseFormat(&openai.ResponseFormat{Type: "json_object"}))
+// Model is the OpenAI model used for extraction
+var Model = "gpt-4.1-nano"
+
+// Request is a message to extract exercises from
+type Request struct {
+	Message string
+	// Key assigns the request to a prompt variant, so that retries of the
+	// same job always use the same prompt
+	Key string
+	// History holds the user's recent exercises, for messages that refer to
+	// earlier workouts. It is only sent to the model when set.
+	History []Exercise
+	// Now is when the message was sent, in the user's time zone, for
+	// resolving relative times and days against History
+	Now time.Time
+	// Custom holds the user's own exercises and attributes, known only when
+	// parsing their messages
+	Custom *redis_repository.ExerciseContext
+}
+
+// Catalog returns the known exercises and attributes the request is parsed
+// with: the catalog's, and the user's own
+func (req Request) Catalog() *redis_repository.ExerciseContext {
+	return MergeContexts(KnownExercises.Context(), req.Custom)
+}
+
+// Result is the outcome of an extraction. Usage is set whenever the model was
+// called, including when its response could not be parsed.
+type Result struct {
+	Exercises     []Exercise
+	Usage         *Usage
+	PromptVersion string
+}
+
+// Extractor turns a message into exercises. Implementations return a non-nil
+// Result even on error, so usage can be recorded for failed calls.
+type Extractor interface {
+	Extract(ctx context.Context, req Request) (*Result, error)
+}
+
+// LLMExtractor extracts exercises by prompting a language model
+type LLMExtractor struct {
+	model     llms.Model
+	modelName string
+}
+
+// NewLLMExtractor returns an extractor prompting model, priced as modelName
+func NewLLMExtractor(model llms.Model, modelName string) *LLMExtractor {
+	return &LLMExtractor{model: model, modelName: modelName}
+}
+
+// NewOpenAIExtractor returns an extractor using the OpenAI Model
+func NewOpenAIExtractor() (*LLMExtractor, error) {
+	llm, err := openai.New(openai.WithModel(Model))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	// Get context from Redis
-	redisContext := redis_repository.CachedExercises
-	exerciseContext := fmt.Sprintf("KNOWN EXERCISES: %s\nKNOWN ATTRIBUTES: %s\n\n",
-		strings.Join(redisContext.Exercises, ", "),
-		strings.Join(redisContext.Attributes, ", "))
-
-	prompt := `You are a workout analyzer AI that extracts and structures workout information from user messages.
-
-TASK:
-Parse the message below and identify all exercises mentioned. Map exercise names and attributes to the known values provided below when possible. Return ONLY a JSON array of exercise objects that follow the schema specified below.
-
-` + exerciseContext + `INPUT MESSAGE:
-` + message + `
-
-RESPONSE FORMAT:
-Return ONLY a valid JSON object containing an array of exercise objects with the following structure:
-{ 
-	"response": [
-		{
-			"exercise_name": "Name of the exercise",
-			"summary": "Brief description if available",
-			"type": "strength, cardio, flexibility, etc.",
-			"sets": number of sets if applicable,
-			"work": numeric quantity of work (reps, distance, etc.),
-			"work_type": "repetitions", "miles", "kilometers", etc.,
-			"resistance": amount of resistance if applicable,
-			"resistance_type": "pounds", "kilograms", "bodyweight", etc.,
-			"duration": duration in minutes if applicable,
-			"attributes": ["any", "relevant", "tags"],
-			"created_ts": "current timestamp in ISO format"
+	return NewLLMExtractor(llm, Model), nil
+}
+
+// NewExtractor returns the OpenAI extractor, wrapped in a cassette stored in
+// cassetteDir when cassetteMode is record or replay. Replaying needs no
+// OpenAI credentials.
+func NewExtractor(cassetteMode string, cassetteDir string) (*LLMExtractor, error) {
+	if cassetteMode == "" {
+		return NewOpenAIExtractor()
+	}
+
+	var model llms.Model
+	if cassetteMode == CassetteRecord {
+		extractor, err := NewOpenAIExtractor()
+		if err != nil {
+			return nil, err
 		}
-	]
-} 
-
-RULES:
-1. Only include fields that are explicitly mentioned in the message
-2. Return an empty array if no exercises are detected
-3. Be precise about extracting the exact exercise names and details
-4. The response must be ONLY the JSON array with no additional text or explanations
-5. Use null for missing optional values, do not include empty strings
-6. Make educated inferences only when the data strongly implies certain values
-7. Always return an array of JSON objects, even if the array only contains a single item
-8. Convert all numbers into their numeric articulation (thirty should be converted to 30)
-9. Always standardize to full, plural spelling of a measurement (lb -> pounds), (sec->seconds)
-10. When possible, map exercise names and attributes names to the known values provided in the context above.
-11. When it is not possible to map exercise/attribute names, always map input values to pluralized format with proper-noun capitalization (e.g. "Curls" or "Rows")
-12. Take care with the attributes. False positive matches are worse than false negatives. We do not want exercises to have unrelated attributes to them.
-`
-
-	completion, err := llms.GenerateFromSinglePrompt(ctx, llm, prompt)
-	log.Printf("Completed Prompt:%v", completion)
+		model = extractor.model
+	}
+	cassette, err := NewCassette(model, Model, cassetteDir, cassetteMode)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("LLM calls use the cassette in %s in %s mode", cassetteDir, cassetteMode)
+	return NewLLMExtractor(cassette, Model), nil
+}
+
+// ProcessMessage extracts exercises from a message with the OpenAI extractor.
+// The returned Result is never nil, so usage can be recorded for failed calls.
+func ProcessMessage(req Request) (*Result, error) {
+	extractor, err := NewOpenAIExtractor()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return extractor.Extract(context.Background(), req)
+}
+
+// Extract prompts the model with the message and the relevant known
+// exercises, forcing it to answer through the extraction tool, and parses its
+// response. Output failing validation is reprompted once with the error.
+func (e *LLMExtractor) Extract(ctx context.Context, req Request) (*Result, error) {
+	result := &Result{}
+	// Get context from the catalog, keeping only the names relevant to this message
+	known := req.Catalog()
+	redisContext := SelectContext(req.Message, known, ContextSelection)
+	log.Printf("Selected %d of %d known exercises and %d of %d known attributes",
+		len(redisContext.Exercises), len(known.Exercises),
+		len(redisContext.Attributes), len(known.Attributes))
+
+	now := req.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	result.PromptVersion = Prompts.Choose(req.Key)
+	prompt, err := Prompts.Render(result.PromptVersion, PromptData{
+		Message:    req.Message,
+		Exercises:  redisContext.Exercises,
+		Attributes: redisContext.Attributes,
+		History:    HistoryLines(req.History, now.Location()),
+		Now:        now.Format("Monday 2006-01-02 15:04 MST (-07:00)"),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("could not generate json from prompt %v", err)
+		return result, err
 	}
-	var exercises Output
-	if err := json.Unmarshal([]byte(completion), &exercises); err != nil {
-		return nil, fmt.Errorf("could not marshal json %v", err)
 
+	result.Usage = &Usage{Model: e.modelName}
+	attempt := prompt
+	for try := 0; ; try++ {
+		log.Printf("Sending prompt of %d tokens", CountTokens(attempt))
+		response, err := e.model.GenerateContent(ctx, []llms.MessageContent{
+			llms.TextParts(llms.ChatMessageTypeHuman, attempt),
+		}, extractionCall()...)
+		if err != nil {
+			return result, fmt.Errorf("could not generate json from prompt %v", err)
+		}
+		if len(response.Choices) == 0 {
+			return result, fmt.Errorf("could not generate json from prompt: empty response")
+		}
+		completion := completionOf(response.Choices[0])
+		log.Printf("Completed Prompt:%v", completion)
+		result.Usage.Add(newUsage(e.modelName, attempt, completion, response.Choices[0].GenerationInfo))
+		log.Printf("LLM usage: prompt=%d, completion=%d, cost=$%.6f, prompt version=%s",
+			result.Usage.PromptTokens, result.Usage.CompletionTokens, result.Usage.CostUSD, result.PromptVersion)
+
+		result.Exercises, err = ParseCompletion(completion)
+		if err == nil || try == 1 {
+			return result, err
+		}
+		// Give the model one chance to fix output that failed validation
+		log.Printf("Invalid completion, reprompting: %v", err)
+		attempt = repairPrompt(prompt, completion, err)
 	}
-	return exercises.Response, nil
 }
 
 // Output exercise schema
 type Exercise struct {
-	Exercise       string    `json:"exercise_name"`
-	Summary        string    `json:"summary,omitempty"`
-	Type           string    `json:"type,omitempty"`
-	Sets           float64   `json:"sets,omitempty"`
-	Quantity       float64   `json:"work,omitempty"`
-	QuantityType   string    `json:"work_type,omitempty"`
-	Resistance     float64   `json:"resistance,omitempty"`
-	ResistanceType string    `json:"resistance_type,omitempty"`
-	Duration       float64   `json:"duration,omitempty"`
-	Attributes     []string  `json:"attributes,omitempty"`
-	UserId         string    `json:"user_id,omitempty"`
-	Timestamp      time.Time `json:"created_ts"`
-	Id             string    `json:"id,omitempty"`
+	Exercise       string             `json:"exercise_name"`
+	RawName        string             `json:"raw_exercise_name,omitempty"` // The name as extracted, before it was resolved to the catalog
+	Summary        string             `json:"summary,omitempty"`
+	Type           string             `json:"type,omitempty"`
+	Sets           float64            `json:"sets,omitempty"`
+	Quantity       float64            `json:"work,omitempty"`
+	QuantityType   string             `json:"work_type,omitempty"`
+	Resistance     float64            `json:"resistance,omitempty"`
+	ResistanceType string             `json:"resistance_type,omitempty"`
+	Duration       float64            `json:"duration,omitempty"`
+	Attributes     []string           `json:"attributes,omitempty"`
+	UserId         string             `json:"user_id,omitempty"`
+	Timestamp      time.Time          `json:"created_ts"`
+	PerformedAt    *time.Time         `json:"performed_at,omitempty"` // When the exercise was done, if the message says
+	Id             string             `json:"id,omitempty"`
+	Metrics        map[string]float64 `json:"metrics,omitempty"`     // Measurements without a column, such as pace and elevation
+	SetDetails     []ExerciseSet      `json:"set_details,omitempty"` // Individual sets, from which Sets, Quantity and Resistance are derived
+	Group          int                `json:"group,omitempty"`       // Shared by exercises performed together as a superset or circuit
+	WorkoutID      string             `json:"workout_id,omitempty"`
+	Position       int                `json:"position,omitempty"` // Order of the exercise in its workout
+
+	// Units the resistance and work were logged in, before they were stored in SI units
+	OriginalResistanceType string `json:"original_resistance_type,omitempty"`
+	OriginalWorkType       string `json:"original_work_type,omitempty"`
+
+	// Identity of the export row an imported exercise came from
+	ImportKey string `json:"import_key,omitempty"`
 }
 
 type Output struct {
@@ -0,0 +1,158 @@
+package o4mini
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"noerkrieg.com/server/redis_repository"
+)
+
+// DefaultCacheTTL is how long cached extractions are reused
+const DefaultCacheTTL = 7 * 24 * time.Hour
+
+// ResponseCache stores serialized extractions by key until they expire
+type ResponseCache interface {
+	// Get returns the value stored under key, and false when there is none
+	// or it has expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// CacheStats counts cache lookups
+type CacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// CachingExtractor answers repeated messages from a cache and only calls the
+// wrapped extractor on a miss. Entries are keyed by the normalized message,
+// a hash of the prompt template and the exercise catalog version, so editing
+// the prompt or the catalog never serves stale extractions. Messages sent with
+// history are also keyed by the day they were sent and the history they refer
+// to, and messages with relative times by the minute they were sent.
+type CachingExtractor struct {
+	extractor Extractor
+	cache     ResponseCache
+	ttl       time.Duration
+	hits      atomic.Int64
+	misses    atomic.Int64
+}
+
+// cachedExtraction is the cached part of a Result. Usage is not cached, since
+// a hit costs nothing.
+type cachedExtraction struct {
+	Exercises     []Exercise `json:"exercises"`
+	PromptVersion string     `json:"prompt_version"`
+}
+
+// NewCachingExtractor puts cache in front of extractor, keeping entries for ttl
+func NewCachingExtractor(extractor Extractor, cache ResponseCache, ttl time.Duration) *CachingExtractor {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &CachingExtractor{extractor: extractor, cache: cache, ttl: ttl}
+}
+
+// Extract returns the cached extraction for the message if there is one, and
+// otherwise extracts it and caches successful results. Cache errors are
+// logged and treated as misses.
+func (c *CachingExtractor) Extract(ctx context.Context, req Request) (*Result, error) {
+	promptVersion := Prompts.Choose(req.Key)
+	contextVersion := CatalogVersion(req.Catalog())
+	if RefersToTime(req.Message) {
+		// Relative times resolve to an absolute performed_at, which is only
+		// reusable for a message sent the same minute
+		contextVersion += "|" + req.Now.Format("2006-01-02 15:04 -07:00") + "|" + HistoryVersion(req.History)
+	} else if len(req.History) > 0 {
+		// Messages referring to earlier workouts resolve differently as the
+		// day and history change
+		contextVersion += "|" + req.Now.Format("2006-01-02 -07:00") + "|" + HistoryVersion(req.History)
+	}
+	key := CacheKey(req.Message, Prompts.Fingerprint(promptVersion), contextVersion)
+
+	value, ok, err := c.cache.Get(ctx, key)
+	if err != nil {
+		log.Printf("Error reading LLM cache: %v", err)
+	}
+	if ok {
+		var cached cachedExtraction
+		if err := json.Unmarshal(value, &cached); err == nil {
+			stats := c.hit()
+			log.Printf("LLM cache hit (hits=%d, misses=%d)", stats.Hits, stats.Misses)
+			return &Result{Exercises: cached.Exercises, PromptVersion: cached.PromptVersion}, nil
+		}
+		log.Printf("Ignoring invalid LLM cache entry %s", key)
+	}
+	stats := c.miss()
+	log.Printf("LLM cache miss (hits=%d, misses=%d)", stats.Hits, stats.Misses)
+
+	result, err := c.extractor.Extract(ctx, req)
+	if err != nil {
+		return result, err
+	}
+	value, err = json.Marshal(cachedExtraction{Exercises: result.Exercises, PromptVersion: result.PromptVersion})
+	if err == nil {
+		err = c.cache.Set(ctx, key, value, c.ttl)
+	}
+	if err != nil {
+		log.Printf("Error writing LLM cache: %v", err)
+	}
+	return result, nil
+}
+
+// Stats returns the hit and miss counts since startup
+func (c *CachingExtractor) Stats() CacheStats {
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+func (c *CachingExtractor) hit() CacheStats {
+	c.hits.Add(1)
+	return c.Stats()
+}
+
+func (c *CachingExtractor) miss() CacheStats {
+	c.misses.Add(1)
+	return c.Stats()
+}
+
+// NormalizeMessage lowercases a message and collapses its whitespace, so
+// trivially different spellings of the same message share a cache entry
+func NormalizeMessage(message string) string {
+	return strings.Join(strings.Fields(strings.ToLower(message)), " ")
+}
+
+// CacheKey returns the cache key of a message for a prompt fingerprint and a
+// version of the context it is extracted with
+func CacheKey(message string, prompt string, contextVersion string) string {
+	sum := sha256.Sum256([]byte(NormalizeMessage(message) + "\x00" + prompt + "\x00" + contextVersion))
+	return hex.EncodeToString(sum[:])
+}
+
+// CatalogVersion fingerprints the known exercises, their aliases and the
+// known attributes
+func CatalogVersion(catalog *redis_repository.ExerciseContext) string {
+	if catalog == nil {
+		return ""
+	}
+	exercises := slices.Clone(catalog.Exercises)
+	attributes := slices.Clone(catalog.Attributes)
+	slices.Sort(exercises)
+	slices.Sort(attributes)
+
+	h := sha256.New()
+	h.Write([]byte(strings.Join(exercises, "\n") + "\x00" + strings.Join(attributes, "\n")))
+	// Aliases change which names are selected for a message
+	for _, name := range exercises {
+		if aliases := catalog.Aliases[name]; len(aliases) > 0 {
+			h.Write([]byte("\x00" + name + "=" + strings.Join(aliases, "|")))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
@@ -0,0 +1,54 @@
+package o4mini
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type memoryCache map[string][]byte
+
+func (m memoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	value, ok := m[key]
+	return value, ok, nil
+}
+
+func (m memoryCache) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	m[key] = value
+	return nil
+}
+
+type countingExtractor struct{ calls int }
+
+func (e *countingExtractor) Extract(context.Context, Request) (*Result, error) {
+	e.calls++
+	return &Result{Exercises: []Exercise{{Exercise: "Bench Press"}}}, nil
+}
+
+func TestCachingExtractorRelativeTimes(t *testing.T) {
+	sent := time.Date(2026, 3, 14, 18, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		message string
+		later   time.Time
+		want    int
+	}{
+		{name: "absolute, same day", message: "bench 3x5 100kg", later: sent.Add(2 * time.Hour), want: 1},
+		{name: "relative, same minute", message: "bench 3x5 100kg an hour ago", later: sent.Add(20 * time.Second), want: 1},
+		{name: "relative, later that day", message: "bench 3x5 100kg an hour ago", later: sent.Add(2 * time.Hour), want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor := &countingExtractor{}
+			caching := NewCachingExtractor(extractor, memoryCache{}, time.Hour)
+			for _, now := range []time.Time{sent, tt.later} {
+				if _, err := caching.Extract(context.Background(), Request{Message: tt.message, Now: now}); err != nil {
+					t.Fatalf("Extract: %v", err)
+				}
+			}
+			if extractor.calls != tt.want {
+				t.Errorf("extractor called %d times, want %d", extractor.calls, tt.want)
+			}
+		})
+	}
+}
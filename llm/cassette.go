@@ -0,0 +1,199 @@
+package o4mini
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Cassette modes
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// Cassette wraps a model to record its responses to disk, keyed by a hash of
+// the prompt, or to replay recorded responses without calling the model. In
+// replay mode a prompt with no recording is an error, so tests fail loudly
+// when a prompt change invalidates the fixtures. Call options are not part
+// of the key.
+type Cassette struct {
+	model llms.Model
+	name  string
+	dir   string
+	mode  string
+}
+
+// recording is the on-disk form of one model response
+type recording struct {
+	Model   string            `json:"model"`
+	Prompt  []recordedMessage `json:"prompt"`
+	Choices []*recordedChoice `json:"choices"`
+}
+
+type recordedMessage struct {
+	Role  string   `json:"role"`
+	Parts []string `json:"parts"`
+}
+
+type recordedChoice struct {
+	Content          string             `json:"content"`
+	StopReason       string             `json:"stop_reason,omitempty"`
+	PromptTokens     int                `json:"prompt_tokens,omitempty"`
+	CompletionTokens int                `json:"completion_tokens,omitempty"`
+	ToolCalls        []recordedToolCall `json:"tool_calls,omitempty"`
+}
+
+// recordedToolCall is the on-disk form of a tool call, as llms.ToolCall does
+// not decode the JSON it encodes to
+type recordedToolCall struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// NewCassette wraps model, identified by name in the key, with a cassette
+// stored in dir. model may be nil in replay mode.
+func NewCassette(model llms.Model, name string, dir string, mode string) (*Cassette, error) {
+	if mode != CassetteRecord && mode != CassetteReplay {
+		return nil, fmt.Errorf("unknown cassette mode %q", mode)
+	}
+	if mode == CassetteRecord {
+		if model == nil {
+			return nil, fmt.Errorf("cassette needs a model to record")
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("could not create cassette directory: %w", err)
+		}
+	}
+	return &Cassette{model: model, name: name, dir: dir, mode: mode}, nil
+}
+
+// GenerateContent replays the recorded response to messages, or calls the
+// model and records its response
+func (c *Cassette) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	prompt := promptOf(messages)
+	key, err := c.key(prompt)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(c.dir, key+".json")
+
+	if c.mode == CassetteReplay {
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("cassette has no recording for prompt %s in %s, record it with mode %q",
+				key, c.dir, CassetteRecord)
+		} else if err != nil {
+			return nil, err
+		}
+		var rec recording
+		if err := json.Unmarshal(content, &rec); err != nil {
+			return nil, fmt.Errorf("invalid cassette recording %s: %w", path, err)
+		}
+		return rec.response(), nil
+	}
+
+	response, err := c.model.GenerateContent(ctx, messages, options...)
+	if err != nil {
+		return nil, err
+	}
+	rec := recording{Model: c.name, Prompt: prompt}
+	for _, choice := range response.Choices {
+		recorded := &recordedChoice{
+			Content:    choice.Content,
+			StopReason: choice.StopReason,
+		}
+		for _, call := range choice.ToolCalls {
+			if call.FunctionCall == nil {
+				continue
+			}
+			recorded.ToolCalls = append(recorded.ToolCalls, recordedToolCall{
+				ID:        call.ID,
+				Type:      call.Type,
+				Name:      call.FunctionCall.Name,
+				Arguments: call.FunctionCall.Arguments,
+			})
+		}
+		recorded.PromptTokens, _ = choice.GenerationInfo["PromptTokens"].(int)
+		recorded.CompletionTokens, _ = choice.GenerationInfo["CompletionTokens"].(int)
+		rec.Choices = append(rec.Choices, recorded)
+	}
+	content, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return nil, fmt.Errorf("could not write cassette recording: %w", err)
+	}
+	log.Printf("Recorded LLM response %s", key)
+	return response, nil
+}
+
+// Call implements the deprecated single prompt interface on GenerateContent
+func (c *Cassette) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, c, prompt, options...)
+}
+
+// key hashes the model name and prompt
+func (c *Cassette) key(prompt []recordedMessage) (string, error) {
+	content, err := json.Marshal(struct {
+		Model  string            `json:"model"`
+		Prompt []recordedMessage `json:"prompt"`
+	}{c.name, prompt})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (r recording) response() *llms.ContentResponse {
+	response := &llms.ContentResponse{}
+	for _, choice := range r.Choices {
+		var calls []llms.ToolCall
+		for _, call := range choice.ToolCalls {
+			calls = append(calls, llms.ToolCall{
+				ID:           call.ID,
+				Type:         call.Type,
+				FunctionCall: &llms.FunctionCall{Name: call.Name, Arguments: call.Arguments},
+			})
+		}
+		response.Choices = append(response.Choices, &llms.ContentChoice{
+			Content:    choice.Content,
+			StopReason: choice.StopReason,
+			ToolCalls:  calls,
+			GenerationInfo: map[string]any{
+				"PromptTokens":     choice.PromptTokens,
+				"CompletionTokens": choice.CompletionTokens,
+			},
+		})
+	}
+	return response
+}
+
+// promptOf flattens messages into their recorded form
+func promptOf(messages []llms.MessageContent) []recordedMessage {
+	prompt := make([]recordedMessage, 0, len(messages))
+	for _, message := range messages {
+		recorded := recordedMessage{Role: string(message.Role)}
+		for _, part := range message.Parts {
+			switch p := part.(type) {
+			case llms.TextContent:
+				recorded.Parts = append(recorded.Parts, p.Text)
+			default:
+				recorded.Parts = append(recorded.Parts, fmt.Sprintf("%v", p))
+			}
+		}
+		prompt = append(prompt, recorded)
+	}
+	return prompt
+}
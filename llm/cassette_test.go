@@ -0,0 +1,135 @@
+package o4mini
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"noerkrieg.com/server/redis_repository"
+)
+
+// cassetteDir holds the recordings replayed by the tests. Their keys hash the
+// rendered prompt, so changing the prompt template means recording them again.
+const cassetteDir = "testdata/cassettes"
+
+// fixedCatalog is a catalog that never changes under the recordings
+type fixedCatalog struct {
+	known *redis_repository.ExerciseContext
+}
+
+func (c fixedCatalog) Context() *redis_repository.ExerciseContext {
+	return c.known
+}
+
+// useFixedPrompt pins what the recorded prompts are rendered from: the
+// catalog, the default prompt version and its experiment, as the worker
+// configures them at startup
+func useFixedPrompt(t *testing.T, known *redis_repository.ExerciseContext) {
+	catalog, prompts := KnownExercises, *Prompts
+	t.Cleanup(func() {
+		KnownExercises = catalog
+		Prompts.Default, Prompts.Experiment, Prompts.ExperimentPercent = prompts.Default, prompts.Experiment, prompts.ExperimentPercent
+	})
+	UseCatalog(fixedCatalog{known: known})
+	Prompts.Default, Prompts.Experiment, Prompts.ExperimentPercent = DefaultPromptVersion, "", 0
+}
+
+// cassetteRequest is the request a worker builds for a message job, with a
+// fixed job ID and send time
+func cassetteRequest(message string) Request {
+	return Request{
+		Message: message,
+		Key:     "6f1c2e0a-3b7d-4c55-9a41-0d2f8e6b7c13",
+		Now:     time.Date(2026, 3, 2, 18, 30, 0, 0, time.UTC),
+	}
+}
+
+var cassetteCatalog = &redis_repository.ExerciseContext{
+	Exercises:  []string{"Bench Press", "Incline Bench Press", "Back Squat", "Romanian Deadlift"},
+	Attributes: []string{"Paused", "Incline"},
+	Aliases:    map[string][]string{"Romanian Deadlift": {"RDL"}},
+}
+
+func TestExtractReplaysCassette(t *testing.T) {
+	useFixedPrompt(t, cassetteCatalog)
+	extractor, err := NewExtractor(CassetteReplay, cassetteDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := extractor.Extract(context.Background(), cassetteRequest("bench 3x5 at 100kg, then rdl 3x8 at 80kg"))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if result.PromptVersion != DefaultPromptVersion {
+		t.Errorf("prompt version = %q, want %q", result.PromptVersion, DefaultPromptVersion)
+	}
+	if result.Usage == nil || result.Usage.PromptTokens == 0 {
+		t.Errorf("usage = %+v, want the recorded token counts", result.Usage)
+	}
+	want := []Exercise{
+		{Exercise: "Bench Press", Sets: 3, Quantity: 5, QuantityType: "repetitions", Resistance: 100, ResistanceType: "kilograms"},
+		{Exercise: "Romanian Deadlift", Sets: 3, Quantity: 8, QuantityType: "repetitions", Resistance: 80, ResistanceType: "kilograms"},
+	}
+	if len(result.Exercises) != len(want) {
+		t.Fatalf("got %d exercises, want %d: %+v", len(result.Exercises), len(want), result.Exercises)
+	}
+	for i, ex := range result.Exercises {
+		w := want[i]
+		if ex.Exercise != w.Exercise || ex.Sets != w.Sets || ex.Quantity != w.Quantity || ex.QuantityType != w.QuantityType ||
+			ex.Resistance != w.Resistance || ex.ResistanceType != w.ResistanceType {
+			t.Errorf("exercise %d = %+v, want %+v", i, ex, w)
+		}
+	}
+}
+
+func TestCassetteKeyDependsOnRenderedPrompt(t *testing.T) {
+	message := "bench 3x5 at 100kg, then rdl 3x8 at 80kg"
+	tests := []struct {
+		name       string
+		catalog    *redis_repository.ExerciseContext
+		req        Request
+		experiment bool
+	}{
+		{
+			name:    "another catalog",
+			catalog: &redis_repository.ExerciseContext{Exercises: []string{"Bench Press"}},
+			req:     cassetteRequest(message),
+		},
+		{
+			name:    "another send time",
+			catalog: cassetteCatalog,
+			req: Request{
+				Message: message,
+				Key:     cassetteRequest(message).Key,
+				Now:     time.Date(2026, 3, 3, 18, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:       "job in the prompt experiment",
+			catalog:    cassetteCatalog,
+			req:        cassetteRequest(message),
+			experiment: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFixedPrompt(t, tt.catalog)
+			if tt.experiment {
+				Prompts.templates["experiment"] = template.Must(template.New("experiment").Parse("Extract the exercises in: {{.Message}}"))
+				t.Cleanup(func() { delete(Prompts.templates, "experiment") })
+				Prompts.Experiment, Prompts.ExperimentPercent = "experiment", 100
+			}
+			extractor, err := NewExtractor(CassetteReplay, cassetteDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = extractor.Extract(context.Background(), tt.req)
+			if err == nil || !strings.Contains(err.Error(), "cassette has no recording") {
+				t.Errorf("err = %v, want a missing recording", err)
+			}
+		})
+	}
+}
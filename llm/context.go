@@ -0,0 +1,185 @@
+package o4mini
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"noerkrieg.com/server/redis_repository"
+)
+
+// ContextOptions bounds the known exercises and attributes sent with a prompt
+type ContextOptions struct {
+	// TopN is the most candidates kept from each of the exercise and attribute lists
+	TopN int
+	// TokenBudget is the most tokens spent on candidate names across both lists
+	TokenBudget int
+	// MinScore is the lowest trigram similarity for a name to be considered relevant
+	MinScore float64
+}
+
+// ContextSelection is the selection applied by ProcessMessage
+var ContextSelection = ContextOptions{TopN: 30, TokenBudget: 400, MinScore: 0.6}
+
+// Catalog supplies the known exercises and attributes prompts are built with
+type Catalog interface {
+	Context() *redis_repository.ExerciseContext
+}
+
+// emptyCatalog knows no exercises, for extraction without a catalog
+type emptyCatalog struct{}
+
+func (emptyCatalog) Context() *redis_repository.ExerciseContext {
+	return &redis_repository.ExerciseContext{Exercises: []string{}, Attributes: []string{}}
+}
+
+// KnownExercises is the catalog used by ProcessMessage, empty until set with
+// UseCatalog
+var KnownExercises Catalog = emptyCatalog{}
+
+// UseCatalog sets the catalog prompts are built with
+func UseCatalog(catalog Catalog) {
+	KnownExercises = catalog
+}
+
+// MergeContexts returns the known exercises and attributes of catalog with
+// those of custom added, leaving both unchanged. Custom names already in the
+// catalog, regardless of case, only add their aliases.
+func MergeContexts(catalog *redis_repository.ExerciseContext, custom *redis_repository.ExerciseContext) *redis_repository.ExerciseContext {
+	if custom == nil || len(custom.Exercises) == 0 && len(custom.Attributes) == 0 {
+		return catalog
+	}
+	merged := &redis_repository.ExerciseContext{
+		Exercises:  slices.Clone(catalog.Exercises),
+		Attributes: slices.Clone(catalog.Attributes),
+		Aliases:    maps.Clone(catalog.Aliases),
+	}
+	if merged.Aliases == nil {
+		merged.Aliases = map[string][]string{}
+	}
+	for _, name := range custom.Exercises {
+		aliases := custom.Aliases[name]
+		if i := slices.IndexFunc(merged.Exercises, func(known string) bool { return strings.EqualFold(known, name) }); i >= 0 {
+			name = merged.Exercises[i]
+		} else {
+			merged.Exercises = append(merged.Exercises, name)
+		}
+		if len(aliases) > 0 {
+			merged.Aliases[name] = slices.Concat(merged.Aliases[name], aliases)
+		}
+	}
+	for _, name := range custom.Attributes {
+		if !slices.ContainsFunc(merged.Attributes, func(known string) bool { return strings.EqualFold(known, name) }) {
+			merged.Attributes = append(merged.Attributes, name)
+		}
+	}
+	return merged
+}
+
+type candidate struct {
+	name      string
+	attribute bool
+	score     float64
+}
+
+// SelectContext picks the known exercise and attribute names most similar to
+// the message, so the prompt stays bounded as the catalog grows. Names are
+// ranked by how many of their trigrams appear in the message and added in
+// rank order until the token budget is spent.
+func SelectContext(message string, known *redis_repository.ExerciseContext, opts ContextOptions) *redis_repository.ExerciseContext {
+	selected := &redis_repository.ExerciseContext{Exercises: []string{}, Attributes: []string{}}
+	if known == nil {
+		return selected
+	}
+
+	grams := trigrams(message)
+	candidates := append(rank(known.Exercises, known.Aliases, false, grams, opts), rank(known.Attributes, nil, true, grams, opts)...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	spent := 0
+	for _, c := range candidates {
+		// Each name costs its own tokens plus the ", " separator
+		cost := CountTokens(c.name) + 1
+		if opts.TokenBudget > 0 && spent+cost > opts.TokenBudget {
+			continue
+		}
+		spent += cost
+		if c.attribute {
+			selected.Attributes = append(selected.Attributes, c.name)
+		} else {
+			selected.Exercises = append(selected.Exercises, c.name)
+		}
+	}
+	return selected
+}
+
+// rank scores names, or their best matching alias, against the message
+// trigrams and keeps the best TopN that reach MinScore
+func rank(names []string, aliases map[string][]string, attribute bool, grams map[string]bool, opts ContextOptions) []candidate {
+	ranked := make([]candidate, 0, len(names))
+	for _, name := range names {
+		score := similarity(name, grams)
+		for _, alias := range aliases[name] {
+			score = max(score, similarity(alias, grams))
+		}
+		if score >= opts.MinScore {
+			ranked = append(ranked, candidate{name: name, attribute: attribute, score: score})
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].name < ranked[j].name
+	})
+	if opts.TopN > 0 && len(ranked) > opts.TopN {
+		ranked = ranked[:opts.TopN]
+	}
+	return ranked
+}
+
+// similarity scores a name by its best matching word, so "Bench Presses"
+// matches "bench" strongly, with the share of all of the name's trigrams found
+// in the message breaking ties. Only the name's trigrams are counted, so long
+// messages are not penalized.
+func similarity(name string, messageGrams map[string]bool) float64 {
+	best := 0.0
+	for _, word := range strings.Fields(name) {
+		best = max(best, containment(trigrams(word), messageGrams))
+	}
+	return 0.8*best + 0.2*containment(trigrams(name), messageGrams)
+}
+
+// containment is the share of grams present in messageGrams
+func containment(grams map[string]bool, messageGrams map[string]bool) float64 {
+	if len(grams) == 0 {
+		return 0
+	}
+	found := 0
+	for gram := range grams {
+		if messageGrams[gram] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(grams))
+}
+
+// trigrams returns the set of three-letter sequences of each word, padded the
+// way pg_trgm pads them so short words and word boundaries still match
+func trigrams(text string) map[string]bool {
+	grams := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			grams[string(padded[i:i+3])] = true
+		}
+	}
+	return grams
+}
@@ -0,0 +1,108 @@
+package o4mini
+
+import (
+	"slices"
+	"testing"
+
+	"noerkrieg.com/server/redis_repository"
+)
+
+// cost is the budget a name takes in the selected context
+func cost(names ...string) int {
+	total := 0
+	for _, name := range names {
+		total += CountTokens(name) + 1
+	}
+	return total
+}
+
+func TestSelectContext(t *testing.T) {
+	known := &redis_repository.ExerciseContext{
+		Exercises: []string{"Bench Press", "Incline Bench Press", "Dumbbell Curl", "Back Squat",
+			"Deadlift", "Romanian Deadlift", "Pull-Up", "Overhead Press"},
+		Attributes: []string{"Incline", "Paused", "Tempo", "Close Grip"},
+		Aliases:    map[string][]string{"Romanian Deadlift": {"RDL"}},
+	}
+	unbounded := ContextOptions{MinScore: 0.6}
+
+	tests := []struct {
+		name       string
+		message    string
+		opts       ContextOptions
+		exercises  []string
+		attributes []string
+	}{
+		{
+			name:       "relevant names",
+			message:    "3x5 bench press at 100kg then incline db curls",
+			opts:       ContextSelection,
+			exercises:  []string{"Bench Press", "Incline Bench Press", "Overhead Press", "Dumbbell Curl"},
+			attributes: []string{"Incline"},
+		},
+		{
+			name:       "aliases match",
+			message:    "rdl 3x8 and some paused squats",
+			opts:       unbounded,
+			exercises:  []string{"Romanian Deadlift", "Back Squat"},
+			attributes: []string{"Paused"},
+		},
+		{
+			name:       "top n of each list",
+			message:    "3x5 bench press at 100kg then incline db curls",
+			opts:       ContextOptions{TopN: 1, MinScore: 0.6},
+			exercises:  []string{"Bench Press"},
+			attributes: []string{"Incline"},
+		},
+		{
+			name:       "min score",
+			message:    "3x5 bench press at 100kg then incline db curls",
+			opts:       ContextOptions{MinScore: 0.9},
+			exercises:  []string{"Bench Press", "Incline Bench Press"},
+			attributes: []string{"Incline"},
+		},
+		{
+			name:       "token budget keeps the best names",
+			message:    "rdl 3x8 and some paused squats",
+			opts:       ContextOptions{TokenBudget: cost("Romanian Deadlift", "Paused"), MinScore: 0.6},
+			exercises:  []string{"Romanian Deadlift"},
+			attributes: []string{"Paused"},
+		},
+		{
+			name:       "token budget too small for any name",
+			message:    "rdl 3x8 and some paused squats",
+			opts:       ContextOptions{TokenBudget: 1, MinScore: 0.6},
+			exercises:  []string{},
+			attributes: []string{},
+		},
+		{
+			name:       "nothing relevant",
+			message:    "ran 5k",
+			opts:       ContextSelection,
+			exercises:  []string{},
+			attributes: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected := SelectContext(tt.message, known, tt.opts)
+			if !slices.Equal(selected.Exercises, tt.exercises) {
+				t.Errorf("exercises = %v, want %v", selected.Exercises, tt.exercises)
+			}
+			if !slices.Equal(selected.Attributes, tt.attributes) {
+				t.Errorf("attributes = %v, want %v", selected.Attributes, tt.attributes)
+			}
+			if tt.opts.TokenBudget > 0 {
+				if spent := cost(slices.Concat(selected.Exercises, selected.Attributes)...); spent > tt.opts.TokenBudget {
+					t.Errorf("spent %d tokens, over the budget of %d", spent, tt.opts.TokenBudget)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectContextWithoutCatalog(t *testing.T) {
+	selected := SelectContext("bench press", nil, ContextSelection)
+	if len(selected.Exercises) != 0 || len(selected.Attributes) != 0 {
+		t.Errorf("got %v %v, want an empty context", selected.Exercises, selected.Attributes)
+	}
+}
@@ -0,0 +1,101 @@
+package o4mini
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryDays is how far back recent exercises are given to the model for
+// messages that refer to earlier workouts
+const HistoryDays = 14
+
+// HistoryLimit caps the number of recent exercises in the prompt
+const HistoryLimit = 60
+
+// referencePattern matches wording that refers to earlier workouts, such as
+// "same as last Tuesday", "repeat yesterday" or "add 5 lb to last week"
+var referencePattern = regexp.MustCompile(`(?i)\b(same|again|repeat(ed)?|previous|last|yesterday|usual|like (on|before)|as before|more than|less than)\b|[+-]\s*\d`)
+
+// NeedsHistory reports whether a message refers to earlier workouts and so
+// needs the user's recent exercises to be resolved
+func NeedsHistory(message string) bool {
+	return referencePattern.MatchString(message)
+}
+
+// HistoryLines formats recent exercises for the prompt, one per line, with
+// the day they were performed in loc
+func HistoryLines(history []Exercise, loc *time.Location) []string {
+	if loc == nil {
+		loc = time.UTC
+	}
+	lines := make([]string, 0, len(history))
+	for _, ex := range history {
+		performed := ex.Timestamp
+		if ex.PerformedAt != nil {
+			performed = *ex.PerformedAt
+		}
+		line := performed.In(loc).Format("Mon 2006-01-02") + ": " + ex.Exercise
+		details := []string{}
+		if len(ex.SetDetails) > 0 {
+			sets := make([]string, 0, len(ex.SetDetails))
+			for _, set := range ex.SetDetails {
+				text := formatNumber(set.Load) + "x" + formatNumber(set.Reps)
+				if set.Drop {
+					text += " drop"
+				}
+				sets = append(sets, text)
+			}
+			label := "sets (load x reps)"
+			if ex.ResistanceType != "" {
+				label = "sets (" + ex.ResistanceType + " x reps)"
+			}
+			details = append(details, label+": "+strings.Join(sets, ", "))
+		} else {
+			if ex.Sets > 0 {
+				details = append(details, formatNumber(ex.Sets)+" sets")
+			}
+			if ex.Quantity > 0 {
+				details = append(details, strings.TrimSpace(formatNumber(ex.Quantity)+" "+ex.QuantityType))
+			}
+			if ex.Resistance > 0 {
+				details = append(details, strings.TrimSpace(formatNumber(ex.Resistance)+" "+ex.ResistanceType))
+			} else if ex.ResistanceType != "" {
+				details = append(details, ex.ResistanceType)
+			}
+		}
+		if ex.Duration > 0 {
+			details = append(details, formatNumber(ex.Duration)+" minutes")
+		}
+		if len(ex.Attributes) > 0 {
+			details = append(details, strings.Join(ex.Attributes, ", "))
+		}
+		if len(details) > 0 {
+			line += " (" + strings.Join(details, "; ") + ")"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// HistoryVersion fingerprints the recent exercises a message was resolved
+// against, so cached extractions of relative messages are not reused once
+// the history changes
+func HistoryVersion(history []Exercise) string {
+	if len(history) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, ex := range history {
+		fmt.Fprintf(h, "%s|%s|%d\n", ex.Id, ex.Exercise, ex.Timestamp.Unix())
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,115 @@
+package o4mini
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// nameAbbreviations expands the shorthand lifters write exercise names with
+var nameAbbreviations = map[string]string{
+	"db":   "dumbbell",
+	"bb":   "barbell",
+	"kb":   "kettlebell",
+	"bw":   "bodyweight",
+	"ez":   "ez bar",
+	"ohp":  "overhead press",
+	"rdl":  "romanian deadlift",
+	"sldl": "stiff leg deadlift",
+	"dl":   "deadlift",
+	"bp":   "bench press",
+	"sl":   "single leg",
+	"sa":   "single arm",
+}
+
+// NameKey reduces an exercise or attribute name to a key shared by its
+// spelling variants: lowercased, punctuation dropped, abbreviations expanded
+// and words singularized, so "DB Rows" and "Dumbbell Row" have the same key.
+// An abbreviation followed by the rest of its expansion, as in "EZ Bar Curls",
+// only expands its first word.
+func NameKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = singular(word)
+	}
+	key := make([]string, 0, len(words))
+	for i, word := range words {
+		if expanded, ok := nameAbbreviations[word]; ok {
+			expansion := strings.Fields(expanded)
+			if rest := expansion[1:]; len(rest) > 0 && len(words) > i+len(rest) && slices.Equal(words[i+1:i+1+len(rest)], rest) {
+				expansion = expansion[:1]
+			}
+			key = append(key, expansion...)
+			continue
+		}
+		key = append(key, word)
+	}
+	return strings.Join(key, " ")
+}
+
+// TypoVariants reports whether two names differ only by typos within their
+// words, such as "Dumbell Rows" and "Dumbbell Row", and not by a word naming
+// a different movement, such as "Hack Squat" and "Back Squat"
+func TypoVariants(a string, b string) bool {
+	_, ok := wordTypos(strings.Fields(NameKey(a)), strings.Fields(NameKey(b)))
+	return ok
+}
+
+// singular strips the plural ending of a word, leaving words that only look
+// plural, such as "press", alone
+func singular(word string) string {
+	switch {
+	case len(word) <= 3:
+		// Short words are too ambiguous, except plural abbreviations like "dbs"
+		if strings.HasSuffix(word, "s") {
+			if _, ok := nameAbbreviations[word[:len(word)-1]]; ok {
+				return word[:len(word)-1]
+			}
+		}
+		return word
+	case strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "sses"), strings.HasSuffix(word, "ches"),
+		strings.HasSuffix(word, "shes"), strings.HasSuffix(word, "xes"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+		return word
+	case strings.HasSuffix(word, "s"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// NameSimilarity scores how alike two names are, from 0 to 1, as the Dice
+// coefficient of the trigrams of their keys
+func NameSimilarity(a string, b string) float64 {
+	gramsA, gramsB := trigrams(NameKey(a)), trigrams(NameKey(b))
+	if len(gramsA) == 0 || len(gramsB) == 0 {
+		return 0
+	}
+	shared := 0
+	for gram := range gramsA {
+		if gramsB[gram] {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(gramsA)+len(gramsB))
+}
+
+// ClosestName returns the known name, or the name owning the alias, most
+// similar to name, with its similarity
+func ClosestName(name string, names []string, aliases map[string][]string) (string, float64) {
+	closest, best := "", 0.0
+	for _, known := range names {
+		score := NameSimilarity(name, known)
+		for _, alias := range aliases[known] {
+			score = max(score, NameSimilarity(name, alias))
+		}
+		if score > best {
+			closest, best = known, score
+		}
+	}
+	return closest, best
+}
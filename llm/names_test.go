@@ -0,0 +1,47 @@
+package o4mini
+
+import "testing"
+
+func TestNameKey(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Dumbbell Row", want: "dumbbell row"},
+		{name: "DB Rows", want: "dumbbell row"},
+		{name: "db-rows!", want: "dumbbell row"},
+		{name: "RDL", want: "romanian deadlift"},
+		{name: "EZ Bar Curls", want: "ez bar curl"},
+		{name: "EZ-Bar Curl", want: "ez bar curl"},
+		{name: "EZ Curls", want: "ez bar curl"},
+		{name: "SL Leg Press", want: "single leg press"},
+		{name: "SL RDL", want: "single leg romanian deadlift"},
+		{name: "Bench Press", want: "bench press"},
+		{name: "  Pull-Ups ", want: "pull ups"},
+		{name: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := NameKey(tt.name); got != tt.want {
+			t.Errorf("NameKey(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTypoVariants(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "Dumbell Rows", b: "Dumbbell Row", want: true},
+		{a: "DB Row", b: "Dumbbell Rows", want: true},
+		{a: "Romanain Deadlift", b: "RDL", want: true},
+		{a: "Hack Squat", b: "Back Squat"},
+		{a: "Incline Bench Press", b: "Decline Bench Press"},
+		{a: "Squat", b: "Back Squat"},
+	}
+	for _, tt := range tests {
+		if got := TypoVariants(tt.a, tt.b); got != tt.want {
+			t.Errorf("TypoVariants(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package o4mini
+
+import (
+	"log"
+	"regexp"
+	"time"
+)
+
+// MaxPerformedAge is how long before a message an extracted performed_at may
+// be. Older times are more likely misreadings than late logging.
+const MaxPerformedAge = 31 * 24 * time.Hour
+
+// PerformedAtTolerance allows performed_at slightly after the message was
+// sent, for clock skew and workouts logged as they start
+const PerformedAtTolerance = 15 * time.Minute
+
+// timePattern matches wording that places a workout in time, whose
+// extraction depends on when the message was sent
+var timePattern = regexp.MustCompile(`(?i)\b(yesterday|today|tonight|morning|afternoon|evening|night|ago|last|this|earlier|monday|tuesday|wednesday|thursday|friday|saturday|sunday|mon|tue|tues|wed|thu|thurs|fri|sat|sun)\b|\b\d{1,2}(:\d{2})?\s*(am|pm)\b`)
+
+// RefersToTime reports whether a message says when the workout happened
+func RefersToTime(message string) bool {
+	return timePattern.MatchString(message)
+}
+
+// BoundPerformedAt sets the performed_at of each exercise, keeping extracted
+// times that fall between MaxPerformedAge before sentAt and
+// PerformedAtTolerance after it, and using sentAt otherwise
+func BoundPerformedAt(exercises []Exercise, sentAt time.Time) {
+	for i := range exercises {
+		performed := exercises[i].PerformedAt
+		if performed != nil && (performed.After(sentAt.Add(PerformedAtTolerance)) || performed.Before(sentAt.Add(-MaxPerformedAge))) {
+			log.Printf("Ignoring performed_at %s of %s, out of bounds for a message sent at %s",
+				performed.Format(time.RFC3339), exercises[i].Exercise, sentAt.Format(time.RFC3339))
+			performed = nil
+		}
+		if performed == nil {
+			performed = &sentAt
+		}
+		at := *performed
+		exercises[i].PerformedAt = &at
+	}
+}
@@ -0,0 +1,47 @@
+package o4mini
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBoundPerformedAt(t *testing.T) {
+	sentAt := time.Date(2024, 3, 10, 19, 0, 0, 0, time.FixedZone("PST", -8*60*60))
+	at := func(d time.Duration) *time.Time {
+		t := sentAt.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name      string
+		performed *time.Time
+		want      time.Time
+	}{
+		{name: "unset uses the send time", want: sentAt},
+		{name: "earlier the same day", performed: at(-3 * time.Hour), want: sentAt.Add(-3 * time.Hour)},
+		{name: "last week", performed: at(-7 * 24 * time.Hour), want: sentAt.Add(-7 * 24 * time.Hour)},
+		{name: "oldest allowed", performed: at(-MaxPerformedAge), want: sentAt.Add(-MaxPerformedAge)},
+		{name: "too old", performed: at(-MaxPerformedAge - time.Minute), want: sentAt},
+		{name: "just after sending", performed: at(PerformedAtTolerance), want: sentAt.Add(PerformedAtTolerance)},
+		{name: "in the future", performed: at(PerformedAtTolerance + time.Minute), want: sentAt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exercises := []Exercise{{Exercise: "Back Squat", PerformedAt: tt.performed}}
+			BoundPerformedAt(exercises, sentAt)
+			got := exercises[0].PerformedAt
+			if got == nil || !got.Equal(tt.want) {
+				t.Errorf("performed_at = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBoundPerformedAtCopiesTimes(t *testing.T) {
+	sentAt := time.Date(2024, 3, 10, 19, 0, 0, 0, time.UTC)
+	exercises := []Exercise{{Exercise: "Back Squat"}, {Exercise: "Bench Press"}}
+	BoundPerformedAt(exercises, sentAt)
+	if exercises[0].PerformedAt == exercises[1].PerformedAt {
+		t.Error("exercises share one performed_at")
+	}
+}
@@ -0,0 +1,172 @@
+package o4mini
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// DefaultPromptVersion is the embedded prompt used unless configured
+// otherwise. Embedded versions are left as they shipped, so jobs and cache
+// entries stay comparable by version; a change to the prompt adds the next one.
+const DefaultPromptVersion = "v5"
+
+//go:embed prompts/*.tmpl
+var embeddedPrompts embed.FS
+
+// PromptData is the data a prompt template is executed with
+type PromptData struct {
+	Message    string
+	Exercises  []string
+	Attributes []string
+	// History lists the user's recent exercises, one per line, when the
+	// message refers to earlier workouts
+	History []string
+	// Now is when the message was sent, in the user's time zone
+	Now string
+}
+
+// PromptSet holds the available prompt versions and decides which one each
+// request uses
+type PromptSet struct {
+	templates map[string]*template.Template
+	// fingerprints hashes each version's template source, so a version
+	// edited in place or overridden from a directory is told apart
+	fingerprints map[string]string
+	// Default is the version used for requests outside the experiment
+	Default string
+	// Experiment is a version run for ExperimentPercent of requests
+	Experiment        string
+	ExperimentPercent int
+}
+
+// Prompts is the prompt set used by ProcessMessage
+var Prompts = mustLoadEmbeddedPrompts()
+
+func mustLoadEmbeddedPrompts() *PromptSet {
+	set := &PromptSet{
+		templates:    map[string]*template.Template{},
+		fingerprints: map[string]string{},
+		Default:      DefaultPromptVersion,
+	}
+	if err := set.load(embeddedPrompts, "prompts"); err != nil {
+		log.Fatalf("Could not load embedded prompts: %v", err)
+	}
+	return set
+}
+
+// ConfigurePrompts loads prompt overrides from dir, when set, and selects the
+// default and experiment versions. Files in dir are named <version>.tmpl and
+// replace or add to the embedded versions.
+func ConfigurePrompts(dir string, defaultVersion string, experiment string, percent int) error {
+	if dir != "" {
+		if err := Prompts.load(os.DirFS(dir), "."); err != nil {
+			return fmt.Errorf("could not load prompts from %s: %w", dir, err)
+		}
+	}
+	if defaultVersion != "" {
+		Prompts.Default = defaultVersion
+	}
+	if _, ok := Prompts.templates[Prompts.Default]; !ok {
+		return fmt.Errorf("unknown prompt version %q", Prompts.Default)
+	}
+	if experiment != "" {
+		if _, ok := Prompts.templates[experiment]; !ok {
+			return fmt.Errorf("unknown experiment prompt version %q", experiment)
+		}
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("experiment percentage %d is not between 0 and 100", percent)
+		}
+	}
+	Prompts.Experiment = experiment
+	Prompts.ExperimentPercent = percent
+	if experiment != "" {
+		log.Printf("Using prompt %s, with %s for %d%% of jobs", Prompts.Default, experiment, percent)
+	} else {
+		log.Printf("Using prompt %s", Prompts.Default)
+	}
+	return nil
+}
+
+// load parses every .tmpl file in dir of fsys
+func (p *PromptSet) load(fsys fs.FS, dir string) error {
+	paths, err := fs.Glob(fsys, path.Join(dir, "*.tmpl"))
+	if err != nil {
+		return err
+	}
+	for _, name := range paths {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		version := strings.TrimSuffix(path.Base(name), ".tmpl")
+		tmpl, err := template.New(version).
+			Funcs(template.FuncMap{"join": strings.Join}).
+			Option("missingkey=error").
+			Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("invalid prompt %s: %w", version, err)
+		}
+		p.templates[version] = tmpl
+		sum := sha256.Sum256(content)
+		p.fingerprints[version] = hex.EncodeToString(sum[:8])
+	}
+	return nil
+}
+
+// Fingerprint identifies the template source of a prompt version
+func (p *PromptSet) Fingerprint(version string) string {
+	return version + "@" + p.fingerprints[version]
+}
+
+// Versions lists the loaded prompt versions
+func (p *PromptSet) Versions() []string {
+	versions := make([]string, 0, len(p.templates))
+	for version := range p.templates {
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+// Choose returns the prompt version for a request. Requests are bucketed by
+// a hash of key, so a job keeps its variant across retries; requests without
+// a key are bucketed at random.
+func (p *PromptSet) Choose(key string) string {
+	if p.Experiment == "" || p.ExperimentPercent <= 0 {
+		return p.Default
+	}
+	var bucket int
+	if key == "" {
+		bucket = rand.Intn(100)
+	} else {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		bucket = int(h.Sum32() % 100)
+	}
+	if bucket < p.ExperimentPercent {
+		return p.Experiment
+	}
+	return p.Default
+}
+
+// Render executes the prompt template of the given version
+func (p *PromptSet) Render(version string, data PromptData) (string, error) {
+	tmpl, ok := p.templates[version]
+	if !ok {
+		return "", fmt.Errorf("unknown prompt version %q", version)
+	}
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return "", fmt.Errorf("could not render prompt %s: %w", version, err)
+	}
+	return prompt.String(), nil
+}
@@ -0,0 +1,54 @@
+package o4mini
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"text/template"
+)
+
+func TestFingerprint(t *testing.T) {
+	set := &PromptSet{templates: map[string]*template.Template{}, fingerprints: map[string]string{}}
+	load := func(source string) string {
+		t.Helper()
+		fsys := fstest.MapFS{"v1.tmpl": {Data: []byte(source)}}
+		if err := set.load(fsys, "."); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		return set.Fingerprint("v1")
+	}
+
+	original := load("Extract the exercises in: {{.Message}}")
+	if again := load("Extract the exercises in: {{.Message}}"); again != original {
+		t.Errorf("reloading the same template changed its fingerprint: %q, want %q", again, original)
+	}
+	if edited := load("List the exercises in: {{.Message}}"); edited == original {
+		t.Errorf("editing the template kept its fingerprint %q", edited)
+	}
+	if Prompts.Fingerprint("v1") == Prompts.Fingerprint("v1-unknown") {
+		t.Error("different versions share a fingerprint")
+	}
+}
+
+func TestEmbeddedPromptsRender(t *testing.T) {
+	data := PromptData{
+		Message:    "same as last tuesday",
+		Exercises:  []string{"Bench Press"},
+		Attributes: []string{"Paused"},
+		History:    []string{"2026-03-10 Bench Press 3x5 100kg"},
+		Now:        "Monday 2026-03-16 18:30 UTC (+00:00)",
+	}
+	for _, version := range Prompts.Versions() {
+		prompt, err := Prompts.Render(version, data)
+		if err != nil {
+			t.Errorf("Render(%s): %v", version, err)
+			continue
+		}
+		if !strings.Contains(prompt, data.Message) {
+			t.Errorf("prompt %s does not include the message", version)
+		}
+	}
+	if _, ok := Prompts.templates[DefaultPromptVersion]; !ok {
+		t.Errorf("default prompt %s is not embedded", DefaultPromptVersion)
+	}
+}
@@ -0,0 +1,178 @@
+package o4mini
+
+import (
+	"log"
+	"slices"
+	"strings"
+
+	"noerkrieg.com/server/redis_repository"
+)
+
+// MinNameConfidence is the lowest confidence at which ResolveNames replaces an
+// extracted exercise name with a catalog name
+var MinNameConfidence = 0.85
+
+// stemmedConfidence is the confidence of a name whose key matches a catalog
+// name or alias, such as "Bench Presses" for "Bench Press"
+const stemmedConfidence = 0.95
+
+// nameIndex holds the keys of the catalog names and aliases, each pointing at
+// the catalog name it resolves to
+type nameIndex struct {
+	names   map[string]string
+	keys    map[string][]string
+	entries []indexEntry
+}
+
+type indexEntry struct {
+	words     []string
+	canonical string
+}
+
+func newNameIndex(catalog *redis_repository.ExerciseContext) *nameIndex {
+	index := &nameIndex{names: map[string]string{}, keys: map[string][]string{}}
+	add := func(name string, canonical string) {
+		lower := strings.ToLower(name)
+		if _, ok := index.names[lower]; !ok {
+			index.names[lower] = canonical
+		}
+		key := NameKey(name)
+		if !slices.Contains(index.keys[key], canonical) {
+			index.keys[key] = append(index.keys[key], canonical)
+		}
+		index.entries = append(index.entries, indexEntry{words: strings.Fields(key), canonical: canonical})
+	}
+	for _, name := range catalog.Exercises {
+		add(name, name)
+	}
+	for _, name := range catalog.Exercises {
+		for _, alias := range catalog.Aliases[name] {
+			add(alias, name)
+		}
+	}
+	return index
+}
+
+// resolve returns the catalog name for name and the confidence of the match:
+// 1 for the name or an alias regardless of case, stemmedConfidence when their
+// keys match, or else the edit similarity of the closest key differing only
+// by typos within its words. Matches tying between different catalog names
+// are ambiguous and return no name.
+func (index *nameIndex) resolve(name string) (string, float64) {
+	if canonical, ok := index.names[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return canonical, 1
+	}
+	key := NameKey(name)
+	if key == "" {
+		return "", 0
+	}
+	if matches := index.keys[key]; len(matches) > 0 {
+		if len(matches) > 1 {
+			return "", 0
+		}
+		return matches[0], stemmedConfidence
+	}
+
+	words := strings.Fields(key)
+	closest, best, ambiguous := "", 0.0, false
+	for _, entry := range index.entries {
+		edits, ok := wordTypos(words, entry.words)
+		if !ok {
+			continue
+		}
+		length := max(len([]rune(key)), len([]rune(strings.Join(entry.words, " "))))
+		score := 1 - float64(edits)/float64(length)
+		switch {
+		case score > best:
+			closest, best, ambiguous = entry.canonical, score, false
+		case score == best && entry.canonical != closest:
+			ambiguous = true
+		}
+	}
+	if ambiguous {
+		return "", 0
+	}
+	return closest, best
+}
+
+// wordTypos reports whether the words of a and b pair up in order, each
+// equal or a typo of the other, and the edits they differ by. A typo keeps
+// the first letter and is one edit in a word of five or more letters, or two
+// in one of nine or more, so words naming different movements, such as "hack"
+// and "back" or "incline" and "decline", don't match.
+func wordTypos(a []string, b []string) (int, bool) {
+	if len(a) != len(b) {
+		return 0, false
+	}
+	edits := 0
+	for i := range a {
+		if a[i] == b[i] {
+			continue
+		}
+		x, y := []rune(a[i]), []rune(b[i])
+		if x[0] != y[0] {
+			return 0, false
+		}
+		allowed := 0
+		switch shortest := min(len(x), len(y)); {
+		case shortest >= 9:
+			allowed = 2
+		case shortest >= 5:
+			allowed = 1
+		}
+		distance := editDistance(x, y)
+		if distance > allowed {
+			return 0, false
+		}
+		edits += distance
+	}
+	return edits, true
+}
+
+// ResolveNames maps each extracted exercise name to its catalog name when one
+// matches with at least MinNameConfidence, keeping the extracted name in
+// RawName. Names without a confident match are left as extracted.
+func ResolveNames(exercises []Exercise, catalog *redis_repository.ExerciseContext) {
+	if catalog == nil || len(catalog.Exercises) == 0 {
+		return
+	}
+	index := newNameIndex(catalog)
+	for i := range exercises {
+		raw := exercises[i].Exercise
+		if exercises[i].RawName == "" {
+			exercises[i].RawName = raw
+		}
+		canonical, confidence := index.resolve(raw)
+		if canonical == "" || confidence < MinNameConfidence || canonical == raw {
+			continue
+		}
+		log.Printf("Resolved exercise %q to %q (confidence %.2f)", raw, canonical, confidence)
+		exercises[i].Exercise = canonical
+	}
+}
+
+// editDistance is the Levenshtein distance between a and b, counting the
+// transposition of two adjacent letters as a single edit
+func editDistance(a []rune, b []rune) int {
+	beforePrevious := make([]int, len(b)+1)
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				current[j] = min(current[j], beforePrevious[j-2]+1)
+			}
+		}
+		beforePrevious, previous, current = previous, current, beforePrevious
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,108 @@
+package o4mini
+
+import (
+	"testing"
+
+	"noerkrieg.com/server/redis_repository"
+)
+
+func TestResolve(t *testing.T) {
+	catalog := &redis_repository.ExerciseContext{
+		Exercises: []string{"Back Squat", "Decline Bench Press", "Dumbbell Row", "Romanian Deadlift", "Pull-Up", "Chin-Up"},
+		Aliases: map[string][]string{
+			"Romanian Deadlift": {"RDL"},
+			"Pull-Up":           {"Pullup"},
+		},
+	}
+	index := newNameIndex(catalog)
+
+	tests := []struct {
+		name      string
+		want      string
+		confident bool
+	}{
+		{name: "Back Squat", want: "Back Squat", confident: true},
+		{name: "back squat", want: "Back Squat", confident: true},
+		{name: "rdl", want: "Romanian Deadlift", confident: true},
+		{name: "Back Squats", want: "Back Squat", confident: true},
+		{name: "Dumbell Rows", want: "Dumbbell Row", confident: true},
+		{name: "Romanain Deadlift", want: "Romanian Deadlift", confident: true},
+		// A different movement one word away is not a typo
+		{name: "Hack Squat", want: ""},
+		{name: "Incline Bench Press", want: ""},
+		{name: "Front Squat", want: ""},
+		{name: "Bench Press", want: ""},
+		{name: "Plank", want: ""},
+		{name: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, confidence := index.resolve(tt.name)
+			if confidence < MinNameConfidence {
+				got = ""
+			}
+			if got != tt.want {
+				t.Errorf("resolve(%q) = %q (confidence %.2f), want %q", tt.name, got, confidence, tt.want)
+			}
+			if tt.confident && confidence < MinNameConfidence {
+				t.Errorf("resolve(%q) confidence %.2f is below %.2f", tt.name, confidence, MinNameConfidence)
+			}
+		})
+	}
+}
+
+func TestResolveNamesKeepsRawName(t *testing.T) {
+	catalog := &redis_repository.ExerciseContext{Exercises: []string{"Back Squat"}}
+	exercises := []Exercise{{Exercise: "back squats"}, {Exercise: "Hack Squat"}}
+	ResolveNames(exercises, catalog)
+
+	if exercises[0].Exercise != "Back Squat" || exercises[0].RawName != "back squats" {
+		t.Errorf("got %q from %q, want Back Squat from back squats", exercises[0].Exercise, exercises[0].RawName)
+	}
+	if exercises[1].Exercise != "Hack Squat" || exercises[1].RawName != "Hack Squat" {
+		t.Errorf("got %q from %q, want Hack Squat left as extracted", exercises[1].Exercise, exercises[1].RawName)
+	}
+}
+
+func TestWordTypos(t *testing.T) {
+	tests := []struct {
+		a, b  []string
+		edits int
+		ok    bool
+	}{
+		{a: []string{"dumbell", "row"}, b: []string{"dumbbell", "row"}, edits: 1, ok: true},
+		{a: []string{"hack", "squat"}, b: []string{"back", "squat"}},
+		{a: []string{"incline", "bench"}, b: []string{"decline", "bench"}},
+		{a: []string{"squat"}, b: []string{"back", "squat"}},
+		{a: []string{"romanain", "deadlift"}, b: []string{"romanian", "deadlift"}, edits: 1, ok: true},
+		{a: []string{"dedlfit"}, b: []string{"deadlift"}},
+		{a: []string{"bulgaran", "splt"}, b: []string{"bulgarian", "split"}},
+		{a: []string{"bulgrain"}, b: []string{"bulgarian"}},
+		{a: []string{"bulgarain", "split"}, b: []string{"bulgarian", "split"}, edits: 1, ok: true},
+	}
+	for _, tt := range tests {
+		edits, ok := wordTypos(tt.a, tt.b)
+		if ok != tt.ok || (ok && edits != tt.edits) {
+			t.Errorf("wordTypos(%v, %v) = %d, %v, want %d, %v", tt.a, tt.b, edits, ok, tt.edits, tt.ok)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "row", b: "", want: 3},
+		{a: "dumbell", b: "dumbbell", want: 1},
+		{a: "romanain", b: "romanian", want: 1},
+		{a: "incline", b: "decline", want: 2},
+		{a: "kitten", b: "sitting", want: 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance([]rune(tt.a), []rune(tt.b)); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
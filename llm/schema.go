@@ -0,0 +1,219 @@
+package o4mini
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ExtractionTool is the function the model is forced to call with the
+// extracted exercises
+const ExtractionTool = "record_exercises"
+
+// serverFields are Exercise fields filled in by the server, never by the model
+var serverFields = map[string]bool{
+	"user_id":           true,
+	"id":                true,
+	"created_ts":        true,
+	"metrics":           true,
+	"summary":           true,
+	"workout_id":        true,
+	"position":          true,
+	"raw_exercise_name": true,
+
+	"original_resistance_type": true,
+	"original_work_type":       true,
+	"import_key":               true,
+}
+
+// fieldDescriptions document the extracted fields in the schema
+var fieldDescriptions = map[string]string{
+	"exercise_name":   "Name of the exercise, reusing a known exercise name when one matches",
+	"type":            "One of: strength, cardio, flexibility, balance",
+	"sets":            "Number of sets performed",
+	"work":            "Amount of work per set, such as repetitions or distance",
+	"work_type":       "Unit of work, in full plural spelling, such as repetitions, miles, kilometers or meters",
+	"resistance":      "Weight or resistance used",
+	"resistance_type": "Unit of resistance, in full plural spelling, such as pounds, kilograms or bodyweight, or bodyweight + pounds for weight added to bodyweight",
+	"duration":        "Duration in minutes",
+	"attributes":      "Modifiers of the exercise, reusing known attributes when one matches",
+	"performed_at":    "When the exercise was performed, as an RFC 3339 timestamp with the user's UTC offset, only if the message says",
+	"set_details":     "Each set in order, when the message gives per-set detail such as a pyramid (135x10, 155x8) or drop sets",
+	"reps":            "Repetitions in the set",
+	"load":            "Weight used for the set, in the exercise's resistance_type",
+	"rpe":             "Rate of perceived exertion, 1 to 10",
+	"rir":             "Repetitions in reserve",
+	"rest_seconds":    "Rest after the set, in seconds",
+	"drop":            "Whether the set is a drop set, done right after the previous one at a lower load",
+	"group":           "Number shared by exercises performed together as a superset or circuit, starting at 1",
+}
+
+// ExerciseSchema returns the strict JSON schema of the extraction output,
+// derived from the json tags of Exercise. Every field is required and
+// optional values are nullable, as strict function calling demands.
+func ExerciseSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"response": map[string]any{
+				"type":  "array",
+				"items": objectSchema(reflect.TypeOf(Exercise{})),
+			},
+		},
+		"required":             []string{"response"},
+		"additionalProperties": false,
+	}
+}
+
+// objectSchema derives the schema of a struct from its json tags, leaving
+// out serverFields. Only exercise_name is not nullable.
+func objectSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := jsonName(field)
+		if name == "" || serverFields[name] {
+			continue
+		}
+		property := map[string]any{"type": schemaType(field.Type, name != "exercise_name")}
+		if field.Type.Kind() == reflect.Slice {
+			if elem := field.Type.Elem(); elem.Kind() == reflect.Struct {
+				property["items"] = objectSchema(elem)
+			} else {
+				property["items"] = map[string]any{"type": schemaType(elem, false)}
+			}
+		}
+		if description, ok := fieldDescriptions[name]; ok {
+			property["description"] = description
+		}
+		properties[name] = property
+		required = append(required, name)
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// extractionCall returns the options forcing the model to answer through the
+// extraction tool
+func extractionCall() []llms.CallOption {
+	return []llms.CallOption{
+		llms.WithTools([]llms.Tool{{
+			Type: "function",
+			Function: &llms.FunctionDefinition{
+				Name:        ExtractionTool,
+				Description: "Record the exercises found in the user's message",
+				Parameters:  ExerciseSchema(),
+				Strict:      true,
+			},
+		}}),
+		llms.WithToolChoice(llms.ToolChoice{
+			Type:     "function",
+			Function: &llms.FunctionReference{Name: ExtractionTool},
+		}),
+	}
+}
+
+// completionOf returns the extraction tool's arguments, or the message
+// content when the model answered without calling it
+func completionOf(choice *llms.ContentChoice) string {
+	for _, call := range choice.ToolCalls {
+		if call.FunctionCall != nil && call.FunctionCall.Name == ExtractionTool {
+			return call.FunctionCall.Arguments
+		}
+	}
+	return choice.Content
+}
+
+// ParseCompletion strictly decodes the model's JSON response into exercises,
+// rejecting unknown fields, exercises without a name and out of range values.
+// The legacy set fields are derived from set details when there are any.
+func ParseCompletion(completion string) ([]Exercise, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(completion)))
+	decoder.DisallowUnknownFields()
+
+	var output struct {
+		Response *[]Exercise `json:"response"`
+	}
+	if err := decoder.Decode(&output); err != nil {
+		return nil, fmt.Errorf("could not unmarshal json: %v", err)
+	}
+	if output.Response == nil {
+		return nil, fmt.Errorf(`could not unmarshal json: missing "response" array`)
+	}
+
+	for i, ex := range *output.Response {
+		if strings.TrimSpace(ex.Exercise) == "" {
+			return nil, fmt.Errorf("exercise %d has no exercise_name", i)
+		}
+		if ex.Sets < 0 || ex.Quantity < 0 || ex.Resistance < 0 || ex.Duration < 0 || ex.Group < 0 {
+			return nil, fmt.Errorf("exercise %d (%s) has a negative value", i, ex.Exercise)
+		}
+		if err := validateSets(ex); err != nil {
+			return nil, err
+		}
+		(*output.Response)[i].DeriveFromSets()
+	}
+	return *output.Response, nil
+}
+
+// repairPrompt asks the model to correct output that failed validation
+func repairPrompt(prompt string, completion string, err error) string {
+	return fmt.Sprintf("%s\n\nYour previous output was:\n%s\n\nIt was rejected with this error: %v\n"+
+		"Call %s again with output that fixes the error.", prompt, completion, err, ExtractionTool)
+}
+
+// jsonName returns the json name of a struct field, or "" when it is skipped
+func jsonName(field reflect.StructField) string {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// schemaType maps a Go type to its JSON schema type
+func schemaType(t reflect.Type, nullable bool) any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var name string
+	switch t.Kind() {
+	case reflect.String:
+		name = "string"
+	case reflect.Float32, reflect.Float64:
+		name = "number"
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		name = "integer"
+	case reflect.Bool:
+		name = "boolean"
+	case reflect.Slice:
+		name = "array"
+	case reflect.Struct:
+		name = "object"
+		if t == reflect.TypeOf(time.Time{}) {
+			name = "string"
+		}
+	default:
+		name = "object"
+	}
+	if nullable {
+		return []string{name, "null"}
+	}
+	return name
+}
@@ -0,0 +1,188 @@
+package o4mini
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestExerciseSchema(t *testing.T) {
+	schema := ExerciseSchema()
+	assertStrict(t, "schema", schema)
+
+	response := schema["properties"].(map[string]any)["response"].(map[string]any)
+	exercise := response["items"].(map[string]any)
+	want := []string{"attributes", "duration", "exercise_name", "group", "performed_at", "resistance",
+		"resistance_type", "set_details", "sets", "type", "work", "work_type"}
+	if got := propertyNames(exercise); !slices.Equal(got, want) {
+		t.Errorf("exercise properties = %v, want %v", got, want)
+	}
+	if got := exercise["properties"].(map[string]any)["exercise_name"].(map[string]any)["type"]; got != "string" {
+		t.Errorf("exercise_name type = %v, want a string that is not nullable", got)
+	}
+
+	set := exercise["properties"].(map[string]any)["set_details"].(map[string]any)["items"].(map[string]any)
+	want = []string{"drop", "load", "reps", "rest_seconds", "rir", "rpe"}
+	if got := propertyNames(set); !slices.Equal(got, want) {
+		t.Errorf("set properties = %v, want %v", got, want)
+	}
+}
+
+// assertStrict checks the invariants of strict function calling on every
+// object in a schema: all properties are required and no others are allowed
+func assertStrict(t *testing.T, path string, schema map[string]any) {
+	t.Helper()
+	if schema["additionalProperties"] != false {
+		t.Errorf("%s allows additional properties", path)
+	}
+	required, _ := schema["required"].([]string)
+	required = slices.Clone(required)
+	sort.Strings(required)
+	if names := propertyNames(schema); !slices.Equal(required, names) {
+		t.Errorf("%s requires %v, want every property %v", path, required, names)
+	}
+	for name, property := range schema["properties"].(map[string]any) {
+		property := property.(map[string]any)
+		if _, ok := property["properties"]; ok {
+			assertStrict(t, path+"."+name, property)
+		}
+		if items, ok := property["items"].(map[string]any); ok {
+			if _, ok := items["properties"]; ok {
+				assertStrict(t, path+"."+name+"[]", items)
+			}
+		}
+	}
+}
+
+func propertyNames(schema map[string]any) []string {
+	names := make([]string, 0)
+	for name := range schema["properties"].(map[string]any) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestParseCompletion(t *testing.T) {
+	tests := []struct {
+		name       string
+		completion string
+		err        string
+		want       []Exercise
+	}{
+		{
+			name:       "valid",
+			completion: `{"response": [{"exercise_name": "Bench Press", "sets": 3, "work": 5, "group": null}]}`,
+			want:       []Exercise{{Exercise: "Bench Press", Sets: 3, Quantity: 5}},
+		},
+		{
+			name: "sets derived from set details",
+			completion: `{"response": [{"exercise_name": "Bench Press", "sets": null, "set_details": [` +
+				`{"reps": 10, "load": 135}, {"reps": 8, "load": 155}, {"reps": 6, "load": 175}]}]}`,
+			want: []Exercise{{Exercise: "Bench Press", Sets: 3, Quantity: 6, QuantityType: "repetitions", Resistance: 175}},
+		},
+		{name: "empty response", completion: `{"response": []}`, want: []Exercise{}},
+		{name: "not json", completion: `Sure! Here are your exercises`, err: "could not unmarshal json"},
+		{name: "missing response", completion: `{"exercises": []}`, err: "could not unmarshal json"},
+		{name: "null response", completion: `{"response": null}`, err: `missing "response" array`},
+		{name: "unknown field", completion: `{"response": [{"exercise_name": "Row", "weight": 50}]}`, err: `unknown field "weight"`},
+		{name: "unknown set field", completion: `{"response": [{"exercise_name": "Row", "set_details": [{"reps": 5, "tempo": "3-1-1"}]}]}`,
+			err: `unknown field "tempo"`},
+		{name: "wrong type", completion: `{"response": [{"exercise_name": "Row", "sets": "three"}]}`, err: "could not unmarshal json"},
+		{name: "no name", completion: `{"response": [{"exercise_name": " ", "sets": 3}]}`, err: "exercise 0 has no exercise_name"},
+		{name: "negative value", completion: `{"response": [{"exercise_name": "Row", "resistance": -5}]}`, err: "exercise 0 (Row) has a negative value"},
+		{name: "negative group", completion: `{"response": [{"exercise_name": "Row", "group": -1}]}`, err: "has a negative value"},
+		{name: "negative set", completion: `{"response": [{"exercise_name": "Row", "set_details": [{"reps": -5}]}]}`,
+			err: "set 1 of Row has a negative value"},
+		{name: "rpe out of range", completion: `{"response": [{"exercise_name": "Row", "set_details": [{"reps": 5, "rpe": 11}]}]}`,
+			err: "set 1 of Row has RPE 11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCompletion(tt.completion)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCompletion: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d exercises, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, ex := range got {
+				w := tt.want[i]
+				if ex.Exercise != w.Exercise || ex.Sets != w.Sets || ex.Quantity != w.Quantity ||
+					ex.QuantityType != w.QuantityType || ex.Resistance != w.Resistance {
+					t.Errorf("exercise %d = %+v, want %+v", i, ex, w)
+				}
+			}
+		})
+	}
+}
+
+// scriptedModel answers each call with the next of its completions, through
+// the extraction tool
+type scriptedModel struct {
+	completions []string
+	prompts     []string
+}
+
+func (m *scriptedModel) GenerateContent(_ context.Context, messages []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.prompts = append(m.prompts, messages[0].Parts[0].(llms.TextContent).Text)
+	completion := m.completions[len(m.prompts)-1]
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		ToolCalls: []llms.ToolCall{{FunctionCall: &llms.FunctionCall{Name: ExtractionTool, Arguments: completion}}},
+	}}}, nil
+}
+
+func (m *scriptedModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return "", nil
+}
+
+func TestExtractRepairsInvalidCompletion(t *testing.T) {
+	invalid := `{"response": [{"exercise_name": "Row", "weight": 50}]}`
+	valid := `{"response": [{"exercise_name": "Row", "resistance": 50}]}`
+	tests := []struct {
+		name        string
+		completions []string
+		err         string
+		calls       int
+	}{
+		{name: "valid the first time", completions: []string{valid}, calls: 1},
+		{name: "repaired", completions: []string{invalid, valid}, calls: 2},
+		{name: "still invalid", completions: []string{invalid, invalid}, err: `unknown field "weight"`, calls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &scriptedModel{completions: tt.completions}
+			result, err := NewLLMExtractor(model, Model).Extract(context.Background(), Request{Message: "row 50kg"})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("err = %v, want one containing %q", err, tt.err)
+				}
+			} else if err != nil || len(result.Exercises) != 1 || result.Exercises[0].Resistance != 50 {
+				t.Errorf("Extract = %+v, %v, want the row at 50", result, err)
+			}
+			if len(model.prompts) != tt.calls {
+				t.Fatalf("model called %d times, want %d", len(model.prompts), tt.calls)
+			}
+			if tt.calls > 1 {
+				repair := model.prompts[1]
+				if !strings.HasPrefix(repair, model.prompts[0]) || !strings.Contains(repair, invalid) ||
+					!strings.Contains(repair, `unknown field "weight"`) {
+					t.Errorf("repair prompt does not repeat the prompt, the rejected output and its error:\n%s", repair)
+				}
+			}
+			if result.Usage == nil || result.Usage.PromptTokens == 0 {
+				t.Errorf("usage = %+v, want the tokens of every call", result.Usage)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package o4mini
+
+import "fmt"
+
+// ExerciseSet is a single set of an exercise. Load is in the exercise's
+// resistance_type.
+type ExerciseSet struct {
+	Reps        float64 `json:"reps,omitempty"`
+	Load        float64 `json:"load,omitempty"`
+	RPE         float64 `json:"rpe,omitempty"`
+	RIR         float64 `json:"rir,omitempty"`
+	RestSeconds float64 `json:"rest_seconds,omitempty"`
+	Drop        bool    `json:"drop,omitempty"` // Performed immediately after the previous set at a reduced load
+}
+
+// validateSets checks that the per-set values of an exercise are in range
+func validateSets(ex Exercise) error {
+	for i, set := range ex.SetDetails {
+		if set.Reps < 0 || set.Load < 0 || set.RIR < 0 || set.RestSeconds < 0 {
+			return fmt.Errorf("set %d of %s has a negative value", i+1, ex.Exercise)
+		}
+		if set.RPE < 0 || set.RPE > 10 {
+			return fmt.Errorf("set %d of %s has RPE %v, expected 0 to 10", i+1, ex.Exercise, set.RPE)
+		}
+	}
+	return nil
+}
+
+// DeriveFromSets fills the legacy Sets, Quantity and Resistance fields from
+// the exercise's set details: the number of sets, and the reps and load of
+// the top set, the heaviest one with the most reps. Exercises without set
+// details are left unchanged.
+func (ex *Exercise) DeriveFromSets() {
+	if len(ex.SetDetails) == 0 {
+		return
+	}
+	top := ex.SetDetails[0]
+	for _, set := range ex.SetDetails[1:] {
+		if set.Load > top.Load || (set.Load == top.Load && set.Reps > top.Reps) {
+			top = set
+		}
+	}
+	ex.Sets = float64(len(ex.SetDetails))
+	if top.Reps > 0 {
+		ex.Quantity = top.Reps
+		if ex.QuantityType == "" {
+			ex.QuantityType = "repetitions"
+		}
+	}
+	if top.Load > 0 {
+		ex.Resistance = top.Load
+	}
+}
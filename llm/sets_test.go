@@ -0,0 +1,59 @@
+package o4mini
+
+import "testing"
+
+func TestDeriveFromSets(t *testing.T) {
+	tests := []struct {
+		name string
+		ex   Exercise
+		want Exercise
+	}{
+		{
+			name: "no set details",
+			ex:   Exercise{Sets: 3, Quantity: 5, QuantityType: "repetitions", Resistance: 100},
+			want: Exercise{Sets: 3, Quantity: 5, QuantityType: "repetitions", Resistance: 100},
+		},
+		{
+			name: "straight sets",
+			ex:   Exercise{SetDetails: []ExerciseSet{{Reps: 5, Load: 100}, {Reps: 5, Load: 100}, {Reps: 5, Load: 100}}},
+			want: Exercise{Sets: 3, Quantity: 5, QuantityType: "repetitions", Resistance: 100},
+		},
+		{
+			name: "top set is the heaviest",
+			ex:   Exercise{SetDetails: []ExerciseSet{{Reps: 8, Load: 80}, {Reps: 3, Load: 110}, {Reps: 5, Load: 100}}},
+			want: Exercise{Sets: 3, Quantity: 3, QuantityType: "repetitions", Resistance: 110},
+		},
+		{
+			name: "ties go to the most reps",
+			ex:   Exercise{SetDetails: []ExerciseSet{{Reps: 4, Load: 100}, {Reps: 6, Load: 100}, {Reps: 5, Load: 100}}},
+			want: Exercise{Sets: 3, Quantity: 6, QuantityType: "repetitions", Resistance: 100},
+		},
+		{
+			name: "work type is kept",
+			ex:   Exercise{QuantityType: "seconds", SetDetails: []ExerciseSet{{Reps: 60}, {Reps: 45}}},
+			want: Exercise{Sets: 2, Quantity: 60, QuantityType: "seconds"},
+		},
+		{
+			name: "bodyweight sets keep the resistance",
+			ex:   Exercise{Resistance: 25, SetDetails: []ExerciseSet{{Reps: 10}, {Reps: 8}}},
+			want: Exercise{Sets: 2, Quantity: 10, QuantityType: "repetitions", Resistance: 25},
+		},
+		{
+			name: "sets without reps keep the quantity",
+			ex:   Exercise{Quantity: 2, QuantityType: "miles", SetDetails: []ExerciseSet{{Load: 20}}},
+			want: Exercise{Sets: 1, Quantity: 2, QuantityType: "miles", Resistance: 20},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex := tt.ex
+			ex.DeriveFromSets()
+			if ex.Sets != tt.want.Sets || ex.Quantity != tt.want.Quantity || ex.QuantityType != tt.want.QuantityType ||
+				ex.Resistance != tt.want.Resistance {
+				t.Errorf("got sets %v, work %v %s, resistance %v, want sets %v, work %v %s, resistance %v",
+					ex.Sets, ex.Quantity, ex.QuantityType, ex.Resistance,
+					tt.want.Sets, tt.want.Quantity, tt.want.QuantityType, tt.want.Resistance)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package o4mini
+
+import (
+	"log"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Usage is the token count and estimated cost of a single LLM call
+type Usage struct {
+	Model            string  `json:"model"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// Add accumulates another call's usage, as when one job makes several calls
+func (u *Usage) Add(other *Usage) {
+	if other == nil {
+		return
+	}
+	if u.Model == "" {
+		u.Model = other.Model
+	}
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.CostUSD += other.CostUSD
+}
+
+// price is the cost in US dollars per million tokens
+type price struct {
+	prompt     float64
+	completion float64
+}
+
+// prices lists the OpenAI list price of the models we call
+var prices = map[string]price{
+	"gpt-4.1-nano": {prompt: 0.10, completion: 0.40},
+	"gpt-4.1-mini": {prompt: 0.40, completion: 1.60},
+	"gpt-4.1":      {prompt: 2.00, completion: 8.00},
+	"gpt-4o-mini":  {prompt: 0.15, completion: 0.60},
+	"o4-mini":      {prompt: 1.10, completion: 4.40},
+}
+
+// Cost estimates the price of a call from its token counts
+func Cost(model string, promptTokens int, completionTokens int) float64 {
+	p, ok := prices[model]
+	if !ok {
+		log.Printf("No price known for model %s, cost will be recorded as zero", model)
+		return 0
+	}
+	return (float64(promptTokens)*p.prompt + float64(completionTokens)*p.completion) / 1e6
+}
+
+var (
+	encoding     *tiktoken.Tiktoken
+	encodingOnce sync.Once
+)
+
+// CountTokens counts the tokens in text. tiktoken-go has no encoding for the
+// gpt-4.1 family, so cl100k_base is used as a close approximation; if the
+// encoding cannot be loaded the count falls back to four characters a token.
+func CountTokens(text string) int {
+	encodingOnce.Do(func() {
+		var err error
+		if encoding, err = tiktoken.GetEncoding(tiktoken.MODEL_CL100K_BASE); err != nil {
+			log.Printf("Could not load tokenizer, estimating token counts: %v", err)
+		}
+	})
+	if encoding == nil {
+		return (len(text) + 3) / 4
+	}
+	return len(encoding.Encode(text, nil, nil))
+}
+
+// newUsage builds the usage of a call from the counts the API reported,
+// counting locally when the response carried none
+func newUsage(model string, prompt string, completion string, info map[string]any) *Usage {
+	usage := &Usage{Model: model}
+	if n, ok := info["PromptTokens"].(int); ok && n > 0 {
+		usage.PromptTokens = n
+	} else {
+		usage.PromptTokens = CountTokens(prompt)
+	}
+	if n, ok := info["CompletionTokens"].(int); ok && n > 0 {
+		usage.CompletionTokens = n
+	} else {
+		usage.CompletionTokens = CountTokens(completion)
+	}
+	usage.CostUSD = Cost(model, usage.PromptTokens, usage.CompletionTokens)
+	return usage
+}
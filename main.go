@@ -1,16 +1,21 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"log"
 	"net/http"
-	"os"
 	"runtime"
-	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"noerkrieg.com/server/api"
+	"noerkrieg.com/server/config"
+	llm "noerkrieg.com/server/llm"
 	repository "noerkrieg.com/server/postgres_repository"
+	"noerkrieg.com/server/redis_repository"
 )
 
 // max returns the maximum of two integers
@@ -23,37 +28,122 @@ func max(a, b int) int {
 
 func main() {
 	var queue *repository.WorkQueue
+	var cachingExtractor *llm.CachingExtractor
 	var supabaseStore *repository.SupabaseStore
 	var router *chi.Mux
 
-	supabaseStore, err := repository.NewSupabaseStore(os.Getenv("BPYP_POSTGRES_DIR_CONN"))
+	configPath := flag.String("config", "", "path to a JSON configuration file, overridden by the environment (default $"+config.FileEnv+")")
+	mode := flag.String("mode", "", "what the process runs: api, worker or all (default $BPYP_MODE, or all)")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath, map[string]string{"BPYP_MODE": *mode})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Effective configuration:\n%s", cfg.Dump())
+
+	supabaseStore, err = repository.NewSupabaseStore(cfg.DatabaseURL, repository.StoreOptions{
+		MaxConns:           cfg.DBMaxConns,
+		NotificationBuffer: cfg.NotificationBuffer,
+	})
 	if err != nil {
 		log.Fatalf("Could not create SupabaseStore. Encountered error: %v", err)
 	}
 
 	defer supabaseStore.Close()
 
-	cpuCount := runtime.NumCPU()
-	multiplier := 2
-	if multiplierEnv := os.Getenv("BPYP_WORKER_MULTIPLIER"); multiplierEnv != "" {
-		if m, err := strconv.Atoi(multiplierEnv); err == nil && m > 0 {
-			multiplier = m
+	// Instances disabling migrations leave them to a deployment step, or to
+	// a database user allowed to change the schema
+	if cfg.Migrate {
+		if err := supabaseStore.Migrate(context.Background()); err != nil {
+			log.Fatalf("Could not migrate the database: %v", err)
 		}
 	}
 
-	workerCount := max(1, cpuCount*multiplier/runtime.GOMAXPROCS(0))
-	log.Printf("Starting with %d workers (CPU count: %d, multiplier: %d)",
-		workerCount, cpuCount, multiplier)
+	supabaseStore.MonthlyBudgetUSD = cfg.MonthlyBudgetUSD
+	if cfg.MonthlyBudgetUSD > 0 {
+		log.Printf("Monthly LLM budget per user: $%.2f", cfg.MonthlyBudgetUSD)
+	}
+	supabaseStore.WorkoutMergeWindow = cfg.WorkoutMergeWindow
+
+	// Redis is shared by every instance; without REDIS_ADDR an in-memory
+	// store stands in for it
+	ctx := context.Background()
+	cacheStore := redis_repository.NewStore(cfg.Redis)
+	if redisStore, ok := cacheStore.(*redis_repository.RedisStore); ok {
+		defer redisStore.Close()
+		go redisStore.MonitorHealth(ctx, cfg.RedisHealthInterval)
+	}
+
+	// The catalog lives in Postgres, cached in the store. An empty catalog is
+	// seeded from the Redis sets it replaced.
+	supabaseStore.CatalogCache = cacheStore
+	if legacy, err := redis_repository.LegacySets(ctx, supabaseStore.CatalogCache); err != nil {
+		log.Printf("Could not read legacy catalog sets: %v", err)
+	} else if seeded, err := supabaseStore.SeedCatalog(ctx, legacy); err != nil {
+		log.Printf("Could not seed catalog: %v", err)
+	} else if seeded {
+		log.Printf("Seeded catalog with %d exercises and %d attributes", len(legacy.Exercises), len(legacy.Attributes))
+	}
+
+	// Prompts use the last catalog loaded, reloaded periodically and whenever
+	// an instance publishes a change
+	contextProvider := redis_repository.NewContextProvider(supabaseStore.CatalogContext, cfg.ContextRefreshInterval)
+	if err := contextProvider.Refresh(ctx); err != nil {
+		log.Printf("Could not load catalog, retrying every %v: %v", cfg.ContextRefreshInterval, err)
+	}
+	go contextProvider.Run(ctx, redis_repository.SubscribeCatalogChanges(ctx, supabaseStore.CatalogCache))
+	llm.UseCatalog(contextProvider)
+
+	llm.ContextSelection.TokenBudget = cfg.ContextTokenBudget
+	llm.ContextSelection.TopN = cfg.ContextTopN
+	llm.MinNameConfidence = cfg.NameConfidence
+	llm.Model = cfg.Model
+
+	if err := llm.ConfigurePrompts(cfg.PromptDir, cfg.PromptVersion,
+		cfg.PromptExperiment, cfg.PromptExperimentPercent); err != nil {
+		log.Fatalf("Could not configure prompts: %v", err)
+	}
 
-	queue = repository.NewWorkQueue(workerCount, supabaseStore)
-	queue.Start()
+	// API processes never claim jobs, leaving them to worker processes
+	workerCount := 0
+	if cfg.RunsWorkers() {
+		cpuCount := runtime.NumCPU()
+		workerCount = max(1, cpuCount*cfg.WorkerMultiplier/runtime.GOMAXPROCS(0))
+		log.Printf("Starting with %d workers (CPU count: %d, multiplier: %d)",
+			workerCount, cpuCount, cfg.WorkerMultiplier)
+
+		extractor, err := llm.NewExtractor(cfg.CassetteMode, cfg.CassetteDir)
+		if err != nil {
+			log.Fatalf("Could not create extractor: %v", err)
+		}
+
+		var cached llm.Extractor = extractor
+		if cfg.LLMCache != "" {
+			var cache llm.ResponseCache
+			switch cfg.LLMCache {
+			case "redis":
+				cache = redis_repository.NewResponseCache(cacheStore)
+			case "postgres":
+				cache = supabaseStore.NewLLMCache()
+			}
+			log.Printf("Caching LLM extractions in %s for %v", cfg.LLMCache, cfg.LLMCacheTTL)
+			cachingExtractor = llm.NewCachingExtractor(extractor, cache, cfg.LLMCacheTTL)
+			cached = cachingExtractor
+		}
+
+		queue = repository.NewWorkQueue(workerCount, supabaseStore, cached)
+		queue.PollInterval = cfg.PollInterval
+		queue.Start()
+	}
+	log.Printf("Running in %s mode", cfg.Mode)
 
 	router = chi.NewRouter()
 	router.Use(middleware.Logger)
 
 	router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET" /*"POST", "PUT", "DELETE",*/, "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		AllowCredentials: true,
 		MaxAge:           300,
@@ -64,6 +154,58 @@ func main() {
 			writer.WriteHeader(http.StatusOK)
 			writer.Write([]byte("OK"))
 		})
+		// Reports 503 when the exercise context has not been reloaded recently
+		r.Get("/health/context", func(writer http.ResponseWriter, req *http.Request) {
+			health := contextProvider.Health()
+			status := http.StatusOK
+			if health.Stale {
+				status = http.StatusServiceUnavailable
+			}
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(status)
+			json.NewEncoder(writer).Encode(health)
+		})
+		// Reports 503 when the last ping to Redis failed
+		r.Get("/health/redis", func(writer http.ResponseWriter, req *http.Request) {
+			if !cacheStore.Healthy() {
+				writer.WriteHeader(http.StatusServiceUnavailable)
+				writer.Write([]byte("UNAVAILABLE"))
+				return
+			}
+			writer.WriteHeader(http.StatusOK)
+			writer.Write([]byte("OK"))
+		})
+
+		r.Get("/metrics", func(writer http.ResponseWriter, req *http.Request) {
+			pending, err := supabaseStore.GetPendingJobCount()
+			if err != nil {
+				log.Printf("Error counting pending jobs: %v", err)
+				writer.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			metrics := map[string]interface{}{
+				"mode":         cfg.Mode,
+				"workers":      workerCount,
+				"pending_jobs": pending,
+			}
+			// Worker counts and cache hits are this process's since startup
+			if queue != nil {
+				metrics["worker_jobs"] = queue.Stats()
+			}
+			if cachingExtractor != nil {
+				metrics["llm_cache"] = cachingExtractor.Stats()
+			}
+			writer.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(writer).Encode(metrics)
+		})
+
+		// Worker processes serve only their health and metrics
+		if cfg.ServesAPI() {
+			r.Group(func(r chi.Router) {
+				r.Use(api.Authenticate(cfg.JWTSecret))
+				api.NewHandler(supabaseStore).Routes(r)
+			})
+		}
 	})
-	http.ListenAndServe(":"+os.Getenv("PORT"), router)
+	http.ListenAndServe(":"+cfg.Port, router)
 }
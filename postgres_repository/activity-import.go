@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"noerkrieg.com/server/activity"
+)
+
+// processActivityJob parses a GPX, TCX or FIT file into cardio exercises,
+// skipping activities that were already imported
+func (w *WorkQueue) processActivityJob(job *Job) (json.RawMessage, error) {
+	var req ActivityImportRequest
+	if err := json.Unmarshal(job.Data, &req); err != nil {
+		return nil, fmt.Errorf("invalid activity import request: %w", err)
+	}
+
+	ctx := context.Background()
+	file := req.File
+	if req.UploadID != "" {
+		var err error
+		if file, err = w.store.loadUpload(ctx, req.UploadID, job.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	summaries, err := activity.Parse(req.Format, file)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := make([]map[string]interface{}, 0, len(summaries))
+	duplicates := 0
+	for _, summary := range summaries {
+		ex := activity.ToExercise(summary, req.DistanceUnit)
+		ex.UserId = job.UserID
+		if ex.Timestamp.IsZero() {
+			// Files recorded without times are dated by their upload
+			ex.Timestamp = job.CreatedAt
+		}
+
+		duplicate, err := w.store.exerciseExists(ctx, ex)
+		if err != nil {
+			return nil, err
+		}
+		if duplicate {
+			duplicates++
+			continue
+		}
+
+		inserted, err := insertExercise(ctx, w.store.Pool, ex)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, inserted)
+	}
+
+	log.Printf("Activity import of %s: %d activities, %d inserted, %d duplicates",
+		req.Filename, len(summaries), len(compiled), duplicates)
+	return json.Marshal(compiled)
+}
@@ -0,0 +1,379 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	llm "noerkrieg.com/server/llm"
+	"noerkrieg.com/server/redis_repository"
+)
+
+// ErrProposalDecided is returned when approving or rejecting a proposal that
+// was already approved or rejected
+var ErrProposalDecided = errors.New("the proposal was already decided")
+
+// ErrProposalTarget is returned when approving an alias proposal whose target
+// is not in the catalog
+var ErrProposalTarget = errors.New("the proposal's target exercise is not in the catalog")
+
+// ErrProposalAction is returned when approving an attribute proposal as aliases
+var ErrProposalAction = errors.New("attribute proposals can only be approved as new attributes")
+
+const catalogProposalColumns = `id::text, kind, name, variants, COALESCE(target_name, ''), similarity,
+	occurrences, COALESCE(array_length(users, 1), 0), status, created_at, updated_at, decided_at`
+
+func scanCatalogProposal(row pgx.CollectableRow) (CatalogProposal, error) {
+	var p CatalogProposal
+	err := row.Scan(&p.ID, &p.Kind, &p.Name, &p.Variants, &p.TargetName, &p.Similarity,
+		&p.Occurrences, &p.Users, &p.Status, &p.CreatedAt, &p.UpdatedAt, &p.DecidedAt)
+	p.Action = ProposalActionNew
+	if p.Kind == ProposalKindExercise && p.TargetName != "" {
+		p.Action = ProposalActionAlias
+	}
+	return p, err
+}
+
+// observedName is a name of an upload that known does not know
+type observedName struct {
+	kind string
+	key  string
+	name string
+}
+
+// unknownName is a cluster of unknown names seen in one upload
+type unknownName struct {
+	kind     string
+	key      string
+	variants []string
+	count    int
+}
+
+// recordUnknownNames adds to the catalog proposals the exercise and attribute
+// names of an upload that are not in known, the catalog merged with the
+// user's custom exercises. Names are clustered by their normalized key, and a
+// name whose key is a typo of an existing cluster's joins that cluster.
+// Exercise clusters close to a catalog exercise are proposed as its aliases.
+func (s *SupabaseStore) recordUnknownNames(ctx context.Context, userID string, exercises []llm.Exercise, known *redis_repository.ExerciseContext) error {
+	knownKeys := map[string]map[string]bool{
+		ProposalKindExercise:  {},
+		ProposalKindAttribute: {},
+	}
+	for _, name := range known.Exercises {
+		knownKeys[ProposalKindExercise][llm.NameKey(name)] = true
+		for _, alias := range known.Aliases[name] {
+			knownKeys[ProposalKindExercise][llm.NameKey(alias)] = true
+		}
+	}
+	for _, name := range known.Attributes {
+		knownKeys[ProposalKindAttribute][llm.NameKey(name)] = true
+	}
+
+	var names []observedName
+	observe := func(kind string, name string) {
+		name = strings.TrimSpace(name)
+		key := llm.NameKey(name)
+		if key == "" || knownKeys[kind][key] {
+			return
+		}
+		names = append(names, observedName{kind: kind, key: key, name: name})
+	}
+	for _, ex := range exercises {
+		observe(ProposalKindExercise, ex.Exercise)
+		for _, attribute := range ex.Attributes {
+			observe(ProposalKindAttribute, attribute)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	candidates, err := s.proposalClusterCandidates(ctx, names)
+	if err != nil {
+		return err
+	}
+	// Clusters started by this upload can be joined by its later names too
+	started := map[string][]string{}
+	seen := map[string]*unknownName{}
+	var unknown []*unknownName
+	for _, n := range names {
+		key := n.key
+		if _, ok := seen[n.kind+":"+key]; !ok {
+			key = closestCluster(key, slices.Concat(candidates[n.kind+":"+key], started[n.kind]))
+			started[n.kind] = append(started[n.kind], key)
+		}
+		u, ok := seen[n.kind+":"+key]
+		if !ok {
+			u = &unknownName{kind: n.kind, key: key}
+			seen[n.kind+":"+key] = u
+			unknown = append(unknown, u)
+		}
+		if !slices.ContainsFunc(u.variants, func(v string) bool { return strings.EqualFold(v, n.name) }) {
+			u.variants = append(u.variants, n.name)
+		}
+		u.count++
+	}
+
+	batch := &pgx.Batch{}
+	for _, u := range unknown {
+		var target string
+		var similarity float64
+		if u.kind == ProposalKindExercise {
+			target, similarity = llm.ClosestName(u.variants[0], known.Exercises, known.Aliases)
+			if similarity < ProposalAliasSimilarity {
+				target = ""
+			}
+		}
+		batch.Queue(`
+			INSERT INTO catalog_proposals (kind, cluster_key, name, variants, target_name, similarity, occurrences, users)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, ARRAY[$8::uuid])
+			ON CONFLICT (kind, cluster_key) DO UPDATE SET
+				variants = ARRAY(
+					SELECT DISTINCT variant FROM unnest(catalog_proposals.variants || EXCLUDED.variants) AS variant
+					ORDER BY variant),
+				occurrences = catalog_proposals.occurrences + EXCLUDED.occurrences,
+				users = CASE WHEN $8::uuid = ANY(catalog_proposals.users)
+					THEN catalog_proposals.users ELSE catalog_proposals.users || $8::uuid END,
+				target_name = CASE WHEN catalog_proposals.status = 'pending'
+					THEN EXCLUDED.target_name ELSE catalog_proposals.target_name END,
+				similarity = CASE WHEN catalog_proposals.status = 'pending'
+					THEN EXCLUDED.similarity ELSE catalog_proposals.similarity END,
+				updated_at = now()
+		`, u.kind, u.key, u.variants[0], u.variants, target, similarity, u.count, userID)
+	}
+	if err := s.Pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("error recording unknown names: %w", err)
+	}
+	log.Printf("Recorded %d unknown catalog names", len(unknown))
+	return nil
+}
+
+// proposalClusterCandidates returns, for each unknown name's kind and key,
+// the recorded clusters it may join: the cluster with its own key, whatever
+// its status, and the pending clusters with a similar key. Candidates are
+// matched on pg_trgm's similarity, the Jaccard index of the same trigrams
+// llm.NameSimilarity takes the Dice coefficient of, so the query keeps every
+// cluster closestCluster could choose without reading the whole table.
+func (s *SupabaseStore) proposalClusterCandidates(ctx context.Context, names []observedName) (map[string][]string, error) {
+	kinds := make([]string, len(names))
+	keys := make([]string, len(names))
+	for i, n := range names {
+		kinds[i], keys[i] = n.kind, n.key
+	}
+	rows, err := s.Pool.Query(ctx, `
+		SELECT DISTINCT u.kind, u.key, p.cluster_key
+		FROM unnest($1::text[], $2::text[]) AS u(kind, key)
+		JOIN catalog_proposals p ON p.kind = u.kind
+		WHERE p.cluster_key = u.key
+			OR (p.status = 'pending' AND p.cluster_key % u.key AND similarity(p.cluster_key, u.key) >= $3)
+	`, kinds, keys, proposalCandidateSimilarity)
+	if err != nil {
+		return nil, fmt.Errorf("error getting proposal clusters: %w", err)
+	}
+	candidates := map[string][]string{}
+	var kind, key, cluster string
+	_, err = pgx.ForEachRow(rows, []any{&kind, &key, &cluster}, func() error {
+		candidates[kind+":"+key] = append(candidates[kind+":"+key], cluster)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting proposal clusters: %w", err)
+	}
+	return candidates, nil
+}
+
+// closestCluster returns the most similar of the cluster keys that key is a
+// typo of, or key itself when there is none
+func closestCluster(key string, clusters []string) string {
+	best, bestSimilarity := key, ProposalClusterSimilarity
+	for _, cluster := range clusters {
+		if cluster == key {
+			return key
+		}
+		similarity := llm.NameSimilarity(key, cluster)
+		if similarity >= bestSimilarity && llm.TypoVariants(key, cluster) {
+			best, bestSimilarity = cluster, similarity
+		}
+	}
+	return best
+}
+
+// ListCatalogProposals returns the proposals with the given status, and kind
+// when it is set, most frequently seen first
+func (s *SupabaseStore) ListCatalogProposals(status string, kind string, limit int) ([]CatalogProposal, error) {
+	rows, err := s.Pool.Query(context.Background(), `SELECT `+catalogProposalColumns+`
+		FROM catalog_proposals
+		WHERE status = $1 AND ($2 = '' OR kind = $2)
+		ORDER BY occurrences DESC, updated_at DESC
+		LIMIT $3`, status, kind, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing catalog proposals: %w", err)
+	}
+	return pgx.CollectRows(rows, scanCatalogProposal)
+}
+
+// ProposalDecision approves a proposal, optionally overriding what it proposes
+type ProposalDecision struct {
+	// Action is ProposalActionAlias or ProposalActionNew, or empty to keep the proposed one
+	Action string `json:"action"`
+	// Name is the catalog name a new entry gets, or empty to keep the proposed one
+	Name string `json:"name"`
+	// TargetName is the catalog exercise aliases are added to, or empty to keep the proposed one
+	TargetName string `json:"target_name"`
+}
+
+// ApproveCatalogProposal applies a pending proposal to the catalog and marks
+// it approved, returning nil when there is no such proposal
+func (s *SupabaseStore) ApproveCatalogProposal(id string, decision ProposalDecision) (*CatalogProposal, error) {
+	ctx := context.Background()
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && rbErr != pgx.ErrTxClosed {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
+	}()
+
+	proposal, err := lockProposal(ctx, tx, id)
+	if err != nil || proposal == nil {
+		return nil, err
+	}
+	if decision.Action != "" {
+		proposal.Action = decision.Action
+	}
+	if decision.Name != "" {
+		proposal.Name = decision.Name
+	}
+	if decision.TargetName != "" {
+		proposal.TargetName = decision.TargetName
+	}
+	if proposal.Action == ProposalActionNew {
+		proposal.TargetName = ""
+	}
+
+	switch {
+	case proposal.Action == ProposalActionAlias && proposal.Kind == ProposalKindExercise:
+		err = addAliases(ctx, tx, proposal.TargetName, proposal.Variants)
+	case proposal.Action == ProposalActionNew && proposal.Kind == ProposalKindExercise:
+		_, err = tx.Exec(ctx, `INSERT INTO catalog_exercises (name, aliases) VALUES ($1, $2)`,
+			proposal.Name, mergeAliases(proposal.Name, nil, proposal.Variants))
+	case proposal.Action == ProposalActionNew && proposal.Kind == ProposalKindAttribute:
+		_, err = tx.Exec(ctx, `INSERT INTO catalog_attributes (name) VALUES ($1)`, proposal.Name)
+	default:
+		err = ErrProposalAction
+	}
+	if err != nil {
+		return nil, catalogError(err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		UPDATE catalog_proposals SET
+			status = 'approved',
+			name = $2,
+			target_name = NULLIF($3, ''),
+			decided_at = now(),
+			updated_at = now()
+		WHERE id = $1::uuid
+		RETURNING `+catalogProposalColumns, id, proposal.Name, proposal.TargetName)
+	if err != nil {
+		return nil, fmt.Errorf("error approving catalog proposal: %w", err)
+	}
+	approved, err := pgx.CollectOneRow(rows, scanCatalogProposal)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	s.catalogChanged(ctx)
+	return &approved, nil
+}
+
+// RejectCatalogProposal marks a pending proposal rejected, so its names are
+// not proposed again, returning nil when there is no such proposal
+func (s *SupabaseStore) RejectCatalogProposal(id string) (*CatalogProposal, error) {
+	ctx := context.Background()
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && rbErr != pgx.ErrTxClosed {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
+	}()
+
+	proposal, err := lockProposal(ctx, tx, id)
+	if err != nil || proposal == nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, `
+		UPDATE catalog_proposals SET status = 'rejected', decided_at = now(), updated_at = now()
+		WHERE id = $1::uuid
+		RETURNING `+catalogProposalColumns, id)
+	if err != nil {
+		return nil, fmt.Errorf("error rejecting catalog proposal: %w", err)
+	}
+	rejected, err := pgx.CollectOneRow(rows, scanCatalogProposal)
+	if err != nil {
+		return nil, err
+	}
+	return &rejected, tx.Commit(ctx)
+}
+
+// lockProposal loads a pending proposal for update, returning nil when there
+// is no such proposal and ErrProposalDecided when it is no longer pending
+func lockProposal(ctx context.Context, tx pgx.Tx, id string) (*CatalogProposal, error) {
+	rows, err := tx.Query(ctx, `SELECT `+catalogProposalColumns+`
+		FROM catalog_proposals WHERE id = $1::uuid FOR UPDATE`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading catalog proposal: %w", err)
+	}
+	proposal, err := pgx.CollectOneRow(rows, scanCatalogProposal)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Status != ProposalPending {
+		return nil, ErrProposalDecided
+	}
+	return &proposal, nil
+}
+
+// addAliases adds names to the aliases of the catalog exercise named target
+func addAliases(ctx context.Context, tx pgx.Tx, target string, names []string) error {
+	var id, name string
+	var aliases []string
+	err := tx.QueryRow(ctx, `SELECT id::text, name, aliases FROM catalog_exercises
+		WHERE lower(name) = lower($1) FOR UPDATE`, target).Scan(&id, &name, &aliases)
+	if err == pgx.ErrNoRows {
+		return ErrProposalTarget
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE catalog_exercises SET aliases = $2, updated_at = now() WHERE id = $1::uuid`,
+		id, mergeAliases(name, aliases, names))
+	return err
+}
+
+// mergeAliases adds names to aliases, skipping the exercise's own name and
+// names already present regardless of case
+func mergeAliases(name string, aliases []string, names []string) []string {
+	merged := nonNil(slices.Clone(aliases))
+	for _, n := range names {
+		if strings.EqualFold(n, name) || slices.ContainsFunc(merged, func(a string) bool { return strings.EqualFold(a, n) }) {
+			continue
+		}
+		merged = append(merged, n)
+	}
+	return merged
+}
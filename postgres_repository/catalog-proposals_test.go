@@ -0,0 +1,33 @@
+package repository
+
+import "testing"
+
+func TestClosestCluster(t *testing.T) {
+	clusters := []string{"dumbbell row", "back squat", "decline bench press"}
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "dumbbell row", want: "dumbbell row"},
+		{key: "dumbell row", want: "dumbbell row"},
+		{key: "hack squat", want: "hack squat"},
+		{key: "incline bench press", want: "incline bench press"},
+		{key: "zercher squat", want: "zercher squat"},
+	}
+	for _, tt := range tests {
+		if got := closestCluster(tt.key, clusters); got != tt.want {
+			t.Errorf("closestCluster(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+	if got := closestCluster("dumbell row", nil); got != "dumbell row" {
+		t.Errorf("closestCluster without clusters = %q, want the key", got)
+	}
+}
+
+func TestProposalCandidateSimilarity(t *testing.T) {
+	// Names join clusters at a Dice coefficient of ProposalClusterSimilarity,
+	// so candidates must be kept down to the Jaccard index it corresponds to
+	if jaccard := ProposalClusterSimilarity / (2 - ProposalClusterSimilarity); proposalCandidateSimilarity > jaccard {
+		t.Errorf("candidate similarity %v drops clusters joined at a Jaccard index of %v", proposalCandidateSimilarity, jaccard)
+	}
+}
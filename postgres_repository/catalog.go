@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"noerkrieg.com/server/redis_repository"
+)
+
+// catalogCacheTTL bounds how long a cached catalog context outlives a change
+// whose invalidation failed
+const catalogCacheTTL = time.Hour
+
+// ErrCatalogConflict is returned when a catalog name is already taken
+var ErrCatalogConflict = errors.New("a catalog entry with this name already exists")
+
+const catalogExerciseColumns = `id::text, name, aliases, muscle_groups, equipment, type, created_at, updated_at`
+
+func scanCatalogExercise(row pgx.CollectableRow) (CatalogExercise, error) {
+	var ex CatalogExercise
+	err := row.Scan(&ex.ID, &ex.Name, &ex.Aliases, &ex.MuscleGroups, &ex.Equipment,
+		&ex.Type, &ex.CreatedAt, &ex.UpdatedAt)
+	return ex, err
+}
+
+func scanCatalogAttribute(row pgx.CollectableRow) (CatalogAttribute, error) {
+	var attribute CatalogAttribute
+	err := row.Scan(&attribute.ID, &attribute.Name, &attribute.CreatedAt)
+	return attribute, err
+}
+
+// ListCatalogExercises returns the catalog exercises ordered by name
+func (s *SupabaseStore) ListCatalogExercises() ([]CatalogExercise, error) {
+	rows, err := s.Pool.Query(context.Background(),
+		`SELECT `+catalogExerciseColumns+` FROM catalog_exercises ORDER BY lower(name)`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing catalog exercises: %w", err)
+	}
+	return pgx.CollectRows(rows, scanCatalogExercise)
+}
+
+// GetCatalogExercise returns a catalog exercise, or nil when there is none
+func (s *SupabaseStore) GetCatalogExercise(id string) (*CatalogExercise, error) {
+	rows, err := s.Pool.Query(context.Background(),
+		`SELECT `+catalogExerciseColumns+` FROM catalog_exercises WHERE id = $1::uuid`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading catalog exercise: %w", err)
+	}
+	ex, err := pgx.CollectOneRow(rows, scanCatalogExercise)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ex, nil
+}
+
+// CreateCatalogExercise adds an exercise to the catalog
+func (s *SupabaseStore) CreateCatalogExercise(ex CatalogExercise) (*CatalogExercise, error) {
+	ctx := context.Background()
+	rows, err := s.Pool.Query(ctx, `
+		INSERT INTO catalog_exercises (name, aliases, muscle_groups, equipment, type)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+catalogExerciseColumns,
+		ex.Name, nonNil(ex.Aliases), nonNil(ex.MuscleGroups), nonNil(ex.Equipment), ex.Type)
+	if err != nil {
+		return nil, fmt.Errorf("error creating catalog exercise: %w", err)
+	}
+	created, err := pgx.CollectOneRow(rows, scanCatalogExercise)
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	s.catalogChanged(ctx)
+	return &created, nil
+}
+
+// UpdateCatalogExercise replaces a catalog exercise, returning nil when there
+// is no such exercise
+func (s *SupabaseStore) UpdateCatalogExercise(ex CatalogExercise) (*CatalogExercise, error) {
+	ctx := context.Background()
+	rows, err := s.Pool.Query(ctx, `
+		UPDATE catalog_exercises SET
+			name = $2,
+			aliases = $3,
+			muscle_groups = $4,
+			equipment = $5,
+			type = $6,
+			updated_at = now()
+		WHERE id = $1::uuid
+		RETURNING `+catalogExerciseColumns,
+		ex.ID, ex.Name, nonNil(ex.Aliases), nonNil(ex.MuscleGroups), nonNil(ex.Equipment), ex.Type)
+	if err != nil {
+		return nil, fmt.Errorf("error updating catalog exercise: %w", err)
+	}
+	updated, err := pgx.CollectOneRow(rows, scanCatalogExercise)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	s.catalogChanged(ctx)
+	return &updated, nil
+}
+
+// DeleteCatalogExercise removes a catalog exercise, reporting whether it existed
+func (s *SupabaseStore) DeleteCatalogExercise(id string) (bool, error) {
+	ctx := context.Background()
+	tag, err := s.Pool.Exec(ctx, `DELETE FROM catalog_exercises WHERE id = $1::uuid`, id)
+	if err != nil {
+		return false, fmt.Errorf("error deleting catalog exercise: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	s.catalogChanged(ctx)
+	return true, nil
+}
+
+// ListCatalogAttributes returns the catalog attributes ordered by name
+func (s *SupabaseStore) ListCatalogAttributes() ([]CatalogAttribute, error) {
+	rows, err := s.Pool.Query(context.Background(),
+		`SELECT id::text, name, created_at FROM catalog_attributes ORDER BY lower(name)`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing catalog attributes: %w", err)
+	}
+	return pgx.CollectRows(rows, scanCatalogAttribute)
+}
+
+// CreateCatalogAttribute adds an attribute to the catalog
+func (s *SupabaseStore) CreateCatalogAttribute(name string) (*CatalogAttribute, error) {
+	ctx := context.Background()
+	rows, err := s.Pool.Query(ctx, `
+		INSERT INTO catalog_attributes (name) VALUES ($1)
+		RETURNING id::text, name, created_at`, name)
+	if err != nil {
+		return nil, fmt.Errorf("error creating catalog attribute: %w", err)
+	}
+	created, err := pgx.CollectOneRow(rows, scanCatalogAttribute)
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	s.catalogChanged(ctx)
+	return &created, nil
+}
+
+// DeleteCatalogAttribute removes a catalog attribute, reporting whether it existed
+func (s *SupabaseStore) DeleteCatalogAttribute(id string) (bool, error) {
+	ctx := context.Background()
+	tag, err := s.Pool.Exec(ctx, `DELETE FROM catalog_attributes WHERE id = $1::uuid`, id)
+	if err != nil {
+		return false, fmt.Errorf("error deleting catalog attribute: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	s.catalogChanged(ctx)
+	return true, nil
+}
+
+// CatalogContext returns the known exercises, their aliases and the known
+// attributes for the prompt, read through the catalog cache when there is one
+func (s *SupabaseStore) CatalogContext(ctx context.Context) (*redis_repository.ExerciseContext, error) {
+	if s.CatalogCache != nil {
+		cached, err := redis_repository.CachedCatalog(ctx, s.CatalogCache)
+		if err != nil {
+			log.Printf("Error reading cached catalog: %v", err)
+		} else if cached != nil {
+			return cached, nil
+		}
+	}
+
+	catalog := &redis_repository.ExerciseContext{
+		Exercises:  []string{},
+		Attributes: []string{},
+		Aliases:    map[string][]string{},
+	}
+	exercises, err := s.ListCatalogExercises()
+	if err != nil {
+		return nil, err
+	}
+	for _, ex := range exercises {
+		catalog.Exercises = append(catalog.Exercises, ex.Name)
+		if len(ex.Aliases) > 0 {
+			catalog.Aliases[ex.Name] = ex.Aliases
+		}
+	}
+	attributes, err := s.ListCatalogAttributes()
+	if err != nil {
+		return nil, err
+	}
+	for _, attribute := range attributes {
+		catalog.Attributes = append(catalog.Attributes, attribute.Name)
+	}
+
+	if s.CatalogCache != nil {
+		if err := redis_repository.CacheCatalog(ctx, s.CatalogCache, catalog, catalogCacheTTL); err != nil {
+			log.Printf("Error caching catalog: %v", err)
+		}
+	}
+	return catalog, nil
+}
+
+// SeedCatalog fills an empty catalog with the given exercises and attributes,
+// reporting whether it did
+func (s *SupabaseStore) SeedCatalog(ctx context.Context, seed *redis_repository.ExerciseContext) (bool, error) {
+	var count int
+	if err := s.Pool.QueryRow(ctx, `SELECT
+		(SELECT count(*) FROM catalog_exercises) + (SELECT count(*) FROM catalog_attributes)`).Scan(&count); err != nil {
+		return false, fmt.Errorf("error counting catalog entries: %w", err)
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, name := range seed.Exercises {
+		batch.Queue(`INSERT INTO catalog_exercises (name) VALUES ($1) ON CONFLICT DO NOTHING`, name)
+	}
+	for _, name := range seed.Attributes {
+		batch.Queue(`INSERT INTO catalog_attributes (name) VALUES ($1) ON CONFLICT DO NOTHING`, name)
+	}
+	if err := s.Pool.SendBatch(ctx, batch).Close(); err != nil {
+		return false, fmt.Errorf("error seeding catalog: %w", err)
+	}
+	s.catalogChanged(ctx)
+	return true, nil
+}
+
+// catalogChanged invalidates the cached catalog context and tells every
+// instance to reload the one its prompts use
+func (s *SupabaseStore) catalogChanged(ctx context.Context) {
+	if s.CatalogCache == nil {
+		return
+	}
+	if err := redis_repository.InvalidateCatalog(ctx, s.CatalogCache); err != nil {
+		log.Printf("Error invalidating cached catalog: %v", err)
+	}
+	if err := redis_repository.PublishCatalogChange(ctx, s.CatalogCache); err != nil {
+		log.Printf("Error publishing catalog change: %v", err)
+	}
+}
+
+// catalogError maps a unique violation on a catalog name to ErrCatalogConflict
+func catalogError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrCatalogConflict
+	}
+	return err
+}
+
+// nonNil returns an empty slice for nil, for NOT NULL array columns
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
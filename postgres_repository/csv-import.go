@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"noerkrieg.com/server/importer"
+	llm "noerkrieg.com/server/llm"
+	"noerkrieg.com/server/units"
+)
+
+// processCSVImportJob maps an app's CSV export straight to exercises,
+// skipping rows that are already stored for the user
+func (w *WorkQueue) processCSVImportJob(job *Job) (json.RawMessage, error) {
+	var req CSVImportRequest
+	if err := json.Unmarshal(job.Data, &req); err != nil {
+		return nil, fmt.Errorf("invalid csv import request: %w", err)
+	}
+
+	loc := time.UTC
+	if req.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(req.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", req.Timezone)
+		}
+	}
+
+	ctx := context.Background()
+	content := req.CSV
+	if req.UploadID != "" {
+		file, err := w.store.loadUpload(ctx, req.UploadID, job.UserID)
+		if err != nil {
+			return nil, err
+		}
+		content = string(file)
+	}
+
+	records, rowErrors, err := importer.ParseCSV(req.Source, strings.NewReader(content),
+		importer.Options{WeightUnit: req.WeightUnit, Location: loc})
+	if err != nil {
+		return nil, err
+	}
+
+	result := CSVImportResult{
+		Source:    req.Source,
+		Exercises: len(records),
+		Errors:    rowErrors,
+	}
+
+	for _, record := range records {
+		ex := record.Exercise
+		ex.UserId = job.UserID
+
+		duplicate, err := w.store.importedExists(ctx, ex)
+		if err != nil {
+			result.Errors = append(result.Errors, importer.RowError{Row: record.Row, Error: err.Error()})
+			continue
+		}
+		if duplicate {
+			result.Duplicates++
+			continue
+		}
+
+		if _, err := insertExercise(ctx, w.store.Pool, ex); err != nil {
+			// A concurrent import of the same export stored the row first
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				result.Duplicates++
+				continue
+			}
+			result.Errors = append(result.Errors, importer.RowError{Row: record.Row, Error: err.Error()})
+			continue
+		}
+		result.Imported++
+	}
+
+	log.Printf("CSV import summary: source=%s, exercises=%d, imported=%d, duplicates=%d, errors=%d",
+		req.Source, result.Exercises, result.Imported, result.Duplicates, len(result.Errors))
+
+	if result.Imported == 0 && result.Duplicates == 0 && len(result.Errors) > 0 {
+		return nil, fmt.Errorf("failed to import any rows: row %d: %s",
+			result.Errors[0].Row, result.Errors[0].Error)
+	}
+	return json.Marshal(result)
+}
+
+// importedExists reports whether the user already has the export row ex was
+// imported from. Exercises imported before rows were keyed are matched like
+// exerciseExists matches them.
+func (s *SupabaseStore) importedExists(ctx context.Context, ex llm.Exercise) (bool, error) {
+	ex = units.Canonical(ex)
+	var exists bool
+	err := s.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM exercises
+			WHERE user_id = $1::uuid
+				AND (import_key = $2 OR (import_key IS NULL
+					AND lower(exercise_name) = lower($3)
+					AND created_ts = $4
+					AND sets = $5
+					AND work = $6
+					AND resistance = $7
+					AND duration = $8))
+		)`,
+		ex.UserId, ex.ImportKey, ex.Exercise, ex.Timestamp, ex.Sets, ex.Quantity, ex.Resistance, ex.Duration,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking for duplicate %s: %w", ex.Exercise, err)
+	}
+	return exists, nil
+}
+
+// exerciseExists reports whether the user already has an exercise with the
+// same name, time and load, as happens when the same export is imported twice
+func (s *SupabaseStore) exerciseExists(ctx context.Context, ex llm.Exercise) (bool, error) {
+	ex = units.Canonical(ex)
+	var exists bool
+	err := s.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM exercises
+			WHERE user_id = $1::uuid
+				AND lower(exercise_name) = lower($2)
+				AND created_ts = $3
+				AND sets = $4
+				AND work = $5
+				AND resistance = $6
+				AND duration = $7
+		)`,
+		ex.UserId, ex.Exercise, ex.Timestamp, ex.Sets, ex.Quantity, ex.Resistance, ex.Duration,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking for duplicate %s: %w", ex.Exercise, err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"noerkrieg.com/server/redis_repository"
+)
+
+const customExerciseColumns = `id::text, name, aliases, created_at, updated_at`
+
+func scanCustomExercise(row pgx.CollectableRow) (CustomExercise, error) {
+	var ex CustomExercise
+	err := row.Scan(&ex.ID, &ex.Name, &ex.Aliases, &ex.CreatedAt, &ex.UpdatedAt)
+	return ex, err
+}
+
+func scanCustomAttribute(row pgx.CollectableRow) (CustomAttribute, error) {
+	var attribute CustomAttribute
+	err := row.Scan(&attribute.ID, &attribute.Name, &attribute.CreatedAt)
+	return attribute, err
+}
+
+// ListCustomExercises returns the user's custom exercises ordered by name
+func (s *SupabaseStore) ListCustomExercises(userID string) ([]CustomExercise, error) {
+	rows, err := s.Pool.Query(context.Background(), `SELECT `+customExerciseColumns+`
+		FROM custom_exercises WHERE user_id = $1::uuid ORDER BY lower(name)`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing custom exercises: %w", err)
+	}
+	return pgx.CollectRows(rows, scanCustomExercise)
+}
+
+// CreateCustomExercise adds an exercise to the user's custom exercises. Naming
+// it like a catalog exercise adds the user's own aliases to that exercise.
+func (s *SupabaseStore) CreateCustomExercise(userID string, ex CustomExercise) (*CustomExercise, error) {
+	rows, err := s.Pool.Query(context.Background(), `
+		INSERT INTO custom_exercises (user_id, name, aliases)
+		VALUES ($1::uuid, $2, $3)
+		RETURNING `+customExerciseColumns,
+		userID, ex.Name, nonNil(ex.Aliases))
+	if err != nil {
+		return nil, fmt.Errorf("error creating custom exercise: %w", err)
+	}
+	created, err := pgx.CollectOneRow(rows, scanCustomExercise)
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return &created, nil
+}
+
+// UpdateCustomExercise replaces one of the user's custom exercises, returning
+// nil when there is no such exercise
+func (s *SupabaseStore) UpdateCustomExercise(userID string, ex CustomExercise) (*CustomExercise, error) {
+	rows, err := s.Pool.Query(context.Background(), `
+		UPDATE custom_exercises SET name = $3, aliases = $4, updated_at = now()
+		WHERE id = $1::uuid AND user_id = $2::uuid
+		RETURNING `+customExerciseColumns,
+		ex.ID, userID, ex.Name, nonNil(ex.Aliases))
+	if err != nil {
+		return nil, fmt.Errorf("error updating custom exercise: %w", err)
+	}
+	updated, err := pgx.CollectOneRow(rows, scanCustomExercise)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return &updated, nil
+}
+
+// DeleteCustomExercise removes one of the user's custom exercises, reporting
+// whether it existed
+func (s *SupabaseStore) DeleteCustomExercise(id string, userID string) (bool, error) {
+	tag, err := s.Pool.Exec(context.Background(),
+		`DELETE FROM custom_exercises WHERE id = $1::uuid AND user_id = $2::uuid`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("error deleting custom exercise: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListCustomAttributes returns the user's custom attributes ordered by name
+func (s *SupabaseStore) ListCustomAttributes(userID string) ([]CustomAttribute, error) {
+	rows, err := s.Pool.Query(context.Background(), `SELECT id::text, name, created_at
+		FROM custom_attributes WHERE user_id = $1::uuid ORDER BY lower(name)`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing custom attributes: %w", err)
+	}
+	return pgx.CollectRows(rows, scanCustomAttribute)
+}
+
+// CreateCustomAttribute adds an attribute to the user's custom attributes
+func (s *SupabaseStore) CreateCustomAttribute(userID string, name string) (*CustomAttribute, error) {
+	rows, err := s.Pool.Query(context.Background(), `
+		INSERT INTO custom_attributes (user_id, name) VALUES ($1::uuid, $2)
+		RETURNING id::text, name, created_at`, userID, name)
+	if err != nil {
+		return nil, fmt.Errorf("error creating custom attribute: %w", err)
+	}
+	created, err := pgx.CollectOneRow(rows, scanCustomAttribute)
+	if err != nil {
+		return nil, catalogError(err)
+	}
+	return &created, nil
+}
+
+// DeleteCustomAttribute removes one of the user's custom attributes, reporting
+// whether it existed
+func (s *SupabaseStore) DeleteCustomAttribute(id string, userID string) (bool, error) {
+	tag, err := s.Pool.Exec(context.Background(),
+		`DELETE FROM custom_attributes WHERE id = $1::uuid AND user_id = $2::uuid`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("error deleting custom attribute: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// CustomContext returns the user's custom exercises, their aliases and the
+// user's custom attributes, for merging with the catalog when parsing the
+// user's messages
+func (s *SupabaseStore) CustomContext(ctx context.Context, userID string) (*redis_repository.ExerciseContext, error) {
+	custom := &redis_repository.ExerciseContext{
+		Exercises:  []string{},
+		Attributes: []string{},
+		Aliases:    map[string][]string{},
+	}
+	rows, err := s.Pool.Query(ctx, `
+		SELECT 'exercise', name, aliases FROM custom_exercises WHERE user_id = $1::uuid
+		UNION ALL
+		SELECT 'attribute', name, '{}'::text[] FROM custom_attributes WHERE user_id = $1::uuid
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading custom exercises: %w", err)
+	}
+	var kind, name string
+	var aliases []string
+	_, err = pgx.ForEachRow(rows, []any{&kind, &name, &aliases}, func() error {
+		if kind == "attribute" {
+			custom.Attributes = append(custom.Attributes, name)
+			return nil
+		}
+		custom.Exercises = append(custom.Exercises, name)
+		if len(aliases) > 0 {
+			custom.Aliases[name] = slices.Clone(aliases)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading custom exercises: %w", err)
+	}
+	return custom, nil
+}
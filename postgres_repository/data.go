@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"sync"
 	"time"
+
+	"noerkrieg.com/server/importer"
+	llm "noerkrieg.com/server/llm"
 )
 
 type Job struct {
@@ -16,6 +19,11 @@ type Job struct {
 	UpdatedAt  time.Time       `json:"updated_at"`
 	RetryCount int             `json:"-"` // Hidden from API responses
 	UserID     string          `json:"user_id,omitempty"`
+	// LLM usage accumulated over every attempt at the job
+	PromptTokens     int     `json:"prompt_tokens,omitempty"`
+	CompletionTokens int     `json:"completion_tokens,omitempty"`
+	CostUSD          float64 `json:"cost_usd,omitempty"`
+	PromptVersion    string  `json:"prompt_version,omitempty"`
 }
 
 const (
@@ -26,9 +34,287 @@ const (
 	StatusFailed     = "failed"
 )
 
+// Job types are carried in Job.Data under the "type" key. Jobs without a type
+// are treated as message jobs, which is what clients have always inserted.
+const (
+	JobTypeMessage   = "message"
+	JobTypeReparse   = "reparse"
+	JobTypeCSVImport = "csv_import"
+	JobTypeExport    = "export"
+	JobTypeActivity  = "activity_import"
+)
+
+// Job priorities, claimed highest first
+const (
+	PriorityDefault = 0
+	PriorityLow     = -10
+)
+
+// Defaults for the StoreOptions and WorkQueue.PollInterval
+const (
+	DefaultMaxConns           = 8
+	DefaultNotificationBuffer = 100
+	DefaultPollInterval       = 30 * time.Second
+)
+
+// MaxRetries is the number of failed attempts after which a job is no longer claimed
+const MaxRetries = 3
+
+// MessageRequest is the Job.Data payload for a message job
+type MessageRequest struct {
+	Type    string `json:"type,omitempty"`
+	Message string `json:"message"`
+	// Timestamp overrides the time stamped on the extracted exercises
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	// Timezone is the user's IANA time zone, for resolving relative times
+	// such as "yesterday morning". UTC when empty.
+	Timezone string `json:"timezone,omitempty"`
+	// ImportID links the job to the import record it reports progress to
+	ImportID string `json:"import_id,omitempty"`
+}
+
+// ReparseRequest is the Job.Data payload for a reparse job
+type ReparseRequest struct {
+	Type  string `json:"type"`
+	JobID string `json:"job_id"`
+	Apply bool   `json:"apply"`
+}
+
+// ExerciseChange describes a stored exercise whose fields differ after reparsing
+type ExerciseChange struct {
+	Before llm.Exercise `json:"before"`
+	After  llm.Exercise `json:"after"`
+	Fields []string     `json:"fields"`
+}
+
+// ExerciseDiff is the difference between stored exercises and a fresh extraction
+type ExerciseDiff struct {
+	Added   []llm.Exercise   `json:"added"`
+	Removed []llm.Exercise   `json:"removed"`
+	Changed []ExerciseChange `json:"changed"`
+}
+
+// ReparseResult is the Job.Result payload for a reparse job
+type ReparseResult struct {
+	SourceJobID   string          `json:"source_job_id"`
+	Diff          ExerciseDiff    `json:"diff"`
+	Applied       bool            `json:"applied"`
+	Data          json.RawMessage `json:"data,omitempty"`
+	PromptVersion string          `json:"prompt_version"`
+}
+
+// CSVImportRequest is the Job.Data payload for a CSV import job. The CSV
+// file is stored apart, as the upload UploadID.
+type CSVImportRequest struct {
+	Type     string `json:"type"`
+	Source   string `json:"source"`
+	UploadID string `json:"upload_id"`
+	// CSV holds the file of jobs enqueued before uploads were stored apart
+	CSV        string `json:"csv,omitempty"`
+	WeightUnit string `json:"weight_unit,omitempty"`
+	Timezone   string `json:"timezone,omitempty"`
+}
+
+// CSVImportResult is the Job.Result payload for a CSV import job
+type CSVImportResult struct {
+	Source     string              `json:"source"`
+	Exercises  int                 `json:"exercises"`
+	Imported   int                 `json:"imported"`
+	Duplicates int                 `json:"duplicates"`
+	Errors     []importer.RowError `json:"errors"`
+}
+
+// Import tracks the jobs enqueued for a bulk notes import
+type Import struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Status    string    `json:"status"`
+	Total     int       `json:"total"`
+	Completed int       `json:"completed"`
+	Failed    int       `json:"failed"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CatalogExercise is a canonical exercise the LLM maps exercise names to
+type CatalogExercise struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Aliases      []string  `json:"aliases"`
+	MuscleGroups []string  `json:"muscle_groups"`
+	Equipment    []string  `json:"equipment"`
+	Type         string    `json:"type"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// CatalogAttribute is a canonical exercise attribute, such as "Incline"
+type CatalogAttribute struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CustomExercise is an exercise a user made up, known only when parsing that
+// user's messages
+type CustomExercise struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Aliases   []string  `json:"aliases"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CustomAttribute is an attribute a user made up, known only when parsing
+// that user's messages
+type CustomAttribute struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Catalog proposal kinds, statuses and actions
+const (
+	ProposalKindExercise  = "exercise"
+	ProposalKindAttribute = "attribute"
+
+	ProposalPending  = "pending"
+	ProposalApproved = "approved"
+	ProposalRejected = "rejected"
+
+	// ProposalActionAlias adds the variants as aliases of TargetName
+	ProposalActionAlias = "alias"
+	// ProposalActionNew adds Name to the catalog, with the other variants as aliases
+	ProposalActionNew = "new"
+)
+
+// ProposalAliasSimilarity is the name similarity to a catalog exercise above
+// which unknown names are proposed as its aliases rather than a new exercise
+const ProposalAliasSimilarity = 0.6
+
+// ProposalClusterSimilarity is the name similarity above which an unknown name
+// joins an existing cluster whose key differs from its own only by typos
+const ProposalClusterSimilarity = 0.85
+
+// proposalCandidateSimilarity is the trigram similarity above which a pending
+// cluster is a candidate for an unknown name to join. A Dice coefficient of
+// ProposalClusterSimilarity is a Jaccard index of about 0.74; the lower bound
+// leaves room for keys normalized differently since they were recorded.
+const proposalCandidateSimilarity = 0.6
+
+// CatalogProposal is a cluster of unknown names the LLM produced that share a
+// normalized key, proposed as aliases of a catalog exercise or as a new entry
+type CatalogProposal struct {
+	ID          string     `json:"id"`
+	Kind        string     `json:"kind"`
+	Action      string     `json:"action"`
+	Name        string     `json:"name"`
+	Variants    []string   `json:"variants"`
+	TargetName  string     `json:"target_name,omitempty"`
+	Similarity  float64    `json:"similarity"`
+	Occurrences int        `json:"occurrences"`
+	Users       int        `json:"users"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+}
+
+// Preferences are a user's settings for reading their exercises
+type Preferences struct {
+	// UnitSystem is units.Metric or units.Imperial, or empty for the units
+	// each exercise was logged in
+	UnitSystem string    `json:"unit_system"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Workout is a session grouping the exercises of one or more messages
+type Workout struct {
+	ID        string         `json:"id"`
+	UserID    string         `json:"user_id"`
+	StartedAt time.Time      `json:"started_at"`
+	EndedAt   time.Time      `json:"ended_at"`
+	Groups    []WorkoutGroup `json:"groups"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// Workout group types
+const (
+	GroupSingle   = "single"
+	GroupSuperset = "superset"
+	GroupCircuit  = "circuit"
+)
+
+// WorkoutGroup is an exercise done on its own, or the exercises of a
+// superset or circuit, in the order they were performed
+type WorkoutGroup struct {
+	Type      string         `json:"type"`
+	Exercises []llm.Exercise `json:"exercises"`
+}
+
+// DefaultWorkoutMergeWindow is the gap between messages within which their
+// exercises are grouped into the same workout
+const DefaultWorkoutMergeWindow = 90 * time.Minute
+
+// ActivityImportRequest is the Job.Data payload for an activity file import.
+// The file is stored apart, as the upload UploadID.
+type ActivityImportRequest struct {
+	Type         string `json:"type"`
+	Format       string `json:"format"`
+	Filename     string `json:"filename"`
+	UploadID     string `json:"upload_id"`
+	DistanceUnit string `json:"distance_unit,omitempty"`
+	// File holds the file of jobs enqueued before uploads were stored apart
+	File []byte `json:"file,omitempty"`
+}
+
+// ExportRequest is the Job.Data payload for an export job
+type ExportRequest struct {
+	Type     string `json:"type"`
+	ExportID string `json:"export_id"`
+	Format   string `json:"format"`
+}
+
+// Export is a user's workout history export. Artifact holds the file once
+// the export job has completed and is never serialized.
+type Export struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	JobID       string     `json:"job_id"`
+	Format      string     `json:"format"`
+	Status      string     `json:"status"`
+	Rows        int        `json:"rows"`
+	Artifact    []byte     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// DailyUsage is a user's LLM usage aggregated over one day
+type DailyUsage struct {
+	Day              time.Time `json:"day"`
+	Calls            int       `json:"calls"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	CostUSD          float64   `json:"cost_usd"`
+}
+
 type WorkQueue struct {
-	workers  int
-	store    *SupabaseStore
-	wg       sync.WaitGroup
-	shutdown chan struct{}
+	// PollInterval is how often idle workers look for jobs they were not
+	// notified of
+	PollInterval time.Duration
+
+	workers   int
+	store     *SupabaseStore
+	extractor llm.Extractor
+	counters  []workerCounters
+	wg        sync.WaitGroup
+	shutdown  chan struct{}
+}
+
+// WorkerStats counts the jobs one worker finished since startup
+type WorkerStats struct {
+	Worker    string `json:"worker"`
+	Processed int64  `json:"processed"`
+	Failed    int64  `json:"failed"`
 }
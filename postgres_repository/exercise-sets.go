@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	llm "noerkrieg.com/server/llm"
+)
+
+// insertSets stores the set details of an exercise, replacing any it had
+func insertSets(ctx context.Context, q querier, exerciseID string, sets []llm.ExerciseSet) error {
+	if _, err := q.Exec(ctx, `DELETE FROM exercise_sets WHERE exercise_id::text = $1`, exerciseID); err != nil {
+		return fmt.Errorf("failed to clear sets of exercise %s: %w", exerciseID, err)
+	}
+	for i, set := range sets {
+		if _, err := q.Exec(ctx, `
+			INSERT INTO exercise_sets (exercise_id, position, reps, load, rpe, rir, rest_seconds, drop)
+			SELECT id, $2, $3, $4, $5, $6, $7, $8 FROM exercises WHERE id::text = $1
+		`, exerciseID, i+1, set.Reps, set.Load, set.RPE, set.RIR, set.RestSeconds, set.Drop); err != nil {
+			return fmt.Errorf("failed to insert set %d of exercise %s: %w", i+1, exerciseID, err)
+		}
+	}
+	return nil
+}
+
+// loadSets fills in the set details of exercises
+func loadSets(ctx context.Context, q querier, exercises []llm.Exercise) error {
+	if len(exercises) == 0 {
+		return nil
+	}
+	ids := make([]string, len(exercises))
+	for i, ex := range exercises {
+		ids[i] = ex.Id
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT exercise_id::text, reps, load, rpe, rir, rest_seconds, drop
+		FROM exercise_sets WHERE exercise_id::text = ANY($1::text[])
+		ORDER BY exercise_id, position`, ids)
+	if err != nil {
+		return fmt.Errorf("error loading exercise sets: %w", err)
+	}
+	sets := map[string][]llm.ExerciseSet{}
+	var id string
+	var set llm.ExerciseSet
+	_, err = pgx.ForEachRow(rows, []any{&id, &set.Reps, &set.Load, &set.RPE, &set.RIR, &set.RestSeconds, &set.Drop}, func() error {
+		sets[id] = append(sets[id], set)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading exercise sets: %w", err)
+	}
+
+	for i := range exercises {
+		exercises[i].SetDetails = sets[exercises[i].Id]
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"noerkrieg.com/server/export"
+	"noerkrieg.com/server/units"
+)
+
+// CreateExport records an export and enqueues the job that produces it
+func (s *SupabaseStore) CreateExport(userID string, format string) (*Export, error) {
+	ctx := context.Background()
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && rbErr != pgx.ErrTxClosed {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
+	}()
+
+	record := Export{UserID: userID, Format: format, Status: StatusPending}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO exports (user_id, format, status)
+		VALUES ($1::uuid, $2::text, $3::text)
+		RETURNING id, created_at
+	`, userID, format, StatusPending).Scan(&record.ID, &record.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating export: %w", err)
+	}
+
+	payload, err := json.Marshal(ExportRequest{Type: JobTypeExport, ExportID: record.ID, Format: format})
+	if err != nil {
+		return nil, err
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO jobs (status, data, error, user_id, priority)
+		VALUES ($1::text, $2::jsonb, '', $3::uuid, $4::integer)
+		RETURNING id
+	`, StatusPending, payload, userID, PriorityDefault).Scan(&record.JobID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating export job: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE exports SET job_id = $1::uuid WHERE id = $2::uuid`,
+		record.JobID, record.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// GetExport returns the user's export including its artifact, or nil if
+// there is none
+func (s *SupabaseStore) GetExport(id string, userID string) (*Export, error) {
+	var record Export
+	var jobID *string
+	err := s.Pool.QueryRow(context.Background(), `
+		SELECT id, user_id, job_id::text, format, status, rows, artifact, created_at, completed_at
+		FROM exports WHERE id = $1::uuid AND user_id = $2::uuid
+	`, id, userID).Scan(
+		&record.ID,
+		&record.UserID,
+		&jobID,
+		&record.Format,
+		&record.Status,
+		&record.Rows,
+		&record.Artifact,
+		&record.CreatedAt,
+		&record.CompletedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if jobID != nil {
+		record.JobID = *jobID
+	}
+	return &record, nil
+}
+
+// exportPageSize is how many exercises an export reads at a time
+const exportPageSize = 500
+
+// processExportJob streams the user's exercises into the requested format
+// and stores the file on the export record
+func (w *WorkQueue) processExportJob(job *Job) (result json.RawMessage, err error) {
+	var req ExportRequest
+	if err := json.Unmarshal(job.Data, &req); err != nil {
+		return nil, fmt.Errorf("invalid export request: %w", err)
+	}
+
+	ctx := context.Background()
+	defer func() {
+		if err == nil {
+			return
+		}
+		if _, updateErr := w.store.Pool.Exec(ctx, `UPDATE exports SET status = $1::text WHERE id = $2::uuid`,
+			StatusFailed, req.ExportID); updateErr != nil {
+			log.Printf("Error marking export %s failed: %v", req.ExportID, updateErr)
+		}
+	}()
+
+	if _, err := w.store.Pool.Exec(ctx, `UPDATE exports SET status = $1::text WHERE id = $2::uuid`,
+		StatusProcessing, req.ExportID); err != nil {
+		return nil, fmt.Errorf("error updating export %s: %w", req.ExportID, err)
+	}
+
+	var buf bytes.Buffer
+	writer, err := export.NewWriter(req.Format, &buf)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs, err := w.store.GetPreferences(ctx, job.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exercises are read a page at a time, keyed on the last one written, so
+	// their sets can be loaded without holding a second connection
+	count := 0
+	var afterAt time.Time
+	afterID := "0"
+	for {
+		rows, err := w.store.Pool.Query(ctx, `SELECT `+exerciseColumns+` FROM exercises
+			WHERE user_id = $1::uuid AND (COALESCE(performed_at, created_ts), id) > ($2, $3::bigint)
+			ORDER BY COALESCE(performed_at, created_ts) ASC, id ASC
+			LIMIT $4`, job.UserID, afterAt, afterID, exportPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("error loading exercises: %w", err)
+		}
+		page, err := pgx.CollectRows(rows, scanExercise)
+		if err != nil {
+			return nil, fmt.Errorf("error reading exercise: %w", err)
+		}
+		if err := loadSets(ctx, w.store.Pool, page); err != nil {
+			return nil, err
+		}
+		for _, ex := range page {
+			if err := writer.Write(units.Display(ex, prefs.UnitSystem)); err != nil {
+				return nil, fmt.Errorf("error writing export: %w", err)
+			}
+		}
+		count += len(page)
+		if len(page) < exportPageSize {
+			break
+		}
+		last := page[len(page)-1]
+		afterAt, afterID = *last.PerformedAt, last.Id
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("error writing export: %w", err)
+	}
+
+	_, err = w.store.Pool.Exec(ctx, `
+		UPDATE exports SET status = $1::text, rows = $2::integer, artifact = $3, completed_at = now()
+		WHERE id = $4::uuid
+	`, StatusCompleted, count, buf.Bytes(), req.ExportID)
+	if err != nil {
+		return nil, fmt.Errorf("error storing export %s: %w", req.ExportID, err)
+	}
+
+	log.Printf("Export %s wrote %d exercises as %s (%d bytes)", req.ExportID, count, req.Format, buf.Len())
+	return json.Marshal(map[string]interface{}{
+		"export_id": req.ExportID,
+		"format":    req.Format,
+		"rows":      count,
+		"size":      buf.Len(),
+	})
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	llm "noerkrieg.com/server/llm"
+	"noerkrieg.com/server/units"
+)
+
+// RecentExercises loads the user's exercises performed in the days before
+// until, most recent first
+func (s *SupabaseStore) RecentExercises(ctx context.Context, userID string, until time.Time, days int, limit int) ([]llm.Exercise, error) {
+	rows, err := s.Pool.Query(ctx, `SELECT `+exerciseColumns+` FROM exercises
+		WHERE user_id = $1::uuid AND performed_at < $2 AND performed_at >= $3
+		ORDER BY performed_at DESC
+		LIMIT $4`, userID, until, until.AddDate(0, 0, -days), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error loading recent exercises: %w", err)
+	}
+	exercises, err := pgx.CollectRows(rows, scanExercise)
+	if err != nil {
+		return nil, err
+	}
+	return exercises, loadSets(ctx, s.Pool, exercises)
+}
+
+// extractionRequest builds the extraction request for a message sent at
+// sentAt with the user's custom exercises, adding the user's recent exercises
+// when the message refers to them. Failing to load either is logged and the
+// message is parsed without them.
+func (s *SupabaseStore) extractionRequest(ctx context.Context, job *Job, message string, sentAt time.Time) llm.Request {
+	req := llm.Request{Message: message, Key: job.ID, Now: sentAt}
+	custom, err := s.CustomContext(ctx, job.UserID)
+	if err != nil {
+		log.Printf("Parsing job %s without custom exercises: %v", job.ID, err)
+	}
+	req.Custom = custom
+	if !llm.NeedsHistory(message) {
+		return req
+	}
+	history, err := s.RecentExercises(ctx, job.UserID, sentAt, llm.HistoryDays, llm.HistoryLimit)
+	if err != nil {
+		log.Printf("Parsing job %s without history: %v", job.ID, err)
+		return req
+	}
+	log.Printf("Job %s refers to earlier workouts, adding %d recent exercises", job.ID, len(history))
+	// The model reads the exercises in the units the user logged them in
+	for i := range history {
+		history[i] = units.Display(history[i], units.AsLogged)
+	}
+	req.History = history
+	return req
+}
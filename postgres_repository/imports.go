@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"noerkrieg.com/server/importer"
+)
+
+// CreateImport records a bulk import and enqueues one low priority message
+// job per entry, stamped with the entry's date and the user's time zone
+func (s *SupabaseStore) CreateImport(userID string, entries []importer.Entry, timezone string) (*Import, error) {
+	ctx := context.Background()
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && rbErr != pgx.ErrTxClosed {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
+	}()
+
+	var record Import
+	err = tx.QueryRow(ctx, `
+		INSERT INTO imports (user_id, status, total)
+		VALUES ($1::uuid, $2::text, $3::integer)
+		RETURNING id, user_id, status, total, completed, failed, created_at, updated_at
+	`, userID, StatusProcessing, len(entries)).Scan(
+		&record.ID,
+		&record.UserID,
+		&record.Status,
+		&record.Total,
+		&record.Completed,
+		&record.Failed,
+		&record.CreatedAt,
+		&record.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating import: %w", err)
+	}
+
+	batch := &pgx.Batch{}
+	for _, entry := range entries {
+		date := entry.Date
+		payload, err := json.Marshal(MessageRequest{
+			Type:      JobTypeMessage,
+			Message:   entry.Text,
+			Timestamp: &date,
+			Timezone:  timezone,
+			ImportID:  record.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		batch.Queue(`
+			INSERT INTO jobs (status, data, error, user_id, priority)
+			VALUES ($1::text, $2::jsonb, '', $3::uuid, $4::integer)
+		`, StatusPending, payload, userID, PriorityLow)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, fmt.Errorf("error enqueuing import jobs: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	log.Printf("Import %s enqueued %d jobs for user %s", record.ID, record.Total, userID)
+	return &record, nil
+}
+
+// GetImport returns the user's import record, or nil if there is none
+func (s *SupabaseStore) GetImport(id string, userID string) (*Import, error) {
+	var record Import
+	err := s.Pool.QueryRow(context.Background(), `
+		SELECT id, user_id, status, total, completed, failed, created_at, updated_at
+		FROM imports WHERE id = $1::uuid AND user_id = $2::uuid
+	`, id, userID).Scan(
+		&record.ID,
+		&record.UserID,
+		&record.Status,
+		&record.Total,
+		&record.Completed,
+		&record.Failed,
+		&record.CreatedAt,
+		&record.UpdatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// recordImportProgress counts a job that reached a final state against its
+// import record, if it has one, and completes the import with its last job
+func (s *SupabaseStore) recordImportProgress(job *Job) {
+	var req MessageRequest
+	if err := json.Unmarshal(job.Data, &req); err != nil || req.ImportID == "" {
+		return
+	}
+
+	completed, failed := 0, 0
+	if job.Status == StatusCompleted {
+		completed = 1
+	} else {
+		failed = 1
+	}
+
+	_, err := s.Pool.Exec(context.Background(), `
+		UPDATE imports SET
+			completed = completed + $1::integer,
+			failed = failed + $2::integer,
+			status = CASE WHEN completed + failed + 1 >= total THEN $3::text ELSE status END,
+			updated_at = now()
+		WHERE id = $4::uuid
+	`, completed, failed, StatusCompleted, req.ImportID)
+	if err != nil {
+		log.Printf("Error recording progress of job %s on import %s: %v", job.ID, req.ImportID, err)
+	}
+}
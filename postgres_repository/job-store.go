@@ -8,11 +8,20 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	llm "noerkrieg.com/server/llm"
+	"noerkrieg.com/server/redis_repository"
+	"noerkrieg.com/server/units"
 )
 
 type SupabaseStore struct {
+	// Monthly LLM spend per user after which new jobs fail, zero for no limit
+	MonthlyBudgetUSD float64
+	// Gap between messages within which their exercises join the same workout
+	WorkoutMergeWindow time.Duration
+	// Store caching the catalog context, nil to always read Postgres
+	CatalogCache redis_repository.Store
 	// Connection pool for session/listener operations
 	Pool *pgxpool.Pool
 	// Dedicated connection for listening to notifications
@@ -24,14 +33,21 @@ type SupabaseStore struct {
 	listenerCancel context.CancelFunc
 }
 
-func NewSupabaseStore(SessionUrl string) (*SupabaseStore, error) {
+// StoreOptions size the connection pool and notification buffer of a
+// SupabaseStore
+type StoreOptions struct {
+	MaxConns           int
+	NotificationBuffer int
+}
+
+func NewSupabaseStore(SessionUrl string, opts StoreOptions) (*SupabaseStore, error) {
 	sessionConfig, err := pgxpool.ParseConfig(SessionUrl)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing Session URL: %w", err)
 	}
 
 	// Configure the connection pools
-	sessionConfig.MaxConns = 8
+	sessionConfig.MaxConns = int32(opts.MaxConns)
 	sessionConfig.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
 	log.Printf("Allowed %d connections", sessionConfig.MaxConns)
 	// Disable prepared statement cache to avoid collisions
@@ -63,7 +79,7 @@ func NewSupabaseStore(SessionUrl string) (*SupabaseStore, error) {
 	store := &SupabaseStore{
 		Pool:                listenerPool,
 		Connection:          listenerConn,
-		jobNotificationChan: make(chan *Job, 100), // Buffer for 100 notifications
+		jobNotificationChan: make(chan *Job, opts.NotificationBuffer),
 		listenerCtx:         listenerCtx,
 		listenerCancel:      listenerCancel,
 	}
@@ -72,7 +88,7 @@ func NewSupabaseStore(SessionUrl string) (*SupabaseStore, error) {
 }
 
 func (j *SupabaseStore) get(id string) (*Job, error) {
-	query := `SELECT id, status, data, result, error, created_at, updated_At, retry_count, user_id FROM jobs where id = $1::uuid`
+	query := `SELECT id, status, data, result, error, created_at, updated_At, retry_count, user_id, prompt_tokens, completion_tokens, cost_usd, prompt_version FROM jobs where id = $1::uuid`
 	var job Job
 	err := j.Pool.QueryRow(context.Background(), query, id).Scan(
 		&job.ID,
@@ -84,6 +100,10 @@ func (j *SupabaseStore) get(id string) (*Job, error) {
 		&job.UpdatedAt,
 		&job.RetryCount,
 		&job.UserID,
+		&job.PromptTokens,
+		&job.CompletionTokens,
+		&job.CostUSD,
+		&job.PromptVersion,
 	)
 	if err == pgx.ErrNoRows {
 		log.Printf("No job found with id %v", id)
@@ -126,8 +146,9 @@ func (s *SupabaseStore) updateJob(job *Job) error {
 	}
 
 	// Only increment if this is a failure update
+	// A job failed permanently arrives with its retry count already at the limit
 	if job.Status == StatusFailed {
-		job.RetryCount = currentRetryCount + 1
+		job.RetryCount = max(currentRetryCount+1, job.RetryCount)
 	}
 
 	// Update timestamp
@@ -179,13 +200,14 @@ func (s *SupabaseStore) claim() (*Job, error) {
 		SET status = $1::text, updated_at = $2::timestamptz
 		WHERE id = (
 			SELECT id FROM jobs
-			WHERE (status = $3::text OR (status = $4::text AND retry_count < 3))
-			ORDER BY created_at ASC
+			WHERE (status = $3::text OR (status = $4::text AND retry_count < $5::integer))
+			ORDER BY priority DESC, created_at ASC
 			LIMIT 1
 			FOR UPDATE SKIP LOCKED
 		)
-		RETURNING id, status, data, result, error, created_at, updated_at, retry_count, user_id
-	`, StatusProcessing, time.Now(), StatusPending, StatusFailed).Scan(
+		RETURNING id, status, data, result, error, created_at, updated_at, retry_count, user_id,
+			prompt_tokens, completion_tokens, cost_usd, prompt_version
+	`, StatusProcessing, time.Now(), StatusPending, StatusFailed, MaxRetries).Scan(
 		&job.ID,
 		&job.Status,
 		&job.Data,
@@ -195,6 +217,10 @@ func (s *SupabaseStore) claim() (*Job, error) {
 		&job.UpdatedAt,
 		&job.RetryCount,
 		&job.UserID,
+		&job.PromptTokens,
+		&job.CompletionTokens,
+		&job.CostUSD,
+		&job.PromptVersion,
 	)
 
 	if err != nil {
@@ -224,10 +250,10 @@ func (s *SupabaseStore) GetPendingJobCount() (int, error) {
 	var count int
 	query := `
 	SELECT COUNT(*) FROM jobs 
-	WHERE status = $1::text OR (status = $2::text AND retry_count < 3)
+	WHERE status = $1::text OR (status = $2::text AND retry_count < $3::integer)
 	`
 
-	err := s.Pool.QueryRow(context.Background(), query, StatusPending, StatusFailed).Scan(&count)
+	err := s.Pool.QueryRow(context.Background(), query, StatusPending, StatusFailed, MaxRetries).Scan(&count)
 	return count, err
 }
 
@@ -374,8 +400,14 @@ func (s *SupabaseStore) Close() {
 	}
 }
 
-// upload uploads exercises to the database using the direct PostgreSQL connection
-func (s *SupabaseStore) upload(exercises []llm.Exercise, userID string, message string) ([]byte, []error, error) {
+// upload uploads exercises to the database using the direct PostgreSQL connection.
+// Exercises are stamped with timestamp, or the current time when it is zero,
+// and are performed at their extracted time when it is within bounds of it.
+// Their names are resolved to names in catalog, the known exercises they were
+// extracted with, where one matches confidently. The exercises join the
+// workout they were performed in, and the names catalog does not know are
+// recorded as catalog proposals.
+func (s *SupabaseStore) upload(exercises []llm.Exercise, userID string, message string, timestamp time.Time, catalog *redis_repository.ExerciseContext) ([]byte, []error, error) {
 	log.Print(exercises)
 	errors := make([]error, 0)
 	compiled := make([]map[string]interface{}, 0)
@@ -388,89 +420,54 @@ func (s *SupabaseStore) upload(exercises []llm.Exercise, userID string, message
 	}
 
 	// Set common fields on all exercises
-	now := time.Now()
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
 	for i := range exercises {
 		exercises[i].UserId = userID
 		exercises[i].Summary = fmt.Sprintf(`"%v"`, message)
-		exercises[i].Timestamp = now
+		exercises[i].Timestamp = timestamp
 	}
+	llm.BoundPerformedAt(exercises, timestamp)
+	llm.ResolveNames(exercises, catalog)
 
+	// The exercises are inserted in the transaction holding the workout lock,
+	// so concurrent messages can't take the same positions and groups
 	ctx := context.Background()
-
-	for _, ex := range exercises {
-		// Attempt to upsert the exercise using direct PostgreSQL connection
-		query := `
-			INSERT INTO exercises (
-				exercise_name, summary, type, sets, work, work_type,
-				resistance, resistance_type, duration, attributes, user_id
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) 
-			ON CONFLICT (id) DO UPDATE SET
-				exercise_name = $1,
-				summary = $2,
-				type = $3,
-				sets = $4,
-				work = $5,
-				work_type = $6,
-				resistance = $7,
-				resistance_type = $8,
-				duration = $9,
-				attributes = $10,
-				user_id = $11
-			RETURNING *;
-		`
-
-		// Convert string array to proper PostgreSQL array
-		var attributes []string
-		if ex.Attributes != nil {
-			attributes = ex.Attributes
-		} else {
-			attributes = []string{}
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return nil, errors, fmt.Errorf("error beginning upload: %w", err)
+	}
+	defer func() {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && rbErr != pgx.ErrTxClosed {
+			log.Printf("Error rolling back transaction: %v", rbErr)
 		}
+	}()
+	if err := s.assignWorkout(ctx, tx, userID, exercises); err != nil {
+		log.Printf("Storing exercises without a workout: %v", err)
+	}
 
-		var result pgx.Rows
-		result, err := s.Pool.Query(ctx, query,
-			ex.Exercise,
-			ex.Summary,
-			ex.Type,
-			ex.Sets,
-			ex.Quantity,
-			ex.QuantityType,
-			ex.Resistance,
-			ex.ResistanceType,
-			ex.Duration,
-			attributes,
-			userID,
-		)
-
+	for _, ex := range exercises {
+		inserted, err := insertExercise(ctx, tx, ex)
 		if err != nil {
 			log.Printf("Failed to insert exercise %s: %v", ex.Exercise, err)
-			errors = append(errors, fmt.Errorf("failed to insert exercise %s: %w", ex.Exercise, err))
-			stats.Failed++
-			continue
-		}
-
-		// Process the result
-		var inserted map[string]interface{}
-		rows, err := pgx.CollectRows(result, pgx.RowToMap)
-		if err != nil {
-			nErr := fmt.Errorf("error collecting rows for exercise %s: %w", ex.Exercise, err)
-			errors = append(errors, nErr)
-			stats.Failed++
-			continue
-		}
-
-		if len(rows) == 0 {
-			nErr := fmt.Errorf("empty response for exercise %s", ex.Exercise)
-			errors = append(errors, nErr)
+			errors = append(errors, err)
 			stats.Failed++
 			continue
 		}
 
 		// Record success
-		inserted = rows[0]
 		compiled = append(compiled, inserted)
 		stats.Succeeded++
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors, fmt.Errorf("error committing upload: %w", err)
+	}
+
+	// Names the catalog does not know become proposals for growing it
+	if err := s.recordUnknownNames(ctx, userID, exercises, catalog); err != nil {
+		log.Printf("Could not record unknown names: %v", err)
+	}
 
 	// Marshal results
 	result, err := json.Marshal(compiled)
@@ -487,3 +484,208 @@ func (s *SupabaseStore) upload(exercises []llm.Exercise, userID string, message
 
 	return result, errors, nil
 }
+
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx, so statements can run
+// inside or outside of a transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// exerciseColumns selects an exercises row in the order scanExercise reads it
+const exerciseColumns = `id::text, exercise_name, COALESCE(summary, ''), COALESCE(type, ''),
+	COALESCE(sets, 0), COALESCE(work, 0), COALESCE(work_type, ''),
+	COALESCE(resistance, 0), COALESCE(resistance_type, ''), COALESCE(duration, 0),
+	COALESCE(attributes, '{}'), user_id::text, created_ts, COALESCE(metrics, '{}'),
+	COALESCE(performed_at, created_ts), COALESCE(workout_id::text, ''), COALESCE(position, 0),
+	COALESCE(group_number, 0), COALESCE(raw_exercise_name, ''),
+	COALESCE(original_resistance_type, ''), COALESCE(original_work_type, '')`
+
+// scanExercise reads a row selected with exerciseColumns
+func scanExercise(row pgx.CollectableRow) (llm.Exercise, error) {
+	var ex llm.Exercise
+	var timestamp *time.Time
+	err := row.Scan(&ex.Id, &ex.Exercise, &ex.Summary, &ex.Type,
+		&ex.Sets, &ex.Quantity, &ex.QuantityType,
+		&ex.Resistance, &ex.ResistanceType, &ex.Duration,
+		&ex.Attributes, &ex.UserId, &timestamp, &ex.Metrics, &ex.PerformedAt,
+		&ex.WorkoutID, &ex.Position, &ex.Group, &ex.RawName,
+		&ex.OriginalResistanceType, &ex.OriginalWorkType)
+	if timestamp != nil {
+		ex.Timestamp = *timestamp
+	}
+	return ex, err
+}
+
+// insertExercise inserts a single exercise and its set details in one
+// transaction, nested in q when it is one, and returns the stored row. Its
+// weights and distances are stored in SI units.
+func insertExercise(ctx context.Context, q querier, ex llm.Exercise) (map[string]interface{}, error) {
+	ex = units.Canonical(ex)
+	tx, err := q.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && rbErr != pgx.ErrTxClosed {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
+	}()
+
+	// Attempt to upsert the exercise using direct PostgreSQL connection
+	query := `
+		INSERT INTO exercises (
+			exercise_name, summary, type, sets, work, work_type,
+			resistance, resistance_type, duration, attributes, user_id, created_ts, metrics, performed_at,
+			workout_id, position, group_number, raw_exercise_name,
+			original_resistance_type, original_work_type, import_key
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14,
+			NULLIF($15, '')::uuid, NULLIF($16, 0), NULLIF($17, 0), NULLIF($18, ''),
+			NULLIF($19, ''), NULLIF($20, ''), NULLIF($21, '')) 
+		ON CONFLICT (id) DO UPDATE SET
+			exercise_name = $1,
+			summary = $2,
+			type = $3,
+			sets = $4,
+			work = $5,
+			work_type = $6,
+			resistance = $7,
+			resistance_type = $8,
+			duration = $9,
+			attributes = $10,
+			user_id = $11,
+			created_ts = $12,
+			metrics = $13,
+			performed_at = $14,
+			workout_id = NULLIF($15, '')::uuid,
+			position = NULLIF($16, 0),
+			group_number = NULLIF($17, 0),
+			raw_exercise_name = NULLIF($18, ''),
+			original_resistance_type = NULLIF($19, ''),
+			original_work_type = NULLIF($20, ''),
+			import_key = NULLIF($21, '')
+		RETURNING *;
+	`
+
+	// Convert string array to proper PostgreSQL array
+	var attributes []string
+	if ex.Attributes != nil {
+		attributes = ex.Attributes
+	} else {
+		attributes = []string{}
+	}
+	metrics := ex.Metrics
+	if metrics == nil {
+		metrics = map[string]float64{}
+	}
+	performedAt := ex.Timestamp
+	if ex.PerformedAt != nil {
+		performedAt = *ex.PerformedAt
+	}
+
+	result, err := tx.Query(ctx, query,
+		ex.Exercise,
+		ex.Summary,
+		ex.Type,
+		ex.Sets,
+		ex.Quantity,
+		ex.QuantityType,
+		ex.Resistance,
+		ex.ResistanceType,
+		ex.Duration,
+		attributes,
+		ex.UserId,
+		ex.Timestamp,
+		metrics,
+		performedAt,
+		ex.WorkoutID,
+		ex.Position,
+		ex.Group,
+		ex.RawName,
+		ex.OriginalResistanceType,
+		ex.OriginalWorkType,
+		ex.ImportKey,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert exercise %s: %w", ex.Exercise, err)
+	}
+
+	// Process the result
+	rows, err := pgx.CollectRows(result, pgx.RowToMap)
+	if err != nil {
+		return nil, fmt.Errorf("error collecting rows for exercise %s: %w", ex.Exercise, err)
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("empty response for exercise %s", ex.Exercise)
+	}
+
+	if ex.WorkoutID != "" {
+		rows[0]["workout_id"] = ex.WorkoutID
+	}
+	if len(ex.SetDetails) > 0 {
+		if err := insertSets(ctx, tx, fmt.Sprint(rows[0]["id"]), ex.SetDetails); err != nil {
+			return nil, err
+		}
+		rows[0]["set_details"] = ex.SetDetails
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
+// CreateJob inserts a new pending job for the user. The jobs table trigger
+// publishes the insert on job_updates, so workers pick it up like any other job.
+func (s *SupabaseStore) CreateJob(userID string, data interface{}, priority int) (*Job, error) {
+	return insertJob(context.Background(), s.Pool, userID, data, priority)
+}
+
+// insertJob inserts a new pending job for the user with q
+func insertJob(ctx context.Context, q querier, userID string, data interface{}, priority int) (*Job, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling job data: %w", err)
+	}
+
+	var job Job
+	err = q.QueryRow(ctx, `
+		INSERT INTO jobs (status, data, error, user_id, priority)
+		VALUES ($1::text, $2::jsonb, '', $3::uuid, $4::integer)
+		RETURNING id, status, data, result, error, created_at, updated_at, retry_count, user_id,
+			prompt_tokens, completion_tokens, cost_usd, prompt_version
+	`, StatusPending, payload, userID, priority).Scan(
+		&job.ID,
+		&job.Status,
+		&job.Data,
+		&job.Result,
+		&job.Error,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.RetryCount,
+		&job.UserID,
+		&job.PromptTokens,
+		&job.CompletionTokens,
+		&job.CostUSD,
+		&job.PromptVersion,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating job: %w", err)
+	}
+	return &job, nil
+}
+
+// GetJob returns the job with the given id if it belongs to the user, or nil
+// if there is no such job
+func (s *SupabaseStore) GetJob(id string, userID string) (*Job, error) {
+	job, err := s.get(id)
+	if err != nil || job == nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, nil
+	}
+	return job, nil
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LLMCache is a ResponseCache stored in the llm_cache table
+type LLMCache struct {
+	Pool *pgxpool.Pool
+}
+
+// NewLLMCache returns a cache sharing the store's connection pool
+func (s *SupabaseStore) NewLLMCache() *LLMCache {
+	return &LLMCache{Pool: s.Pool}
+}
+
+// Get returns the unexpired value stored under key
+func (c *LLMCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var value []byte
+	err := c.Pool.QueryRow(ctx,
+		`SELECT value FROM llm_cache WHERE key = $1 AND expires_at > now()`, key).Scan(&value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set stores value under key for ttl, and removes expired entries
+func (c *LLMCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	batch := &pgx.Batch{}
+	batch.Queue(`
+		INSERT INTO llm_cache (key, value, expires_at)
+		VALUES ($1, $2::jsonb, now() + make_interval(secs => $3))
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at
+	`, key, value, ttl.Seconds())
+	batch.Queue(`DELETE FROM llm_cache WHERE expires_at <= now()`)
+	return c.Pool.SendBatch(ctx, batch).Close()
+}
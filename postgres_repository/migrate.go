@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// migrations holds the schema changes applied on top of the base Supabase
+// schema, named <version>_<description>.sql and applied in version order
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrate applies the migrations not yet recorded in schema_migrations, each
+// in its own transaction. Instances starting together wait on an advisory
+// lock, so each migration is applied once. The migrations are idempotent, so
+// a database they were applied to by hand is only recorded as migrated.
+func (s *SupabaseStore) Migrate(ctx context.Context) error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return fmt.Errorf("error listing migrations: %w", err)
+	}
+	sort.Strings(names)
+
+	conn, err := s.Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring connection for migrations: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock(hashtext('schema_migrations'))`); err != nil {
+		return fmt.Errorf("error locking migrations: %w", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtext('schema_migrations'))`); err != nil {
+			log.Printf("Error unlocking migrations: %v", err)
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    text PRIMARY KEY,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`); err != nil {
+		return fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+	rows, err := conn.Query(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	applied, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	done := map[string]bool{}
+	for _, version := range applied {
+		done[version] = true
+	}
+
+	for _, name := range names {
+		version := strings.TrimSuffix(path.Base(name), ".sql")
+		if done[version] {
+			continue
+		}
+		sql, err := migrations.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("error reading migration %s: %w", version, err)
+		}
+		if err := applyMigration(ctx, conn.Conn(), version, string(sql)); err != nil {
+			return err
+		}
+		log.Printf("Applied migration %s", version)
+	}
+	return nil
+}
+
+// applyMigration runs one migration and records it in the same transaction
+func applyMigration(ctx context.Context, conn *pgx.Conn, version string, sql string) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting migration %s: %w", version, err)
+	}
+	defer func() {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && rbErr != pgx.ErrTxClosed {
+			log.Printf("Error rolling back migration %s: %v", version, rbErr)
+		}
+	}()
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("error applying migration %s: %w", version, err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+		return fmt.Errorf("error recording migration %s: %w", version, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing migration %s: %w", version, err)
+	}
+	return nil
+}
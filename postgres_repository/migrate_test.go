@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"testing"
+)
+
+func TestMigrationsAreNumberedInOrder(t *testing.T) {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if prefix := fmt.Sprintf("%04d_", i+1); path.Base(name)[:5] != prefix {
+			t.Errorf("migration %s is not numbered %s", path.Base(name), prefix)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+-- Job priority, so bulk imports do not starve interactive messages
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS priority integer NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS jobs_claim_idx
+    ON jobs (priority DESC, created_at ASC)
+    WHERE status IN ('pending', 'failed');
+
+-- Parent record tracking the progress of a bulk notes import
+CREATE TABLE IF NOT EXISTS imports (
+    id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    uuid NOT NULL,
+    status     text NOT NULL DEFAULT 'processing',
+    total      integer NOT NULL,
+    completed  integer NOT NULL DEFAULT 0,
+    failed     integer NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS imports_user_idx ON imports (user_id, created_at DESC);
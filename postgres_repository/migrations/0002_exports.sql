@@ -0,0 +1,14 @@
+-- Workout history exports, with the finished file stored inline
+CREATE TABLE IF NOT EXISTS exports (
+    id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id      uuid NOT NULL,
+    job_id       uuid,
+    format       text NOT NULL,
+    status       text NOT NULL DEFAULT 'pending',
+    rows         integer NOT NULL DEFAULT 0,
+    artifact     bytea,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    completed_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS exports_user_idx ON exports (user_id, created_at DESC);
@@ -0,0 +1,3 @@
+-- Measurements without a dedicated column, such as pace and elevation from
+-- recorded activity files
+ALTER TABLE exercises ADD COLUMN IF NOT EXISTS metrics jsonb NOT NULL DEFAULT '{}';
@@ -0,0 +1,15 @@
+-- LLM usage recorded on each job, accumulated across retries
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS prompt_tokens integer NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS completion_tokens integer NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS cost_usd double precision NOT NULL DEFAULT 0;
+
+-- Per-user daily aggregates, used for reporting and the monthly budget
+CREATE TABLE IF NOT EXISTS llm_usage_daily (
+    user_id           uuid NOT NULL,
+    day               date NOT NULL,
+    calls             integer NOT NULL DEFAULT 0,
+    prompt_tokens     bigint NOT NULL DEFAULT 0,
+    completion_tokens bigint NOT NULL DEFAULT 0,
+    cost_usd          double precision NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day)
+);
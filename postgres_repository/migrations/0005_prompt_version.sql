@@ -0,0 +1,2 @@
+-- Prompt template version each job's extraction ran with
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS prompt_version text NOT NULL DEFAULT '';
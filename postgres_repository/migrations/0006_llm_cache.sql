@@ -0,0 +1,8 @@
+-- Cached LLM extractions, keyed by normalized message, prompt and catalog version
+CREATE TABLE IF NOT EXISTS llm_cache (
+    key        text PRIMARY KEY,
+    value      jsonb NOT NULL,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS llm_cache_expires_at_idx ON llm_cache (expires_at);
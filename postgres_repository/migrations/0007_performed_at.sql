@@ -0,0 +1,5 @@
+-- When each exercise was performed, as opposed to when it was logged
+ALTER TABLE exercises ADD COLUMN IF NOT EXISTS performed_at timestamptz;
+UPDATE exercises SET performed_at = created_ts WHERE performed_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS exercises_user_id_performed_at_idx ON exercises (user_id, performed_at DESC);
@@ -0,0 +1,13 @@
+-- Individual sets of an exercise, in order. The exercise's sets, work and
+-- resistance columns are derived from them.
+CREATE TABLE IF NOT EXISTS exercise_sets (
+    exercise_id  bigint NOT NULL REFERENCES exercises (id) ON DELETE CASCADE,
+    position     integer NOT NULL,
+    reps         double precision NOT NULL DEFAULT 0,
+    load         double precision NOT NULL DEFAULT 0,
+    rpe          double precision NOT NULL DEFAULT 0,
+    rir          double precision NOT NULL DEFAULT 0,
+    rest_seconds double precision NOT NULL DEFAULT 0,
+    drop         boolean NOT NULL DEFAULT false,
+    PRIMARY KEY (exercise_id, position)
+);
@@ -0,0 +1,19 @@
+-- Workout sessions grouping the exercises of one or more messages
+CREATE TABLE IF NOT EXISTS workouts (
+    id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    uuid NOT NULL,
+    started_at timestamptz NOT NULL,
+    ended_at   timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS workouts_user_id_started_at_idx ON workouts (user_id, started_at DESC);
+
+-- Order of each exercise in its workout, and the superset or circuit it is
+-- part of. Exercises sharing a group_number were performed together.
+ALTER TABLE exercises ADD COLUMN IF NOT EXISTS workout_id uuid REFERENCES workouts (id) ON DELETE SET NULL;
+ALTER TABLE exercises ADD COLUMN IF NOT EXISTS position integer;
+ALTER TABLE exercises ADD COLUMN IF NOT EXISTS group_number integer;
+
+CREATE INDEX IF NOT EXISTS exercises_workout_id_idx ON exercises (workout_id, position);
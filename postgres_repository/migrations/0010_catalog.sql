@@ -0,0 +1,22 @@
+-- Canonical exercise catalog the LLM maps exercise names to, replacing the
+-- flat Redis sets. Names are unique regardless of case.
+CREATE TABLE IF NOT EXISTS catalog_exercises (
+    id            uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name          text NOT NULL,
+    aliases       text[] NOT NULL DEFAULT '{}',
+    muscle_groups text[] NOT NULL DEFAULT '{}',
+    equipment     text[] NOT NULL DEFAULT '{}',
+    type          text NOT NULL DEFAULT '',
+    created_at    timestamptz NOT NULL DEFAULT now(),
+    updated_at    timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS catalog_exercises_name_idx ON catalog_exercises (lower(name));
+
+CREATE TABLE IF NOT EXISTS catalog_attributes (
+    id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    name       text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS catalog_attributes_name_idx ON catalog_attributes (lower(name));
@@ -0,0 +1,23 @@
+-- Exercise and attribute names the LLM produced that the catalog does not
+-- know, clustered by their normalized key. Each cluster proposes either
+-- aliases for an existing catalog exercise or a new catalog entry, which an
+-- admin approves or rejects. Rejected clusters stay so they are not proposed
+-- again.
+CREATE TABLE IF NOT EXISTS catalog_proposals (
+    id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind         text NOT NULL CHECK (kind IN ('exercise', 'attribute')),
+    cluster_key  text NOT NULL,
+    name         text NOT NULL,
+    variants     text[] NOT NULL DEFAULT '{}',
+    target_name  text,
+    similarity   double precision NOT NULL DEFAULT 0,
+    occurrences  integer NOT NULL DEFAULT 0,
+    users        uuid[] NOT NULL DEFAULT '{}',
+    status       text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    updated_at   timestamptz NOT NULL DEFAULT now(),
+    decided_at   timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS catalog_proposals_key_idx ON catalog_proposals (kind, cluster_key);
+CREATE INDEX IF NOT EXISTS catalog_proposals_status_idx ON catalog_proposals (status, occurrences DESC);
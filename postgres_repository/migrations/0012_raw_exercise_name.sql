@@ -0,0 +1,3 @@
+-- The exercise name as the model extracted it, before it was resolved to its
+-- catalog name. NULL for exercises stored before names were resolved.
+ALTER TABLE exercises ADD COLUMN IF NOT EXISTS raw_exercise_name text;
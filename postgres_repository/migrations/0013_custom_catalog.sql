@@ -0,0 +1,21 @@
+-- Exercises and attributes a user made up, known only when parsing that
+-- user's messages. Names are unique per user regardless of case.
+CREATE TABLE IF NOT EXISTS custom_exercises (
+    id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    uuid NOT NULL,
+    name       text NOT NULL,
+    aliases    text[] NOT NULL DEFAULT '{}',
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS custom_exercises_name_idx ON custom_exercises (user_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS custom_attributes (
+    id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    uuid NOT NULL,
+    name       text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS custom_attributes_name_idx ON custom_attributes (user_id, lower(name));
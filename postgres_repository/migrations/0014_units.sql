@@ -0,0 +1,44 @@
+-- Exercises are stored with resistance in kilograms and distance work in
+-- meters, remembering the units they were logged in so they can be shown
+-- that way again.
+ALTER TABLE exercises ADD COLUMN IF NOT EXISTS original_resistance_type text;
+ALTER TABLE exercises ADD COLUMN IF NOT EXISTS original_work_type text;
+
+-- Convert the set loads of exercises logged in pounds before the exercises
+-- themselves, which are recognized by their unconverted resistance type
+UPDATE exercise_sets SET load = round((load * 0.45359237)::numeric, 3)
+FROM exercises
+WHERE exercise_sets.exercise_id = exercises.id
+    AND exercises.original_resistance_type IS NULL
+    AND lower(exercises.resistance_type) ~ '\m(pounds?|lbs?)\M';
+
+UPDATE exercises SET
+    original_resistance_type = regexp_replace(lower(resistance_type), '\m(pounds?|lbs?)\M', 'pounds'),
+    resistance = round((resistance * 0.45359237)::numeric, 3),
+    resistance_type = regexp_replace(lower(resistance_type), '\m(pounds?|lbs?)\M', 'kilograms')
+WHERE original_resistance_type IS NULL AND lower(resistance_type) ~ '\m(pounds?|lbs?)\M';
+
+UPDATE exercises SET
+    original_work_type = lower(work_type),
+    work = round((work * CASE lower(work_type)
+        WHEN 'miles' THEN 1609.344
+        WHEN 'kilometers' THEN 1000
+        WHEN 'yards' THEN 0.9144
+        WHEN 'feet' THEN 0.3048
+        ELSE 1 END)::numeric, 3),
+    work_type = 'meters'
+WHERE original_work_type IS NULL
+    AND lower(work_type) IN ('miles', 'kilometers', 'yards', 'feet', 'meters');
+
+UPDATE exercises SET original_resistance_type = resistance_type
+WHERE original_resistance_type IS NULL AND resistance_type IS NOT NULL AND resistance_type <> '';
+UPDATE exercises SET original_work_type = work_type
+WHERE original_work_type IS NULL AND work_type IS NOT NULL AND work_type <> '';
+
+-- The unit system each user reads their exercises in: metric, imperial, or
+-- empty for the units each exercise was logged in
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id     uuid PRIMARY KEY,
+    unit_system text NOT NULL DEFAULT '' CHECK (unit_system IN ('', 'metric', 'imperial')),
+    updated_at  timestamptz NOT NULL DEFAULT now()
+);
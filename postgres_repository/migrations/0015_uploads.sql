@@ -0,0 +1,10 @@
+-- Files uploaded for import jobs, kept out of the job payload so jobs stay
+-- small to claim and return. Jobs refer to their file by id, and the file is
+-- removed once its job completes or fails for good.
+CREATE TABLE IF NOT EXISTS uploads (
+    id         uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    uuid NOT NULL,
+    filename   text NOT NULL DEFAULT '',
+    content    bytea NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,8 @@
+-- Identity of the export row an imported exercise came from: the source, the
+-- workout's start time and the exercise's order in the workout. Importing
+-- the same export again skips the rows it already imported, while identical
+-- blocks repeated within one workout are kept.
+ALTER TABLE exercises ADD COLUMN IF NOT EXISTS import_key text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS exercises_import_key_idx
+    ON exercises (user_id, import_key) WHERE import_key IS NOT NULL;
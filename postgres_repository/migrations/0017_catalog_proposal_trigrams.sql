@@ -0,0 +1,7 @@
+-- Unknown names are matched to the pending proposal clusters they are typos
+-- of by trigram similarity, which this index narrows to the likely clusters
+-- instead of every recorded one.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS catalog_proposals_pending_key_trgm_idx
+    ON catalog_proposals USING gin (cluster_key gin_trgm_ops) WHERE status = 'pending';
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	llm "noerkrieg.com/server/llm"
+	"noerkrieg.com/server/units"
+)
+
+// GetPreferences returns the user's preferences, which are the defaults until
+// the user sets them
+func (s *SupabaseStore) GetPreferences(ctx context.Context, userID string) (*Preferences, error) {
+	prefs := Preferences{}
+	err := s.Pool.QueryRow(ctx, `SELECT unit_system, updated_at FROM user_preferences WHERE user_id = $1::uuid`,
+		userID).Scan(&prefs.UnitSystem, &prefs.UpdatedAt)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("error loading preferences: %w", err)
+	}
+	return &prefs, nil
+}
+
+// SetPreferences stores the user's preferences
+func (s *SupabaseStore) SetPreferences(ctx context.Context, userID string, prefs Preferences) (*Preferences, error) {
+	err := s.Pool.QueryRow(ctx, `
+		INSERT INTO user_preferences (user_id, unit_system) VALUES ($1::uuid, $2)
+		ON CONFLICT (user_id) DO UPDATE SET unit_system = EXCLUDED.unit_system, updated_at = now()
+		RETURNING updated_at
+	`, userID, prefs.UnitSystem).Scan(&prefs.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error storing preferences: %w", err)
+	}
+	return &prefs, nil
+}
+
+// DisplayJob converts the exercises in the result of a message or reparse job
+// from the SI units they are stored in to system. Results of other jobs hold
+// no exercises and are left as they are.
+func DisplayJob(job *Job, system string) error {
+	if len(job.Result) == 0 {
+		return nil
+	}
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(job.Data, &header); err != nil {
+		return fmt.Errorf("error deserializing job data: %w", err)
+	}
+
+	var result json.RawMessage
+	var err error
+	switch header.Type {
+	case "", JobTypeMessage:
+		result, err = displayRows(job.Result, system)
+	case JobTypeReparse:
+		var reparse ReparseResult
+		if err := json.Unmarshal(job.Result, &reparse); err != nil {
+			return fmt.Errorf("invalid reparse result: %w", err)
+		}
+		displayDiff(&reparse.Diff, system)
+		if len(reparse.Data) > 0 {
+			if reparse.Data, err = displayRows(reparse.Data, system); err != nil {
+				return err
+			}
+		}
+		result, err = json.Marshal(reparse)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	job.Result = result
+	return nil
+}
+
+// displayDiff converts the exercises of a diff to system
+func displayDiff(diff *ExerciseDiff, system string) {
+	for i, ex := range diff.Added {
+		diff.Added[i] = units.Display(ex, system)
+	}
+	for i, ex := range diff.Removed {
+		diff.Removed[i] = units.Display(ex, system)
+	}
+	for i, change := range diff.Changed {
+		diff.Changed[i].Before = units.Display(change.Before, system)
+		diff.Changed[i].After = units.Display(change.After, system)
+	}
+}
+
+// displayRows converts the stored exercise rows of a message job result,
+// which is either the row array or a partial success wrapper around it, to
+// system
+func displayRows(result json.RawMessage, system string) (json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(result))
+	// Numbers are kept as they are, so exercise ids don't lose precision
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("error deserializing job result: %w", err)
+	}
+
+	rows, ok := decoded.([]interface{})
+	if wrapper, isWrapper := decoded.(map[string]interface{}); isWrapper {
+		rows, ok = wrapper["data"].([]interface{})
+	}
+	if !ok {
+		return result, nil
+	}
+	for _, row := range rows {
+		if fields, ok := row.(map[string]interface{}); ok {
+			if err := displayRow(fields, system); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return json.Marshal(decoded)
+}
+
+// displayRow converts the resistance, set loads and work of a stored
+// exercise row to system, writing back only the fields the row holds
+func displayRow(row map[string]interface{}, system string) error {
+	number := func(key string) float64 {
+		n, _ := row[key].(json.Number)
+		f, _ := n.Float64()
+		return f
+	}
+	text := func(key string) string {
+		t, _ := row[key].(string)
+		return t
+	}
+	ex := llm.Exercise{
+		Quantity:               number("work"),
+		QuantityType:           text("work_type"),
+		Resistance:             number("resistance"),
+		ResistanceType:         text("resistance_type"),
+		OriginalResistanceType: text("original_resistance_type"),
+		OriginalWorkType:       text("original_work_type"),
+	}
+	if sets, ok := row["set_details"]; ok {
+		data, err := json.Marshal(sets)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &ex.SetDetails); err != nil {
+			return fmt.Errorf("invalid set details: %w", err)
+		}
+	}
+
+	ex = units.Display(ex, system)
+	set := func(key string, value interface{}) {
+		if _, ok := row[key]; ok && row[key] != nil {
+			row[key] = value
+		}
+	}
+	set("work", ex.Quantity)
+	set("work_type", ex.QuantityType)
+	set("resistance", ex.Resistance)
+	set("resistance_type", ex.ResistanceType)
+	set("set_details", ex.SetDetails)
+	return nil
+}
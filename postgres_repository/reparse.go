@@ -0,0 +1,480 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	llm "noerkrieg.com/server/llm"
+	"noerkrieg.com/server/units"
+)
+
+// Errors reparsing a job or applying a reparse that the user can't fix by
+// retrying
+var (
+	ErrNotMessageJob       = errors.New("only message jobs can be reparsed")
+	ErrNotReparseJob       = errors.New("the job is not a reparse job")
+	ErrReparseNotCompleted = errors.New("the reparse job has not completed")
+	ErrReparseApplied      = errors.New("the reparse job has already been applied")
+	// ErrReparseStale reports that the exercises the diff was computed
+	// against have changed or gone since
+	ErrReparseStale = errors.New("the reparsed exercises have changed since the reparse")
+)
+
+// processReparseJob re-runs extraction on the message of a completed job and
+// diffs the result against the exercises that job stored
+func (w *WorkQueue) processReparseJob(job *Job) (json.RawMessage, error) {
+	var req ReparseRequest
+	if err := json.Unmarshal(job.Data, &req); err != nil {
+		return nil, fmt.Errorf("invalid reparse request: %w", err)
+	}
+
+	source, err := w.store.GetJob(req.JobID, job.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading job %s: %w", req.JobID, err)
+	}
+	if source == nil {
+		return nil, fmt.Errorf("job %s not found", req.JobID)
+	}
+	if source.Status != StatusCompleted {
+		return nil, fmt.Errorf("job %s is %s, only completed jobs can be reparsed", source.ID, source.Status)
+	}
+	if !IsMessageJob(source) {
+		return nil, permanentError{fmt.Errorf("job %s: %w", source.ID, ErrNotMessageJob)}
+	}
+
+	message, err := jobMessage(source)
+	if err != nil {
+		return nil, err
+	}
+	var sourceReq MessageRequest
+	if err := json.Unmarshal(source.Data, &sourceReq); err != nil {
+		return nil, fmt.Errorf("invalid message request: %w", err)
+	}
+	sentAt := messageSentAt(source, sourceReq)
+
+	ctx := context.Background()
+	stored, err := exercisesByID(ctx, w.store.Pool, jobExerciseIDs(source.Result), job.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.store.CheckBudget(job.UserID); err != nil {
+		return nil, err
+	}
+	extractionReq := w.store.extractionRequest(ctx, job, message, sentAt)
+	extraction, err := w.extractor.Extract(ctx, extractionReq)
+	w.store.recordExtraction(job, extraction)
+	if err != nil {
+		return nil, err
+	}
+	parsed := extraction.Exercises
+	for i := range parsed {
+		parsed[i].UserId = job.UserID
+		parsed[i].Summary = fmt.Sprintf(`"%v"`, message)
+		parsed[i].Timestamp = sentAt
+	}
+	llm.BoundPerformedAt(parsed, sentAt)
+	llm.ResolveNames(parsed, extractionReq.Catalog())
+	// Stored exercises are in SI units, so the parsed ones are compared in them too
+	for i := range parsed {
+		parsed[i] = units.Canonical(parsed[i])
+	}
+
+	result := ReparseResult{
+		SourceJobID:   source.ID,
+		Diff:          diffExercises(stored, parsed),
+		PromptVersion: extraction.PromptVersion,
+	}
+	log.Printf("Reparse of job %s: %d added, %d removed, %d changed", source.ID,
+		len(result.Diff.Added), len(result.Diff.Removed), len(result.Diff.Changed))
+
+	if req.Apply {
+		data, err := w.store.applyDiffNow(ctx, source.ID, job.UserID, result.Diff)
+		if err != nil {
+			return nil, err
+		}
+		result.Applied = true
+		result.Data = data
+	}
+
+	return json.Marshal(result)
+}
+
+// ApplyReparse applies the diff computed by a completed reparse job that was
+// run without apply, and returns the updated reparse job. The diff and the
+// reparse job's applied result are written in one transaction holding the
+// reparse job, so a diff is applied at most once.
+func (s *SupabaseStore) ApplyReparse(jobID string, userID string) (*Job, error) {
+	ctx := context.Background()
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && rbErr != pgx.ErrTxClosed {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
+	}()
+
+	var data, resultData []byte
+	var status string
+	err = tx.QueryRow(ctx, `
+		SELECT data, result, status FROM jobs
+		WHERE id = $1::uuid AND user_id = $2::uuid
+		FOR UPDATE
+	`, jobID, userID).Scan(&data, &resultData, &status)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading job %s: %w", jobID, err)
+	}
+
+	var req ReparseRequest
+	if err := json.Unmarshal(data, &req); err != nil || req.Type != JobTypeReparse {
+		return nil, fmt.Errorf("job %s: %w", jobID, ErrNotReparseJob)
+	}
+	if status != StatusCompleted {
+		return nil, fmt.Errorf("reparse job %s is %s: %w", jobID, status, ErrReparseNotCompleted)
+	}
+
+	var result ReparseResult
+	if err := json.Unmarshal(resultData, &result); err != nil {
+		return nil, fmt.Errorf("invalid reparse result: %w", err)
+	}
+	if result.Applied {
+		return nil, fmt.Errorf("reparse job %s: %w", jobID, ErrReparseApplied)
+	}
+
+	result.Data, err = s.applyDiff(ctx, tx, result.SourceJobID, userID, result.Diff)
+	if err != nil {
+		return nil, err
+	}
+	result.Applied = true
+	resultData, err = json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE jobs SET result = $1::jsonb, updated_at = now() WHERE id = $2::uuid`,
+		resultData, jobID); err != nil {
+		return nil, fmt.Errorf("error updating job %s: %w", jobID, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return s.GetJob(jobID, userID)
+}
+
+// applyDiffNow applies a diff in a transaction of its own
+func (s *SupabaseStore) applyDiffNow(ctx context.Context, sourceID string, userID string, diff ExerciseDiff) (json.RawMessage, error) {
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && rbErr != pgx.ErrTxClosed {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
+	}()
+	data, err := s.applyDiff(ctx, tx, sourceID, userID, diff)
+	if err != nil {
+		return nil, err
+	}
+	return data, tx.Commit(ctx)
+}
+
+// applyDiff writes a diff to the exercises table in tx and replaces the
+// source job's result with the exercises it now owns. The source job is
+// locked for the rest of tx, so diffs of the same job apply one at a time,
+// each against the result the last one left.
+func (s *SupabaseStore) applyDiff(ctx context.Context, tx pgx.Tx, sourceID string, userID string, diff ExerciseDiff) (json.RawMessage, error) {
+	var sourceResult json.RawMessage
+	err := tx.QueryRow(ctx, `
+		SELECT result FROM jobs
+		WHERE id = $1::uuid AND user_id = $2::uuid
+		FOR UPDATE
+	`, sourceID, userID).Scan(&sourceResult)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("job %s not found: %w", sourceID, ErrReparseStale)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading job %s: %w", sourceID, err)
+	}
+	ids := jobExerciseIDs(sourceResult)
+
+	for _, ex := range diff.Removed {
+		tag, err := tx.Exec(ctx,
+			`DELETE FROM exercises WHERE id::text = $1 AND user_id = $2::uuid`,
+			ex.Id, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete exercise %s: %w", ex.Id, err)
+		}
+		if tag.RowsAffected() == 0 {
+			return nil, fmt.Errorf("exercise %s no longer exists: %w", ex.Id, ErrReparseStale)
+		}
+		ids = slices.DeleteFunc(ids, func(id string) bool { return id == ex.Id })
+	}
+
+	for _, change := range diff.Changed {
+		ex := change.After
+		attributes := ex.Attributes
+		if attributes == nil {
+			attributes = []string{}
+		}
+		tag, err := tx.Exec(ctx, `
+			UPDATE exercises SET
+				exercise_name = $1,
+				type = $2,
+				sets = $3,
+				work = $4,
+				work_type = $5,
+				resistance = $6,
+				resistance_type = $7,
+				duration = $8,
+				attributes = $9,
+				performed_at = COALESCE($10, performed_at),
+				raw_exercise_name = COALESCE(NULLIF($13, ''), raw_exercise_name),
+				original_resistance_type = NULLIF($14, ''),
+				original_work_type = NULLIF($15, '')
+			WHERE id::text = $11 AND user_id = $12::uuid`,
+			ex.Exercise, ex.Type, ex.Sets, ex.Quantity, ex.QuantityType,
+			ex.Resistance, ex.ResistanceType, ex.Duration, attributes, ex.PerformedAt,
+			change.Before.Id, userID, ex.RawName, ex.OriginalResistanceType, ex.OriginalWorkType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update exercise %s: %w", change.Before.Id, err)
+		}
+		if tag.RowsAffected() == 0 {
+			return nil, fmt.Errorf("exercise %s no longer exists: %w", change.Before.Id, ErrReparseStale)
+		}
+		if err := insertSets(ctx, tx, change.Before.Id, ex.SetDetails); err != nil {
+			return nil, err
+		}
+	}
+
+	// Added exercises join the workout of the ones they were parsed with,
+	// or are placed like a new message's when none of those had one
+	added := slices.Clone(diff.Added)
+	for i := range added {
+		added[i].UserId = userID
+	}
+	workoutID := ""
+	for _, ex := range slices.Concat(diff.Removed, changedBefore(diff.Changed)) {
+		if ex.WorkoutID != "" {
+			workoutID = ex.WorkoutID
+			break
+		}
+	}
+	if workoutID != "" {
+		err = s.joinWorkout(ctx, tx, userID, workoutID, added)
+	} else {
+		err = s.assignWorkout(ctx, tx, userID, added)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, ex := range added {
+		inserted, err := insertExercise(ctx, tx, ex)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, fmt.Sprint(inserted["id"]))
+	}
+
+	rows, err := tx.Query(ctx, `SELECT * FROM exercises WHERE id::text = ANY($1::text[])`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error reading reparsed exercises: %w", err)
+	}
+	compiled, err := pgx.CollectRows(rows, pgx.RowToMap)
+	if err != nil {
+		return nil, fmt.Errorf("error collecting reparsed exercises: %w", err)
+	}
+	data, err := json.Marshal(compiled)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE jobs SET result = $1::jsonb, updated_at = now() WHERE id = $2::uuid`,
+		data, sourceID); err != nil {
+		return nil, fmt.Errorf("error updating job %s: %w", sourceID, err)
+	}
+	return data, nil
+}
+
+// IsMessageJob reports whether a job extracted exercises from a user message,
+// the only kind of job that can be reparsed
+func IsMessageJob(job *Job) bool {
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(job.Data, &header); err != nil {
+		return false
+	}
+	return header.Type == "" || header.Type == JobTypeMessage
+}
+
+// jobMessage returns the user message a message job was created with
+func jobMessage(job *Job) (string, error) {
+	var js map[string]interface{}
+	if err := json.Unmarshal(job.Data, &js); err != nil {
+		return "", fmt.Errorf("error deserializing job data: %w", err)
+	}
+	message, ok := js["message"].(string)
+	if !ok {
+		return "", fmt.Errorf("request %v did not contain key 'message'", js)
+	}
+	return message, nil
+}
+
+// jobExerciseIDs returns the ids of the exercise rows stored in a job result,
+// which is either the row array or a partial success wrapper around it
+func jobExerciseIDs(result json.RawMessage) []string {
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(result, &rows); err != nil {
+		var wrapped struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal(result, &wrapped); err != nil {
+			return nil
+		}
+		rows = wrapped.Data
+	}
+
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if id, ok := row["id"]; ok && id != nil {
+			ids = append(ids, fmt.Sprint(id))
+		}
+	}
+	return ids
+}
+
+// exercisesByID loads the user's exercises with the given ids
+func exercisesByID(ctx context.Context, q querier, ids []string, userID string) ([]llm.Exercise, error) {
+	rows, err := q.Query(ctx, `SELECT `+exerciseColumns+` FROM exercises
+		WHERE id::text = ANY($1::text[]) AND user_id = $2::uuid`, ids, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading exercises: %w", err)
+	}
+	exercises, err := pgx.CollectRows(rows, scanExercise)
+	if err != nil {
+		return nil, err
+	}
+	return exercises, loadSets(ctx, q, exercises)
+}
+
+// diffExercises pairs stored and parsed exercises by name and reports what
+// was added, removed or changed
+func diffExercises(stored []llm.Exercise, parsed []llm.Exercise) ExerciseDiff {
+	diff := ExerciseDiff{
+		Added:   []llm.Exercise{},
+		Removed: []llm.Exercise{},
+		Changed: []ExerciseChange{},
+	}
+	matched := make([]bool, len(stored))
+
+	for _, after := range parsed {
+		found := -1
+		for i, before := range stored {
+			if !matched[i] && strings.EqualFold(strings.TrimSpace(before.Exercise), strings.TrimSpace(after.Exercise)) {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			diff.Added = append(diff.Added, after)
+			continue
+		}
+
+		matched[found] = true
+		before := stored[found]
+		if fields := changedFields(before, after); len(fields) > 0 {
+			after.Id = before.Id
+			diff.Changed = append(diff.Changed, ExerciseChange{Before: before, After: after, Fields: fields})
+		}
+	}
+
+	for i, before := range stored {
+		if !matched[i] {
+			diff.Removed = append(diff.Removed, before)
+		}
+	}
+	return diff
+}
+
+// changedFields lists the json names of the extracted fields that differ
+func changedFields(a llm.Exercise, b llm.Exercise) []string {
+	fields := make([]string, 0)
+	if a.Exercise != b.Exercise {
+		fields = append(fields, "exercise_name")
+	}
+	if a.Type != b.Type {
+		fields = append(fields, "type")
+	}
+	if a.Sets != b.Sets {
+		fields = append(fields, "sets")
+	}
+	if a.Quantity != b.Quantity {
+		fields = append(fields, "work")
+	}
+	if a.QuantityType != b.QuantityType {
+		fields = append(fields, "work_type")
+	}
+	if a.Resistance != b.Resistance {
+		fields = append(fields, "resistance")
+	}
+	if a.ResistanceType != b.ResistanceType {
+		fields = append(fields, "resistance_type")
+	}
+	if a.Duration != b.Duration {
+		fields = append(fields, "duration")
+	}
+	if !sameAttributes(a.Attributes, b.Attributes) {
+		fields = append(fields, "attributes")
+	}
+	if !samePerformedAt(a.PerformedAt, b.PerformedAt) {
+		fields = append(fields, "performed_at")
+	}
+	if !slices.Equal(a.SetDetails, b.SetDetails) {
+		fields = append(fields, "set_details")
+	}
+	return fields
+}
+
+// sameAttributes compares attribute lists ignoring order
+func sameAttributes(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// samePerformedAt compares performed times to the minute, so the seconds
+// between a message being sent and its exercises being stored don't count as
+// a change
+func samePerformedAt(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Sub(*b).Abs() < time.Minute
+}
+
+// changedBefore returns the stored exercises of changes
+func changedBefore(changes []ExerciseChange) []llm.Exercise {
+	before := make([]llm.Exercise, len(changes))
+	for i, change := range changes {
+		before[i] = change.Before
+	}
+	return before
+}
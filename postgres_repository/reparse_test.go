@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	llm "noerkrieg.com/server/llm"
+)
+
+func TestDiffExercises(t *testing.T) {
+	at := time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC)
+	seconds := at.Add(30 * time.Second)
+	later := at.Add(2 * time.Hour)
+
+	bench := llm.Exercise{Id: "1", Exercise: "Bench Press", Type: "strength", Sets: 3, Quantity: 5, QuantityType: "repetitions",
+		Resistance: 100, ResistanceType: "kilograms", Attributes: []string{"Paused", "Close Grip"}, PerformedAt: &at}
+	squat := llm.Exercise{Id: "2", Exercise: "Back Squat", Type: "strength", Sets: 5, Quantity: 5, QuantityType: "repetitions",
+		Resistance: 140, ResistanceType: "kilograms"}
+	with := func(ex llm.Exercise, change func(*llm.Exercise)) llm.Exercise {
+		ex.Id = ""
+		ex.Attributes = slices.Clone(ex.Attributes)
+		change(&ex)
+		return ex
+	}
+
+	tests := []struct {
+		name    string
+		stored  []llm.Exercise
+		parsed  []llm.Exercise
+		added   []string
+		removed []string
+		changed map[string][]string
+	}{
+		{
+			name:   "unchanged, ignoring attribute order and seconds",
+			stored: []llm.Exercise{bench, squat},
+			parsed: []llm.Exercise{
+				with(squat, func(ex *llm.Exercise) {}),
+				with(bench, func(ex *llm.Exercise) {
+					ex.Attributes = []string{"Close Grip", "Paused"}
+					ex.PerformedAt = &seconds
+				}),
+			},
+		},
+		{
+			name:   "renamed, matched ignoring case and spaces",
+			stored: []llm.Exercise{bench, squat},
+			parsed: []llm.Exercise{
+				with(squat, func(ex *llm.Exercise) {}),
+				with(bench, func(ex *llm.Exercise) { ex.Exercise = " bench press " }),
+			},
+			changed: map[string][]string{" bench press ": {"exercise_name"}},
+		},
+		{
+			name:   "changed fields",
+			stored: []llm.Exercise{bench},
+			parsed: []llm.Exercise{with(bench, func(ex *llm.Exercise) {
+				ex.Sets = 4
+				ex.Resistance = 102.5
+				ex.Attributes = []string{"Paused"}
+				ex.PerformedAt = &later
+				ex.SetDetails = []llm.ExerciseSet{{Reps: 5, Load: 102.5}}
+			})},
+			changed: map[string][]string{"Bench Press": {"sets", "resistance", "attributes", "performed_at", "set_details"}},
+		},
+		{
+			name:    "added and removed",
+			stored:  []llm.Exercise{bench, squat},
+			parsed:  []llm.Exercise{with(squat, func(ex *llm.Exercise) {}), {Exercise: "Deadlift"}},
+			added:   []string{"Deadlift"},
+			removed: []string{"Bench Press"},
+		},
+		{
+			name:   "repeated exercises pair in order",
+			stored: []llm.Exercise{bench, with(bench, func(ex *llm.Exercise) { ex.Id = "3"; ex.Resistance = 80 })},
+			parsed: []llm.Exercise{
+				with(bench, func(ex *llm.Exercise) {}),
+				with(bench, func(ex *llm.Exercise) { ex.Resistance = 80 }),
+				with(bench, func(ex *llm.Exercise) { ex.Resistance = 60 }),
+			},
+			added: []string{"Bench Press"},
+		},
+		{
+			name:    "nothing parsed",
+			stored:  []llm.Exercise{squat},
+			removed: []string{"Back Squat"},
+		},
+	}
+	names := func(exercises []llm.Exercise) []string {
+		var names []string
+		for _, ex := range exercises {
+			names = append(names, ex.Exercise)
+		}
+		return names
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := diffExercises(tt.stored, tt.parsed)
+			if got := names(diff.Added); !slices.Equal(got, tt.added) {
+				t.Errorf("added = %v, want %v", got, tt.added)
+			}
+			if got := names(diff.Removed); !slices.Equal(got, tt.removed) {
+				t.Errorf("removed = %v, want %v", got, tt.removed)
+			}
+			if len(diff.Changed) != len(tt.changed) {
+				t.Fatalf("got %d changes, want %d: %+v", len(diff.Changed), len(tt.changed), diff.Changed)
+			}
+			for _, change := range diff.Changed {
+				if want := tt.changed[change.After.Exercise]; !slices.Equal(change.Fields, want) {
+					t.Errorf("%s changed %v, want %v", change.After.Exercise, change.Fields, want)
+				}
+				if change.After.Id != change.Before.Id {
+					t.Errorf("%s change has id %q, want the stored id %q", change.After.Exercise, change.After.Id, change.Before.Id)
+				}
+			}
+		})
+	}
+}
+
+func TestIsMessageJob(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{data: `{"message": "bench 3x5 100kg"}`, want: true},
+		{data: `{"type": "message", "message": "bench 3x5 100kg"}`, want: true},
+		{data: `{"type": "reparse", "job_id": "7"}`, want: false},
+		{data: `{"type": "activity_import"}`, want: false},
+		{data: `not json`, want: false},
+	}
+	for _, tt := range tests {
+		if got := IsMessageJob(&Job{Data: []byte(tt.data)}); got != tt.want {
+			t.Errorf("IsMessageJob(%s) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
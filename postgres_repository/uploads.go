@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// UploadJob is a job payload that refers to an uploaded file by id
+type UploadJob interface {
+	SetUpload(id string)
+}
+
+func (r *CSVImportRequest) SetUpload(id string)      { r.UploadID = id }
+func (r *ActivityImportRequest) SetUpload(id string) { r.UploadID = id }
+
+// CreateUploadJob stores an uploaded file and inserts a pending job for the
+// user referring to it, in one transaction
+func (s *SupabaseStore) CreateUploadJob(userID string, filename string, content []byte, data UploadJob, priority int) (*Job, error) {
+	ctx := context.Background()
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && rbErr != pgx.ErrTxClosed {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
+	}()
+
+	var uploadID string
+	if err := tx.QueryRow(ctx, `
+		INSERT INTO uploads (user_id, filename, content) VALUES ($1::uuid, $2, $3)
+		RETURNING id::text
+	`, userID, filename, content).Scan(&uploadID); err != nil {
+		return nil, fmt.Errorf("error storing upload: %w", err)
+	}
+	data.SetUpload(uploadID)
+
+	job, err := insertJob(ctx, tx, userID, data, priority)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// loadUpload returns the content of one of the user's uploads
+func (s *SupabaseStore) loadUpload(ctx context.Context, id string, userID string) ([]byte, error) {
+	var content []byte
+	err := s.Pool.QueryRow(ctx, `SELECT content FROM uploads WHERE id = $1::uuid AND user_id = $2::uuid`,
+		id, userID).Scan(&content)
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("upload %s not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading upload %s: %w", id, err)
+	}
+	return content, nil
+}
+
+// deleteJobUpload removes the file a job that completed or will not be
+// retried was enqueued with, if any
+func (s *SupabaseStore) deleteJobUpload(job *Job) {
+	var ref struct {
+		UploadID string `json:"upload_id"`
+	}
+	if err := json.Unmarshal(job.Data, &ref); err != nil || ref.UploadID == "" {
+		return
+	}
+	if _, err := s.Pool.Exec(context.Background(), `DELETE FROM uploads WHERE id = $1::uuid`, ref.UploadID); err != nil {
+		log.Printf("Error deleting upload %s of job %s: %v", ref.UploadID, job.ID, err)
+	}
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	llm "noerkrieg.com/server/llm"
+)
+
+// ErrBudgetExceeded is returned for jobs of users who have spent their
+// monthly LLM budget
+var ErrBudgetExceeded = errors.New("monthly LLM budget exceeded")
+
+// permanentError marks a job failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// isPermanent reports whether a job failure should not be retried
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// CheckBudget returns ErrBudgetExceeded once the user's spend this calendar
+// month has reached MonthlyBudgetUSD
+func (s *SupabaseStore) CheckBudget(userID string) error {
+	if s.MonthlyBudgetUSD <= 0 {
+		return nil
+	}
+	spent, err := s.MonthlySpend(userID)
+	if err != nil {
+		return fmt.Errorf("error checking LLM budget: %w", err)
+	}
+	if spent >= s.MonthlyBudgetUSD {
+		return permanentError{fmt.Errorf("%w: spent $%.2f of $%.2f this month",
+			ErrBudgetExceeded, spent, s.MonthlyBudgetUSD)}
+	}
+	return nil
+}
+
+// MonthlySpend returns the user's estimated LLM cost this calendar month
+func (s *SupabaseStore) MonthlySpend(userID string) (float64, error) {
+	var spent float64
+	err := s.Pool.QueryRow(context.Background(), `
+		SELECT COALESCE(SUM(cost_usd), 0) FROM llm_usage_daily
+		WHERE user_id = $1::uuid AND day >= date_trunc('month', now())::date
+	`, userID).Scan(&spent)
+	return spent, err
+}
+
+// DailyUsage returns the user's usage for each of the last days days
+func (s *SupabaseStore) DailyUsage(userID string, days int) ([]DailyUsage, error) {
+	rows, err := s.Pool.Query(context.Background(), `
+		SELECT day, calls, prompt_tokens, completion_tokens, cost_usd
+		FROM llm_usage_daily
+		WHERE user_id = $1::uuid AND day > current_date - $2::integer
+		ORDER BY day DESC
+	`, userID, days)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[DailyUsage])
+}
+
+// recordExtraction records the prompt version the job ran with, and adds an
+// extraction's usage to the job row and the user's daily aggregate. Cached
+// extractions have no usage, so only their prompt version is recorded.
+func (s *SupabaseStore) recordExtraction(job *Job, result *llm.Result) {
+	if result == nil {
+		return
+	}
+	ctx := context.Background()
+	if result.PromptVersion != "" {
+		job.PromptVersion = result.PromptVersion
+	}
+	usage := result.Usage
+	if usage == nil {
+		if _, err := s.Pool.Exec(ctx, `UPDATE jobs SET prompt_version = $1::text WHERE id = $2::uuid`,
+			job.PromptVersion, job.ID); err != nil {
+			log.Printf("Error recording prompt version for job %s: %v", job.ID, err)
+		}
+		return
+	}
+	job.PromptTokens += usage.PromptTokens
+	job.CompletionTokens += usage.CompletionTokens
+	job.CostUSD += usage.CostUSD
+
+	batch := &pgx.Batch{}
+	batch.Queue(`
+		UPDATE jobs SET
+			prompt_tokens = prompt_tokens + $1::integer,
+			completion_tokens = completion_tokens + $2::integer,
+			cost_usd = cost_usd + $3::double precision,
+			prompt_version = $4::text
+		WHERE id = $5::uuid
+	`, usage.PromptTokens, usage.CompletionTokens, usage.CostUSD, job.PromptVersion, job.ID)
+	batch.Queue(`
+		INSERT INTO llm_usage_daily (user_id, day, calls, prompt_tokens, completion_tokens, cost_usd)
+		VALUES ($1::uuid, current_date, 1, $2::bigint, $3::bigint, $4::double precision)
+		ON CONFLICT (user_id, day) DO UPDATE SET
+			calls = llm_usage_daily.calls + 1,
+			prompt_tokens = llm_usage_daily.prompt_tokens + EXCLUDED.prompt_tokens,
+			completion_tokens = llm_usage_daily.completion_tokens + EXCLUDED.completion_tokens,
+			cost_usd = llm_usage_daily.cost_usd + EXCLUDED.cost_usd
+	`, job.UserID, usage.PromptTokens, usage.CompletionTokens, usage.CostUSD)
+	if err := s.Pool.SendBatch(ctx, batch).Close(); err != nil {
+		log.Printf("Error recording LLM usage for job %s: %v", job.ID, err)
+	}
+}
@@ -5,19 +5,46 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
 	llm "noerkrieg.com/server/llm"
 )
 
-func NewWorkQueue(workers int, store *SupabaseStore) *WorkQueue {
+func NewWorkQueue(workers int, store *SupabaseStore, extractor llm.Extractor) *WorkQueue {
 	return &WorkQueue{
-		workers:  workers,
-		store:    store,
-		shutdown: make(chan struct{}),
+		PollInterval: DefaultPollInterval,
+		workers:      workers,
+		store:        store,
+		extractor:    extractor,
+		counters:     make([]workerCounters, workers),
+		shutdown:     make(chan struct{}),
 	}
 }
 
+// workerCounters counts the jobs a worker finished since startup
+type workerCounters struct {
+	processed atomic.Int64
+	failed    atomic.Int64
+}
+
+// Stats returns the number of jobs each worker completed and failed since startup
+func (p *WorkQueue) Stats() []WorkerStats {
+	stats := make([]WorkerStats, len(p.counters))
+	for i := range p.counters {
+		stats[i] = WorkerStats{
+			Worker:    workerName(i),
+			Processed: p.counters[i].processed.Load(),
+			Failed:    p.counters[i].failed.Load(),
+		}
+	}
+	return stats
+}
+
+func workerName(id int) string {
+	return fmt.Sprintf("worker-%d", id)
+}
+
 // Start initializes the worker pool and notification listener
 func (p *WorkQueue) Start() {
 	// Start the PostgreSQL notification listener
@@ -57,7 +84,8 @@ func (p *WorkQueue) Shutdown(ctx context.Context) {
 
 func (w *WorkQueue) worker(id int) {
 	defer w.wg.Done()
-	workerID := fmt.Sprintf("worker-%d", id)
+	workerID := workerName(id)
+	counters := &w.counters[id]
 
 	log.Printf("Worker %s started", workerID)
 
@@ -88,7 +116,7 @@ func (w *WorkQueue) worker(id int) {
 					backoff = min(backoff*2, maxBackoff)
 				} else if job != nil {
 					// Process the claimed job
-					w.processClaimedJob(job, workerID)
+					w.processClaimedJob(job, workerID, counters)
 					// Reset backoff on successful operation
 					backoff = 100 * time.Millisecond
 				} else {
@@ -115,13 +143,13 @@ func (w *WorkQueue) worker(id int) {
 					checkForPendingJobs = true
 				} else if claimedJob != nil {
 					// Process the claimed job
-					w.processClaimedJob(claimedJob, workerID)
+					w.processClaimedJob(claimedJob, workerID, counters)
 					// Reset backoff on successful operation
 					backoff = 100 * time.Millisecond
 					// Check for more pending jobs
 					checkForPendingJobs = true
 				}
-			case <-time.After(30 * time.Second):
+			case <-time.After(w.PollInterval):
 				// Periodically check for pending jobs even without notifications
 				// This provides resilience in case we miss a notification
 				log.Printf("Worker %s periodic check for pending jobs", workerID)
@@ -131,20 +159,28 @@ func (w *WorkQueue) worker(id int) {
 	}
 }
 
-func (w *WorkQueue) processClaimedJob(job *Job, workerID string) {
+func (w *WorkQueue) processClaimedJob(job *Job, workerID string, counters *workerCounters) {
 	log.Printf("Worker %s processing job %s", workerID, job.ID)
 	result, err := w.processJob(job)
 
 	if err != nil {
 		log.Printf("Worker %s job processing error: %v", workerID, err)
+		counters.failed.Add(1)
 		job.Status = StatusFailed
 		job.Error = err.Error()
+		if isPermanent(err) {
+			job.RetryCount = MaxRetries
+		}
 
 		// Handle update errors
 		if updateErr := w.store.updateJob(job); updateErr != nil {
 			log.Printf("Worker %s error updating failed job: %v", workerID, updateErr)
+		} else if job.RetryCount >= MaxRetries {
+			w.store.recordImportProgress(job)
+			w.store.deleteJobUpload(job)
 		}
 	} else {
+		counters.processed.Add(1)
 		job.Status = StatusCompleted
 		job.Result = result
 		job.Error = ""
@@ -154,6 +190,8 @@ func (w *WorkQueue) processClaimedJob(job *Job, workerID string) {
 			log.Printf("Worker %s error updating completed job: %v", workerID, updateErr)
 		} else {
 			log.Printf("Worker %s successfully updated job %s", workerID, job.ID)
+			w.store.recordImportProgress(job)
+			w.store.deleteJobUpload(job)
 		}
 
 		// we need to now update exercises with the parsed JSON from job.results.
@@ -170,23 +208,55 @@ func min(a, b time.Duration) time.Duration {
 }
 
 func (w *WorkQueue) processJob(job *Job) (json.RawMessage, error) {
-	var js map[string]interface{}
-	if err := json.Unmarshal(job.Data, &js); err != nil {
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(job.Data, &header); err != nil {
 		log.Printf("Error deserializing job data: %v", err)
 		return nil, err
 	}
-	message, ok := js["message"].(string)
-	if !ok {
+
+	switch header.Type {
+	case "", JobTypeMessage:
+		return w.processMessageJob(job)
+	case JobTypeReparse:
+		return w.processReparseJob(job)
+	case JobTypeCSVImport:
+		return w.processCSVImportJob(job)
+	case JobTypeExport:
+		return w.processExportJob(job)
+	case JobTypeActivity:
+		return w.processActivityJob(job)
+	default:
+		return nil, fmt.Errorf("unknown job type %q", header.Type)
+	}
+}
+
+func (w *WorkQueue) processMessageJob(job *Job) (json.RawMessage, error) {
+	message, err := jobMessage(job)
+	if err != nil {
 		log.Printf("Request did not contain message.")
-		return nil, fmt.Errorf("request %v did not contain key 'message'", js)
+		return nil, err
 	}
-	processed, err := llm.ProcessMessage(message)
+	var req MessageRequest
+	if err := json.Unmarshal(job.Data, &req); err != nil {
+		return nil, fmt.Errorf("invalid message request: %w", err)
+	}
+	if err := w.store.CheckBudget(job.UserID); err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	sentAt := messageSentAt(job, req)
+	extractionReq := w.store.extractionRequest(ctx, job, message, sentAt)
+	extraction, err := w.extractor.Extract(ctx, extractionReq)
+	w.store.recordExtraction(job, extraction)
 	if err != nil {
 		log.Printf("Error on sending message to Wit: %v", err)
 		return nil, err
 	}
+	processed := extraction.Exercises
 
-	response, uploadErrors, err := w.store.upload(processed, job.UserID, message)
+	response, uploadErrors, err := w.store.upload(processed, job.UserID, message, sentAt, extractionReq.Catalog())
 	if err != nil {
 		// Critical error that prevented any processing
 		return nil, fmt.Errorf("critical error in exercise upload: %w", err)
@@ -230,3 +300,27 @@ func (w *WorkQueue) processJob(job *Job) (json.RawMessage, error) {
 	// Complete success
 	return response, nil
 }
+
+// messageSentAt returns when a message job's message was sent, in the user's
+// time zone: its timestamp when it has one, and otherwise when it was queued
+func messageSentAt(job *Job, req MessageRequest) time.Time {
+	sentAt := job.CreatedAt
+	if req.Timestamp != nil {
+		sentAt = *req.Timestamp
+	}
+	return sentAt.In(userLocation(req.Timezone))
+}
+
+// userLocation loads a user's time zone, falling back to UTC when it is
+// unset or unknown
+func userLocation(timezone string) *time.Location {
+	if timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.Printf("Unknown timezone %q, using UTC", timezone)
+		return time.UTC
+	}
+	return loc
+}
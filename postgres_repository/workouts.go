@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	llm "noerkrieg.com/server/llm"
+)
+
+// assignWorkout places the exercises of one message in a workout: the
+// user's workout that ended within the merge window before them, or started
+// within it after them, or else a new one. Exercises are numbered after
+// those already in the workout, and their groups are renumbered so they
+// don't join a superset or circuit from an earlier message.
+//
+// The assignment runs in a transaction nested in outer, which holds a
+// per-user lock until it ends, so the exercises must be inserted in outer for
+// their numbers to stay unique.
+func (s *SupabaseStore) assignWorkout(ctx context.Context, outer pgx.Tx, userID string, exercises []llm.Exercise) error {
+	if len(exercises) == 0 {
+		return nil
+	}
+	started, ended := performedRange(exercises)
+	window := s.WorkoutMergeWindow
+	if window <= 0 {
+		window = DefaultWorkoutMergeWindow
+	}
+
+	tx, err := outer.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && rbErr != pgx.ErrTxClosed {
+			log.Printf("Error rolling back transaction: %v", rbErr)
+		}
+	}()
+
+	// Serialize assignments per user until outer ends, so concurrent messages
+	// of one session don't each start a workout or reuse the same numbers
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, userID); err != nil {
+		return fmt.Errorf("error locking workouts: %w", err)
+	}
+
+	var workoutID string
+	err = tx.QueryRow(ctx, `
+		SELECT id::text FROM workouts
+		WHERE user_id = $1::uuid
+			AND ended_at >= $2 - make_interval(secs => $4)
+			AND started_at <= $3 + make_interval(secs => $4)
+		ORDER BY ended_at DESC
+		LIMIT 1
+	`, userID, started, ended, window.Seconds()).Scan(&workoutID)
+	if err == pgx.ErrNoRows {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO workouts (user_id, started_at, ended_at)
+			VALUES ($1::uuid, $2, $3)
+			RETURNING id::text
+		`, userID, started, ended).Scan(&workoutID)
+	} else if err == nil {
+		_, err = tx.Exec(ctx, `
+			UPDATE workouts SET
+				started_at = LEAST(started_at, $2),
+				ended_at = GREATEST(ended_at, $3),
+				updated_at = now()
+			WHERE id = $1::uuid
+		`, workoutID, started, ended)
+	}
+	if err != nil {
+		return fmt.Errorf("error assigning workout: %w", err)
+	}
+
+	if err := numberExercises(ctx, tx, workoutID, exercises); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// joinWorkout adds exercises to one of the user's workouts, numbered after
+// those already in it and under the same lock as assignWorkout, so the
+// exercises must be inserted in tx as well
+func (s *SupabaseStore) joinWorkout(ctx context.Context, tx pgx.Tx, userID string, workoutID string, exercises []llm.Exercise) error {
+	if len(exercises) == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, userID); err != nil {
+		return fmt.Errorf("error locking workouts: %w", err)
+	}
+	started, ended := performedRange(exercises)
+	if _, err := tx.Exec(ctx, `
+		UPDATE workouts SET
+			started_at = LEAST(started_at, $2),
+			ended_at = GREATEST(ended_at, $3),
+			updated_at = now()
+		WHERE id = $1::uuid
+	`, workoutID, started, ended); err != nil {
+		return fmt.Errorf("error updating workout %s: %w", workoutID, err)
+	}
+	return numberExercises(ctx, tx, workoutID, exercises)
+}
+
+// numberExercises places exercises in a workout after those already in it,
+// renumbering their groups past the workout's
+func numberExercises(ctx context.Context, q querier, workoutID string, exercises []llm.Exercise) error {
+	var position, group int
+	if err := q.QueryRow(ctx, `
+		SELECT COALESCE(MAX(position), 0), COALESCE(MAX(group_number), 0)
+		FROM exercises WHERE workout_id = $1::uuid
+	`, workoutID).Scan(&position, &group); err != nil {
+		return fmt.Errorf("error numbering workout %s: %w", workoutID, err)
+	}
+	for i := range exercises {
+		exercises[i].WorkoutID = workoutID
+		exercises[i].Position = position + i + 1
+		if exercises[i].Group > 0 {
+			exercises[i].Group += group
+		}
+	}
+	return nil
+}
+
+// performedRange returns the earliest and latest performed_at of exercises
+func performedRange(exercises []llm.Exercise) (time.Time, time.Time) {
+	var started, ended time.Time
+	for _, ex := range exercises {
+		at := ex.Timestamp
+		if ex.PerformedAt != nil {
+			at = *ex.PerformedAt
+		}
+		if started.IsZero() || at.Before(started) {
+			started = at
+		}
+		if at.After(ended) {
+			ended = at
+		}
+	}
+	return started, ended
+}
+
+// ListWorkouts returns the user's workouts that started between from and to,
+// most recent first, with their exercises
+func (s *SupabaseStore) ListWorkouts(userID string, from time.Time, to time.Time, limit int) ([]Workout, error) {
+	ctx := context.Background()
+	rows, err := s.Pool.Query(ctx, `
+		SELECT id::text, user_id::text, started_at, ended_at, created_at, updated_at
+		FROM workouts
+		WHERE user_id = $1::uuid AND started_at >= $2 AND started_at < $3
+		ORDER BY started_at DESC
+		LIMIT $4
+	`, userID, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error loading workouts: %w", err)
+	}
+	workouts, err := pgx.CollectRows(rows, scanWorkout)
+	if err != nil {
+		return nil, err
+	}
+	return workouts, s.loadWorkoutExercises(ctx, workouts)
+}
+
+// GetWorkout returns one of the user's workouts with its exercises, or nil
+// when there is no such workout
+func (s *SupabaseStore) GetWorkout(id string, userID string) (*Workout, error) {
+	ctx := context.Background()
+	rows, err := s.Pool.Query(ctx, `
+		SELECT id::text, user_id::text, started_at, ended_at, created_at, updated_at
+		FROM workouts WHERE id = $1::uuid AND user_id = $2::uuid
+	`, id, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading workout: %w", err)
+	}
+	workouts, err := pgx.CollectRows(rows, scanWorkout)
+	if err != nil || len(workouts) == 0 {
+		return nil, err
+	}
+	if err := s.loadWorkoutExercises(ctx, workouts); err != nil {
+		return nil, err
+	}
+	return &workouts[0], nil
+}
+
+func scanWorkout(row pgx.CollectableRow) (Workout, error) {
+	var w Workout
+	err := row.Scan(&w.ID, &w.UserID, &w.StartedAt, &w.EndedAt, &w.CreatedAt, &w.UpdatedAt)
+	return w, err
+}
+
+// loadWorkoutExercises fills in the groups of workouts from their exercises
+func (s *SupabaseStore) loadWorkoutExercises(ctx context.Context, workouts []Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+	ids := make([]string, len(workouts))
+	for i, w := range workouts {
+		ids[i] = w.ID
+	}
+
+	rows, err := s.Pool.Query(ctx, `SELECT `+exerciseColumns+` FROM exercises
+		WHERE workout_id::text = ANY($1::text[])
+		ORDER BY position ASC, id ASC`, ids)
+	if err != nil {
+		return fmt.Errorf("error loading workout exercises: %w", err)
+	}
+	exercises, err := pgx.CollectRows(rows, scanExercise)
+	if err != nil {
+		return err
+	}
+	if err := loadSets(ctx, s.Pool, exercises); err != nil {
+		return err
+	}
+
+	byWorkout := map[string][]llm.Exercise{}
+	for _, ex := range exercises {
+		byWorkout[ex.WorkoutID] = append(byWorkout[ex.WorkoutID], ex)
+	}
+	for i := range workouts {
+		workouts[i].Groups = groupExercises(byWorkout[workouts[i].ID])
+	}
+	return nil
+}
+
+// groupExercises gathers the exercises of a workout into groups, placing each
+// superset or circuit where its first exercise was performed
+func groupExercises(exercises []llm.Exercise) []WorkoutGroup {
+	groups := make([]WorkoutGroup, 0)
+	index := map[int]int{}
+	for _, ex := range exercises {
+		if ex.Group == 0 {
+			groups = append(groups, WorkoutGroup{Type: GroupSingle, Exercises: []llm.Exercise{ex}})
+			continue
+		}
+		i, ok := index[ex.Group]
+		if !ok {
+			i = len(groups)
+			index[ex.Group] = i
+			groups = append(groups, WorkoutGroup{})
+		}
+		groups[i].Exercises = append(groups[i].Exercises, ex)
+	}
+
+	for i := range groups {
+		if groups[i].Type != "" {
+			continue
+		}
+		switch len(groups[i].Exercises) {
+		case 1:
+			groups[i].Type = GroupSingle
+		case 2:
+			groups[i].Type = GroupSuperset
+		default:
+			groups[i].Type = GroupCircuit
+		}
+	}
+	return groups
+}
@@ -0,0 +1,27 @@
+package redis_repository
+
+import (
+	"context"
+	"time"
+)
+
+// ResponseCache stores cached LLM extractions in a Store, which expires them
+type ResponseCache struct {
+	store  Store
+	prefix string
+}
+
+// NewResponseCache returns a cache storing its keys under "llm-cache:"
+func NewResponseCache(store Store) *ResponseCache {
+	return &ResponseCache{store: store, prefix: "llm-cache:"}
+}
+
+// Get returns the value stored under key
+func (c *ResponseCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return c.store.Get(ctx, c.prefix+key)
+}
+
+// Set stores value under key for ttl
+func (c *ResponseCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.store.Set(ctx, c.prefix+key, value, ttl)
+}
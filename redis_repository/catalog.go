@@ -0,0 +1,66 @@
+package redis_repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// catalogKey holds the exercise context built from the Postgres catalog
+const catalogKey = "catalog:context"
+
+// CachedCatalog returns the cached exercise context, or nil when there is none
+func CachedCatalog(ctx context.Context, store Store) (*ExerciseContext, error) {
+	value, ok, err := store.Get(ctx, catalogKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var catalog ExerciseContext
+	if err := json.Unmarshal(value, &catalog); err != nil {
+		return nil, err
+	}
+	return &catalog, nil
+}
+
+// CacheCatalog caches the exercise context for ttl
+func CacheCatalog(ctx context.Context, store Store, catalog *ExerciseContext, ttl time.Duration) error {
+	value, err := json.Marshal(catalog)
+	if err != nil {
+		return err
+	}
+	return store.Set(ctx, catalogKey, value, ttl)
+}
+
+// InvalidateCatalog drops the cached exercise context after a catalog change
+func InvalidateCatalog(ctx context.Context, store Store) error {
+	return store.Delete(ctx, catalogKey)
+}
+
+// LegacySets reads the exercises and attributes sets the catalog replaced,
+// for seeding it
+func LegacySets(ctx context.Context, store Store) (*ExerciseContext, error) {
+	attributes, err := store.Members(ctx, "attributes")
+	if err != nil {
+		return nil, err
+	}
+	exercises, err := store.Members(ctx, "exercises")
+	if err != nil {
+		return nil, err
+	}
+	return &ExerciseContext{Exercises: exercises, Attributes: attributes}, nil
+}
+
+// catalogChannel carries a message whenever the catalog changes
+const catalogChannel = "catalog:changed"
+
+// PublishCatalogChange tells every instance that the catalog changed
+func PublishCatalogChange(ctx context.Context, store Store) error {
+	return store.Publish(ctx, catalogChannel)
+}
+
+// SubscribeCatalogChanges returns a channel receiving a value whenever the
+// catalog changes, until ctx is done. Changes arriving while one is pending
+// are coalesced.
+func SubscribeCatalogChanges(ctx context.Context, store Store) <-chan struct{} {
+	return store.Subscribe(ctx, catalogChannel)
+}
@@ -3,4 +3,6 @@ package redis_repository
 type ExerciseContext struct {
 	Exercises  []string `json:"exercises"`
 	Attributes []string `json:"attributes"`
+	// Aliases maps canonical exercise names to other names they go by
+	Aliases map[string][]string `json:"aliases,omitempty"`
 } 
\ No newline at end of file
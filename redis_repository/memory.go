@@ -0,0 +1,149 @@
+package redis_repository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store kept in the process. Its entries and notifications
+// are not shared with other instances, so it suits running a single instance
+// without Redis. Expired entries are swept as new ones are set, and past
+// MaxEntries the entry closest to expiring is evicted.
+type MemoryStore struct {
+	MaxEntries int
+
+	mu          sync.Mutex
+	entries     map[string]memoryEntry
+	subscribers map[string][]chan struct{}
+	sweptAt     time.Time
+}
+
+// Defaults for the MemoryStore
+const (
+	DefaultMemoryEntries = 10000
+	memorySweepInterval  = time.Minute
+)
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		MaxEntries:  DefaultMemoryEntries,
+		entries:     map[string]memoryEntry{},
+		subscribers: map[string][]chan struct{}{},
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; !ok {
+		s.makeRoom()
+	}
+	s.entries[key] = entry
+	return nil
+}
+
+// makeRoom drops the expired entries once every sweep interval, and evicts
+// the entry closest to expiring while the store is full. Entries without a
+// TTL are evicted last.
+func (s *MemoryStore) makeRoom() {
+	now := time.Now()
+	if now.Sub(s.sweptAt) >= memorySweepInterval {
+		for key, entry := range s.entries {
+			if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+				delete(s.entries, key)
+			}
+		}
+		s.sweptAt = now
+	}
+	for s.MaxEntries > 0 && len(s.entries) >= s.MaxEntries {
+		var evict string
+		var evictEntry *memoryEntry
+		for key, entry := range s.entries {
+			if evictEntry == nil || entry.expiresBefore(*evictEntry) {
+				evict, evictEntry = key, &entry
+			}
+		}
+		delete(s.entries, evict)
+	}
+}
+
+// expiresBefore reports whether the entry expires before other, entries
+// without a TTL never expiring
+func (e memoryEntry) expiresBefore(other memoryEntry) bool {
+	if e.expiresAt.IsZero() {
+		return false
+	}
+	return other.expiresAt.IsZero() || e.expiresAt.Before(other.expiresAt)
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// Members returns no members, as only Redis holds sets
+func (s *MemoryStore) Members(ctx context.Context, key string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (s *MemoryStore) Publish(ctx context.Context, channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, changes := range s.subscribers[channel] {
+		notify(changes)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Subscribe(ctx context.Context, channel string) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.subscribers[channel] = append(s.subscribers[channel], changes)
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		subscribers := s.subscribers[channel]
+		for i, c := range subscribers {
+			if c == changes {
+				s.subscribers[channel] = append(subscribers[:i], subscribers[i+1:]...)
+				break
+			}
+		}
+	}()
+	return changes
+}
+
+// Healthy always reports true, as there is nothing to reach
+func (s *MemoryStore) Healthy() bool {
+	return true
+}
@@ -0,0 +1,52 @@
+package redis_repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreSweepsExpiredEntries(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	s.Set(ctx, "expired", []byte("1"), time.Nanosecond)
+	s.Set(ctx, "kept", []byte("2"), time.Hour)
+	time.Sleep(time.Millisecond)
+
+	s.sweptAt = time.Time{}
+	s.Set(ctx, "new", []byte("3"), 0)
+	if _, ok := s.entries["expired"]; ok {
+		t.Error("expired entry was not swept")
+	}
+	if len(s.entries) != 2 {
+		t.Errorf("got %d entries, want 2", len(s.entries))
+	}
+}
+
+func TestMemoryStoreEvictsPastMaxEntries(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	s.MaxEntries = 3
+	s.Set(ctx, "forever", []byte("1"), 0)
+	s.Set(ctx, "soon", []byte("2"), time.Minute)
+	s.Set(ctx, "later", []byte("3"), time.Hour)
+	s.Set(ctx, "new", []byte("4"), time.Hour)
+
+	if len(s.entries) != 3 {
+		t.Errorf("got %d entries, want 3", len(s.entries))
+	}
+	if _, ok, _ := s.Get(ctx, "soon"); ok {
+		t.Error("the entry closest to expiring was not evicted")
+	}
+	for _, key := range []string{"forever", "later", "new"} {
+		if _, ok, _ := s.Get(ctx, key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+
+	// Overwriting a key does not evict another
+	s.Set(ctx, "new", []byte("5"), time.Hour)
+	if len(s.entries) != 3 {
+		t.Errorf("got %d entries after an overwrite, want 3", len(s.entries))
+	}
+}
@@ -0,0 +1,107 @@
+package redis_repository
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// ContextSource loads the current exercise context, such as from the catalog
+type ContextSource func(ctx context.Context) (*ExerciseContext, error)
+
+// ContextProvider serves the exercise context the prompt is built with. It
+// reloads the context from its source periodically and whenever it is told
+// the catalog changed, and keeps serving the last context it loaded when a
+// reload fails.
+type ContextProvider struct {
+	source   ContextSource
+	interval time.Duration
+	// staleAfter is how old the context may get before Health reports it
+	staleAfter time.Duration
+
+	mu       sync.RWMutex
+	current  *ExerciseContext
+	loadedAt time.Time
+	lastErr  error
+}
+
+// ContextHealth reports how fresh the served exercise context is
+type ContextHealth struct {
+	Stale      bool      `json:"stale"`
+	LoadedAt   time.Time `json:"loaded_at"`
+	Exercises  int       `json:"exercises"`
+	Attributes int       `json:"attributes"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// NewContextProvider returns a provider reloading from source every interval.
+// It serves an empty context until the first successful load.
+func NewContextProvider(source ContextSource, interval time.Duration) *ContextProvider {
+	return &ContextProvider{
+		source:     source,
+		interval:   interval,
+		staleAfter: 3 * interval,
+		current:    &ExerciseContext{Exercises: []string{}, Attributes: []string{}},
+	}
+}
+
+// Context returns the last successfully loaded exercise context. It is never
+// nil and must not be modified.
+func (p *ContextProvider) Context() *ExerciseContext {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.current
+}
+
+// Refresh reloads the context from the source. On failure the previous
+// context is kept and the error is returned.
+func (p *ContextProvider) Refresh(ctx context.Context) error {
+	loaded, err := p.source(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.lastErr = err
+		return err
+	}
+	p.current = loaded
+	p.loadedAt = time.Now()
+	p.lastErr = nil
+	return nil
+}
+
+// Run refreshes the context every interval and on each value received from
+// changes, until ctx is done. A nil changes channel only refreshes on the
+// interval.
+func (p *ContextProvider) Run(ctx context.Context, changes <-chan struct{}) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changes:
+			log.Printf("Catalog changed, reloading exercise context")
+		}
+		if err := p.Refresh(ctx); err != nil {
+			log.Printf("Error refreshing exercise context, keeping the last one: %v", err)
+		}
+	}
+}
+
+// Health reports whether the context has been loaded within staleAfter
+func (p *ContextProvider) Health() ContextHealth {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	health := ContextHealth{
+		Stale:      p.loadedAt.IsZero() || time.Since(p.loadedAt) > p.staleAfter,
+		LoadedAt:   p.loadedAt,
+		Exercises:  len(p.current.Exercises),
+		Attributes: len(p.current.Attributes),
+	}
+	if p.lastErr != nil {
+		health.LastError = p.lastErr.Error()
+	}
+	return health
+}
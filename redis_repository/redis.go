@@ -2,42 +2,174 @@ package redis_repository
 
 import (
 	"context"
-	"os"
+	"crypto/tls"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	redis "github.com/redis/go-redis/v9"
 )
 
-var ctx = context.Background()
+// Store holds shared cache entries and carries change notifications between
+// instances. RedisStore shares them through Redis; MemoryStore keeps them in
+// the process, for running without Redis.
+type Store interface {
+	// Get returns the value stored under key, and false when there is none
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key, expiring after ttl when it is positive
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// Members returns the members of the set stored under key
+	Members(ctx context.Context, key string) ([]string, error)
+	// Publish notifies the subscribers of channel
+	Publish(ctx context.Context, channel string) error
+	// Subscribe returns a channel receiving a value for each notification on
+	// channel until ctx is done. Notifications arriving while one is pending
+	// are coalesced.
+	Subscribe(ctx context.Context, channel string) <-chan struct{}
+	// Healthy reports whether the store is reachable
+	Healthy() bool
+}
+
+// Config configures the Redis connection; without Addrs no Redis is used.
+// Setting SentinelMaster connects through the sentinels at Addrs, and several
+// Addrs without it connect to a cluster.
+type Config struct {
+	Addrs            []string
+	Username         string
+	Password         string
+	DB               int
+	TLS              bool
+	PoolSize         int
+	SentinelMaster   string
+	SentinelPassword string
+}
 
-// Global read-only context variable
-var CachedExercises = GetContext()
+// NewStore connects to the configured Redis, or returns a MemoryStore when no
+// address is configured
+func NewStore(cfg Config) Store {
+	if len(cfg.Addrs) == 0 {
+		log.Printf("No REDIS_ADDR configured, caching in memory")
+		return NewMemoryStore()
+	}
 
-func GetClient() *redis.Client {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     "redis-10347.c240.us-east-1-3.ec2.redns.redis-cloud.com:10347",
-		Password: os.Getenv("REDIS_PW"), // no password set
-		DB:       0,                     // use default DB
-	})
-	return rdb
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		DB:               cfg.DB,
+		PoolSize:         cfg.PoolSize,
+		MasterName:       cfg.SentinelMaster,
+		SentinelPassword: cfg.SentinelPassword,
+	}
+	if cfg.TLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	store := &RedisStore{client: redis.NewUniversalClient(opts)}
+	log.Printf("Using Redis at %s", strings.Join(cfg.Addrs, ", "))
+	if err := store.ping(context.Background()); err != nil {
+		log.Printf("Redis is unreachable: %v", err)
+	}
+	return store
 }
 
-func GetContext() *ExerciseContext {
-	client := GetClient()
+// RedisStore is a Store backed by a single shared Redis client
+type RedisStore struct {
+	client  redis.UniversalClient
+	healthy atomic.Bool
+}
 
-	// Get all members from the attributes set
-	attributes, err := client.SMembers(ctx, "attributes").Result()
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
 	if err != nil {
-		attributes = []string{} // Return empty slice on error
+		return nil, false, err
 	}
+	return value, true, nil
+}
 
-	// Get all members from the exercises set
-	exercises, err := client.SMembers(ctx, "exercises").Result()
-	if err != nil {
-		exercises = []string{} // Return empty slice on error
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, max(ttl, 0)).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, key).Err()
+}
+
+func (s *RedisStore) Members(ctx context.Context, key string) ([]string, error) {
+	return s.client.SMembers(ctx, key).Result()
+}
+
+func (s *RedisStore) Publish(ctx context.Context, channel string) error {
+	return s.client.Publish(ctx, channel, "").Err()
+}
+
+func (s *RedisStore) Subscribe(ctx context.Context, channel string) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	pubsub := s.client.Subscribe(ctx, channel)
+	go func() {
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-messages:
+				notify(changes)
+			}
+		}
+	}()
+	return changes
+}
+
+func (s *RedisStore) Healthy() bool {
+	return s.healthy.Load()
+}
+
+// MonitorHealth pings Redis every interval until ctx is done, logging when
+// it becomes unreachable and when it recovers
+func (s *RedisStore) MonitorHealth(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.ping(ctx)
+			if err != nil && s.healthy.Swap(false) {
+				log.Printf("Redis is unreachable: %v", err)
+			}
+		}
 	}
+}
+
+// ping checks that Redis answers, marking the store healthy when it does
+func (s *RedisStore) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return err
+	}
+	if !s.healthy.Swap(true) {
+		log.Printf("Redis is reachable")
+	}
+	return nil
+}
+
+// Close closes the Redis client
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
 
-	return &ExerciseContext{
-		Exercises:  exercises,
-		Attributes: attributes,
+// notify sends on a buffered channel of one unless a value is already pending
+func notify(changes chan struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
 	}
 }
@@ -1,11 +1,18 @@
 #!/bin/bash
 
-# Number of instances to run inside the container
+# Number of instances to run inside the container. Setting API_INSTANCE_COUNT
+# or WORKER_INSTANCE_COUNT runs API-only and worker-only instances instead.
 INSTANCE_COUNT=${INSTANCE_COUNT:-3}
+API_INSTANCE_COUNT=${API_INSTANCE_COUNT:-0}
+WORKER_INSTANCE_COUNT=${WORKER_INSTANCE_COUNT:-0}
+TOTAL_INSTANCES=$INSTANCE_COUNT
+if [ "$API_INSTANCE_COUNT" -gt 0 ] || [ "$WORKER_INSTANCE_COUNT" -gt 0 ]; then
+  TOTAL_INSTANCES=$(($API_INSTANCE_COUNT + $WORKER_INSTANCE_COUNT))
+fi
 
 # Expose each port for each instance
 PORT_MAPPING=""
-for i in $(seq 1 $INSTANCE_COUNT); do
+for i in $(seq 1 $TOTAL_INSTANCES); do
   PORT=$((3000 + $i - 1))
   PORT_MAPPING="$PORT_MAPPING -p $PORT:$PORT"
 done
@@ -14,13 +21,37 @@ docker build -t bpyp-go .
 
 docker run $PORT_MAPPING \
     -e INSTANCE_COUNT="$INSTANCE_COUNT" \
+    -e API_INSTANCE_COUNT="${API_INSTANCE_COUNT}" \
+    -e WORKER_INSTANCE_COUNT="${WORKER_INSTANCE_COUNT}" \
     -e BPYP_POSTGRES_DIR_CONN="${BPYP_POSTGRES_DIR_CONN}" \
     -e BPYP_POSTGRES_TX_DIR_CONN="${BPYP_POSTGRES_TX_DIR_CONN}" \
     -e BPYP_SUPABASE_URL="${BPYP_SUPABASE_URL}" \
     -e BPYP_SUPABASE_SERVICE_KEY="${BPYP_SUPABASE_SERVICE_KEY}" \
     -e BPYP_POSTGRES_JWT_SECRET="${BPYP_POSTGRES_JWT_SECRET}" \
+    -e BPYP_CONFIG_FILE="${BPYP_CONFIG_FILE}" \
+    -e BPYP_DB_MAX_CONNS="${BPYP_DB_MAX_CONNS}" \
+    -e BPYP_NOTIFICATION_BUFFER="${BPYP_NOTIFICATION_BUFFER}" \
+    -e BPYP_MIGRATE="${BPYP_MIGRATE}" \
+    -e BPYP_POLL_INTERVAL="${BPYP_POLL_INTERVAL}" \
     -e BPYP_WIT_URL="${BPYP_WIT_URL}" \
+    -e REDIS_ADDR="${REDIS_ADDR}" \
+    -e REDIS_USERNAME="${REDIS_USERNAME}" \
     -e REDIS_PW="${REDIS_PW}"\
+    -e REDIS_DB="${REDIS_DB}" \
+    -e REDIS_TLS="${REDIS_TLS}" \
+    -e REDIS_POOL_SIZE="${REDIS_POOL_SIZE}" \
+    -e REDIS_SENTINEL_MASTER="${REDIS_SENTINEL_MASTER}" \
+    -e REDIS_SENTINEL_PW="${REDIS_SENTINEL_PW}" \
+    -e REDIS_HEALTH_INTERVAL="${REDIS_HEALTH_INTERVAL}" \
+    -e BPYP_MONTHLY_BUDGET_USD="${BPYP_MONTHLY_BUDGET_USD}" \
+    -e BPYP_LLM_MODEL="${BPYP_LLM_MODEL}" \
+    -e BPYP_LLM_CASSETTE_MODE="${BPYP_LLM_CASSETTE_MODE}" \
+    -e BPYP_LLM_CASSETTE_DIR="${BPYP_LLM_CASSETTE_DIR}" \
+    -e BPYP_LLM_CACHE="${BPYP_LLM_CACHE}" \
+    -e BPYP_LLM_CACHE_TTL="${BPYP_LLM_CACHE_TTL}" \
+    -e BPYP_WORKOUT_MERGE_WINDOW="${BPYP_WORKOUT_MERGE_WINDOW}" \
+    -e BPYP_CONTEXT_REFRESH_INTERVAL="${BPYP_CONTEXT_REFRESH_INTERVAL}" \
+    -e BPYP_NAME_CONFIDENCE="${BPYP_NAME_CONFIDENCE}" \
     -e BPYP_WIT_API_KEY="${BPYP_BEARER_API}" \
     -e OPENAI_API_KEY="${OPENAI_API_KEY}"\
     bpyp-go:latest
@@ -0,0 +1,220 @@
+// Package units stores exercise weights and distances in SI units and
+// converts them back to the units a user prefers to read them in.
+//
+// Exercises are stored with resistance in kilograms and distance work in
+// meters. The units they were logged in are kept in OriginalResistanceType
+// and OriginalWorkType, so they can be shown as logged. Resistance types that
+// combine bodyweight with a load, such as "bodyweight + pounds" for a
+// weighted pull-up, keep the bodyweight part and convert the load.
+package units
+
+import (
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	llm "noerkrieg.com/server/llm"
+)
+
+// Unit systems a user can prefer. AsLogged shows each exercise in the units
+// it was logged in.
+const (
+	AsLogged = ""
+	Metric   = "metric"
+	Imperial = "imperial"
+)
+
+// Canonical units exercises are stored in
+const (
+	Kilograms = "kilograms"
+	Meters    = "meters"
+)
+
+// Bodyweight is the resistance type of bodyweight exercises
+const Bodyweight = "bodyweight"
+
+type dimension int
+
+const (
+	weight dimension = iota
+	distance
+)
+
+type unit struct {
+	dimension dimension
+	// toSI is the number of kilograms or meters in one of the unit
+	toSI   float64
+	metric bool
+	// counterpart is the unit of the other system it is shown in
+	counterpart string
+}
+
+var knownUnits = map[string]unit{
+	"kilograms":  {dimension: weight, toSI: 1, metric: true, counterpart: "pounds"},
+	"pounds":     {dimension: weight, toSI: 0.45359237, counterpart: "kilograms"},
+	"meters":     {dimension: distance, toSI: 1, metric: true, counterpart: "yards"},
+	"kilometers": {dimension: distance, toSI: 1000, metric: true, counterpart: "miles"},
+	"miles":      {dimension: distance, toSI: 1609.344, counterpart: "kilometers"},
+	"yards":      {dimension: distance, toSI: 0.9144, counterpart: "meters"},
+	"feet":       {dimension: distance, toSI: 0.3048, counterpart: "meters"},
+}
+
+var unitSpellings = map[string]string{
+	"kg": "kilograms", "kgs": "kilograms", "kilo": "kilograms", "kilos": "kilograms", "kilogram": "kilograms",
+	"lb": "pounds", "lbs": "pounds", "pound": "pounds",
+	"m": "meters", "meter": "meters", "metre": "meters", "metres": "meters",
+	"km": "kilometers", "kms": "kilometers", "kilometer": "kilometers", "kilometre": "kilometers", "kilometres": "kilometers",
+	"mi": "miles", "mile": "miles",
+	"yd": "yards", "yds": "yards", "yard": "yards",
+	"ft": "feet", "foot": "feet",
+}
+
+// Valid reports whether system is a unit system a user can prefer
+func Valid(system string) bool {
+	return system == AsLogged || system == Metric || system == Imperial
+}
+
+// Name standardizes a unit to its full plural spelling, leaving units it does
+// not know lowercased
+func Name(u string) string {
+	u = strings.ToLower(strings.TrimSpace(u))
+	if name, ok := unitSpellings[u]; ok {
+		return name
+	}
+	return u
+}
+
+// mixedPattern matches resistance types combining bodyweight with a load,
+// such as "bodyweight + pounds" or "BW - kg" for assisted exercises
+var mixedPattern = regexp.MustCompile(`(?i)^\s*(?:body\s*weight|bw)\s*([+-]|plus|minus)\s*(.+?)\s*$`)
+
+// loadPattern matches a load written into a resistance type, such as the
+// "25 lb" of "bodyweight + 25 lb"
+var loadPattern = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)\s*(.+)$`)
+
+// resistance is a parsed resistance type
+type resistance struct {
+	// sign is "+" or "-" for a load added to or taken off bodyweight, and
+	// empty for a plain load
+	sign string
+	unit string
+	// load is the load written into the type, zero when there is none
+	load float64
+}
+
+func parseResistance(resistanceType string) resistance {
+	r := resistance{unit: resistanceType}
+	if m := mixedPattern.FindStringSubmatch(resistanceType); m != nil {
+		r.sign = "+"
+		if m[1] == "-" || strings.EqualFold(m[1], "minus") {
+			r.sign = "-"
+		}
+		r.unit = m[2]
+	}
+	if m := loadPattern.FindStringSubmatch(strings.TrimSpace(r.unit)); m != nil {
+		r.load, _ = strconv.ParseFloat(strings.ReplaceAll(m[1], ",", "."), 64)
+		r.unit = m[2]
+	}
+	r.unit = Name(r.unit)
+	return r
+}
+
+func (r resistance) String() string {
+	if r.sign == "" {
+		return r.unit
+	}
+	return Bodyweight + " " + r.sign + " " + r.unit
+}
+
+// Canonical returns ex with its resistance and set loads in kilograms and its
+// distance work in meters, recording the units they were logged in. A load
+// written into the resistance type is the resistance when none is set. Units
+// it does not know, such as repetitions, are kept as they are. Converting an
+// exercise that is already canonical changes nothing.
+func Canonical(ex llm.Exercise) llm.Exercise {
+	if ex.OriginalResistanceType == "" && ex.ResistanceType != "" {
+		r := parseResistance(ex.ResistanceType)
+		if ex.Resistance == 0 {
+			ex.Resistance = r.load
+		}
+		ex.OriginalResistanceType = r.String()
+		if u, ok := knownUnits[r.unit]; ok && u.dimension == weight {
+			ex.Resistance = round(ex.Resistance*u.toSI, 3)
+			ex.SetDetails = scaleLoads(ex.SetDetails, u.toSI, 3)
+			r.unit = Kilograms
+		}
+		ex.ResistanceType = r.String()
+	}
+	if ex.OriginalWorkType == "" && ex.QuantityType != "" {
+		name := Name(ex.QuantityType)
+		ex.OriginalWorkType = name
+		if u, ok := knownUnits[name]; ok && u.dimension == distance {
+			ex.Quantity = round(ex.Quantity*u.toSI, 3)
+			name = Meters
+		}
+		ex.QuantityType = name
+	}
+	return ex
+}
+
+// Display returns a canonical exercise with its resistance, set loads and
+// distance work in the units of system: the units it was logged in when they
+// belong to system, or their counterparts in system otherwise
+func Display(ex llm.Exercise, system string) llm.Exercise {
+	if ex.ResistanceType != "" {
+		r := parseResistance(ex.ResistanceType)
+		original := parseResistance(ex.OriginalResistanceType)
+		if target := displayUnit(original.unit, r.unit, system, weight); target != r.unit {
+			factor := knownUnits[r.unit].toSI / knownUnits[target].toSI
+			ex.Resistance = round(ex.Resistance*factor, 2)
+			ex.SetDetails = scaleLoads(ex.SetDetails, factor, 2)
+			r.unit = target
+		}
+		ex.ResistanceType = r.String()
+	}
+	if ex.QuantityType != "" {
+		current := Name(ex.QuantityType)
+		if target := displayUnit(Name(ex.OriginalWorkType), current, system, distance); target != current {
+			ex.Quantity = round(ex.Quantity*knownUnits[current].toSI/knownUnits[target].toSI, 2)
+			ex.QuantityType = target
+		}
+	}
+	return ex
+}
+
+// displayUnit picks the unit a value stored in current, and logged in
+// original, is shown in for system. Values in units it does not know stay in
+// current.
+func displayUnit(original string, current string, system string, dim dimension) string {
+	if u, ok := knownUnits[current]; !ok || u.dimension != dim {
+		return current
+	}
+	logged, ok := knownUnits[original]
+	if !ok || logged.dimension != dim {
+		original, logged = current, knownUnits[current]
+	}
+	if system == AsLogged || logged.metric == (system == Metric) {
+		return original
+	}
+	return logged.counterpart
+}
+
+// scaleLoads returns sets with their loads multiplied by factor and rounded
+// to places, leaving sets unchanged
+func scaleLoads(sets []llm.ExerciseSet, factor float64, places int) []llm.ExerciseSet {
+	if len(sets) == 0 {
+		return sets
+	}
+	scaled := slices.Clone(sets)
+	for i := range scaled {
+		scaled[i].Load = round(scaled[i].Load*factor, places)
+	}
+	return scaled
+}
+
+func round(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,188 @@
+package units
+
+import (
+	"slices"
+	"testing"
+
+	llm "noerkrieg.com/server/llm"
+)
+
+// amounts is the part of an exercise units converts
+type amounts struct {
+	resistance             float64
+	resistanceType         string
+	work                   float64
+	workType               string
+	originalResistanceType string
+	originalWorkType       string
+	loads                  []float64
+}
+
+func amountsOf(ex llm.Exercise) amounts {
+	a := amounts{
+		resistance: ex.Resistance, resistanceType: ex.ResistanceType,
+		work: ex.Quantity, workType: ex.QuantityType,
+		originalResistanceType: ex.OriginalResistanceType, originalWorkType: ex.OriginalWorkType,
+	}
+	for _, set := range ex.SetDetails {
+		a.loads = append(a.loads, set.Load)
+	}
+	return a
+}
+
+func (a amounts) equal(b amounts) bool {
+	return a.resistance == b.resistance && a.resistanceType == b.resistanceType &&
+		a.work == b.work && a.workType == b.workType &&
+		a.originalResistanceType == b.originalResistanceType && a.originalWorkType == b.originalWorkType &&
+		slices.Equal(a.loads, b.loads)
+}
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		ex   llm.Exercise
+		want amounts
+	}{
+		{
+			name: "pounds",
+			ex: llm.Exercise{Resistance: 225, ResistanceType: "lbs", Quantity: 5, QuantityType: "reps",
+				SetDetails: []llm.ExerciseSet{{Reps: 5, Load: 225}, {Reps: 5, Load: 135}}},
+			want: amounts{resistance: 102.058, resistanceType: "kilograms", work: 5, workType: "reps",
+				originalResistanceType: "pounds", originalWorkType: "reps", loads: []float64{102.058, 61.235}},
+		},
+		{
+			name: "kilograms and kilometers",
+			ex:   llm.Exercise{Resistance: 20, ResistanceType: "kg", Quantity: 5, QuantityType: "km"},
+			want: amounts{resistance: 20, resistanceType: "kilograms", work: 5000, workType: "meters",
+				originalResistanceType: "kilograms", originalWorkType: "kilometers"},
+		},
+		{
+			name: "miles",
+			ex:   llm.Exercise{Quantity: 3.1, QuantityType: "Miles"},
+			want: amounts{work: 4988.966, workType: "meters", originalWorkType: "miles"},
+		},
+		{
+			name: "bodyweight",
+			ex:   llm.Exercise{ResistanceType: "bodyweight", Quantity: 10, QuantityType: "repetitions"},
+			want: amounts{resistanceType: "bodyweight", work: 10, workType: "repetitions",
+				originalResistanceType: "bodyweight", originalWorkType: "repetitions"},
+		},
+		{
+			name: "bodyweight plus pounds",
+			ex:   llm.Exercise{Resistance: 25, ResistanceType: "bodyweight + pounds"},
+			want: amounts{resistance: 11.34, resistanceType: "bodyweight + kilograms", originalResistanceType: "bodyweight + pounds"},
+		},
+		{
+			name: "load written into the type",
+			ex:   llm.Exercise{ResistanceType: "bodyweight + 25 lb"},
+			want: amounts{resistance: 11.34, resistanceType: "bodyweight + kilograms", originalResistanceType: "bodyweight + pounds"},
+		},
+		{
+			name: "load in the type and the resistance",
+			ex:   llm.Exercise{Resistance: 25, ResistanceType: "BW plus 25lbs"},
+			want: amounts{resistance: 11.34, resistanceType: "bodyweight + kilograms", originalResistanceType: "bodyweight + pounds"},
+		},
+		{
+			name: "assisted",
+			ex:   llm.Exercise{Resistance: 20, ResistanceType: "bw - kg"},
+			want: amounts{resistance: 20, resistanceType: "bodyweight - kilograms", originalResistanceType: "bodyweight - kilograms"},
+		},
+		{
+			name: "unknown units are kept",
+			ex:   llm.Exercise{Resistance: 3, ResistanceType: "Bands", Quantity: 30, QuantityType: "Seconds"},
+			want: amounts{resistance: 3, resistanceType: "bands", work: 30, workType: "seconds",
+				originalResistanceType: "bands", originalWorkType: "seconds"},
+		},
+		{
+			name: "already canonical",
+			ex: llm.Exercise{Resistance: 102.058, ResistanceType: "kilograms", OriginalResistanceType: "pounds",
+				Quantity: 4988.966, QuantityType: "meters", OriginalWorkType: "miles"},
+			want: amounts{resistance: 102.058, resistanceType: "kilograms", work: 4988.966, workType: "meters",
+				originalResistanceType: "pounds", originalWorkType: "miles"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := amountsOf(Canonical(tt.ex)); !got.equal(tt.want) {
+				t.Errorf("Canonical = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	loggedInPounds := Canonical(llm.Exercise{Resistance: 225, ResistanceType: "pounds", Quantity: 5, QuantityType: "repetitions",
+		SetDetails: []llm.ExerciseSet{{Reps: 5, Load: 225}}})
+	loggedInMiles := Canonical(llm.Exercise{Quantity: 3.1, QuantityType: "miles"})
+	weightedPullUp := Canonical(llm.Exercise{ResistanceType: "bodyweight + 25 lb", Quantity: 8, QuantityType: "repetitions"})
+	loggedInMeters := Canonical(llm.Exercise{Quantity: 400, QuantityType: "m"})
+
+	tests := []struct {
+		name   string
+		ex     llm.Exercise
+		system string
+		want   amounts
+	}{
+		{
+			name: "pounds as logged", ex: loggedInPounds, system: AsLogged,
+			want: amounts{resistance: 225, resistanceType: "pounds", work: 5, workType: "repetitions",
+				originalResistanceType: "pounds", originalWorkType: "repetitions", loads: []float64{225}},
+		},
+		{
+			name: "pounds in imperial", ex: loggedInPounds, system: Imperial,
+			want: amounts{resistance: 225, resistanceType: "pounds", work: 5, workType: "repetitions",
+				originalResistanceType: "pounds", originalWorkType: "repetitions", loads: []float64{225}},
+		},
+		{
+			name: "pounds in metric", ex: loggedInPounds, system: Metric,
+			want: amounts{resistance: 102.058, resistanceType: "kilograms", work: 5, workType: "repetitions",
+				originalResistanceType: "pounds", originalWorkType: "repetitions", loads: []float64{102.058}},
+		},
+		{
+			name: "miles in metric", ex: loggedInMiles, system: Metric,
+			want: amounts{work: 4.99, workType: "kilometers", originalWorkType: "miles"},
+		},
+		{
+			name: "miles as logged", ex: loggedInMiles, system: AsLogged,
+			want: amounts{work: 3.1, workType: "miles", originalWorkType: "miles"},
+		},
+		{
+			name: "meters in imperial", ex: loggedInMeters, system: Imperial,
+			want: amounts{work: 437.45, workType: "yards", originalWorkType: "meters"},
+		},
+		{
+			name: "bodyweight + 25 lb as logged", ex: weightedPullUp, system: AsLogged,
+			want: amounts{resistance: 25, resistanceType: "bodyweight + pounds", work: 8, workType: "repetitions",
+				originalResistanceType: "bodyweight + pounds", originalWorkType: "repetitions"},
+		},
+		{
+			name: "bodyweight + 25 lb in metric", ex: weightedPullUp, system: Metric,
+			want: amounts{resistance: 11.34, resistanceType: "bodyweight + kilograms", work: 8, workType: "repetitions",
+				originalResistanceType: "bodyweight + pounds", originalWorkType: "repetitions"},
+		},
+		{
+			name: "stored before units were recorded", system: Imperial,
+			ex:   llm.Exercise{Resistance: 100, ResistanceType: "kilograms"},
+			want: amounts{resistance: 220.46, resistanceType: "pounds"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := amountsOf(Display(tt.ex, tt.system)); !got.equal(tt.want) {
+				t.Errorf("Display(%q) = %+v, want %+v", tt.system, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestName(t *testing.T) {
+	tests := map[string]string{
+		"kg": "kilograms", " LBS ": "pounds", "Kilometres": "kilometers", "mi": "miles",
+		"ft": "feet", "repetitions": "repetitions", "Seconds": "seconds",
+	}
+	for unit, want := range tests {
+		if got := Name(unit); got != want {
+			t.Errorf("Name(%q) = %q, want %q", unit, got, want)
+		}
+	}
+}